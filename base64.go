@@ -0,0 +1,71 @@
+package cprovlib
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// decodeBase64 декодирует стандартный base64. С WithLenientBase64 перед декодированием
+// удаляются пробельные символы, переводы строк и строки заголовков PEM ("-----BEGIN ...-----").
+// Ошибка декодирования дополняется подсказкой о вероятной причине
+func (c *CryptoCLI) decodeBase64(s string) ([]byte, error) {
+	input := s
+	if c.lenientBase64 {
+		input = normalizeBase64(s)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(input)
+	if err != nil {
+		return nil, describeBase64Error(input, err)
+	}
+	return data, nil
+}
+
+// normalizeBase64 удаляет строки заголовков PEM и все пробельные символы
+func normalizeBase64(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+
+	for _, line := range strings.Split(s, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "-----") {
+			continue
+		}
+		for _, r := range line {
+			switch r {
+			case ' ', '\t', '\r', '\n':
+				continue
+			}
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// describeBase64Error дополняет ошибку декодирования длиной входа, позицией
+// недопустимого символа и подсказками о типичных причинах
+func describeBase64Error(input string, err error) error {
+	details := []string{fmt.Sprintf("input length %d", len(input))}
+
+	var corrupt base64.CorruptInputError
+	if errors.As(err, &corrupt) && int(corrupt) < len(input) {
+		details = append(details, fmt.Sprintf("unexpected %q at byte %d", input[corrupt], int64(corrupt)))
+	}
+
+	if strings.ContainsAny(input, " \t\r\n") {
+		details = append(details, "contains whitespace or line breaks (use WithLenientBase64 to strip them)")
+	}
+	if strings.Contains(input, "-----BEGIN") {
+		details = append(details, "contains PEM header (use WithLenientBase64 to strip it)")
+	}
+	if strings.ContainsAny(input, "-_") && !strings.ContainsAny(input, "+/") {
+		details = append(details, "looks like URL-safe base64, standard alphabet with '+' and '/' is expected")
+	}
+	if len(input)%4 != 0 {
+		details = append(details, "length is not a multiple of 4 (missing '=' padding?)")
+	}
+
+	return fmt.Errorf("%v (%s)", err, strings.Join(details, ", "))
+}
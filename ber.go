@@ -0,0 +1,206 @@
+package cprovlib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// maxBERDepth ограничение вложенности при разборе BER, чтобы искаженная подпись
+// не привела к переполнению стека
+const maxBERDepth = 64
+
+// berTagOctetString универсальный тег OCTET STRING
+const berTagOctetString = 0x04
+
+// berElement элемент BER: идентификатор (класс, форма, номер тега) и содержимое
+type berElement struct {
+	identifier  []byte        // Байты идентификатора как в исходной кодировке
+	constructed bool          // Составная форма
+	content     []byte        // Содержимое простой формы
+	children    []*berElement // Элементы составной формы
+}
+
+// berToDER перекодирует значение BER в DER: неопределенная длина заменяется определенной,
+// длины кодируются минимальным числом байт, составные OCTET STRING объединяются в простые.
+// Порядок элементов SET не меняется. changed - исходное значение было не в DER
+func berToDER(data []byte) ([]byte, bool, error) {
+	el, rest, changed, err := parseBERElement(data, 0)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(rest) > 0 {
+		return nil, false, errors.New("trailing data after BER value")
+	}
+
+	var buf bytes.Buffer
+	if writeDERElement(&buf, el) {
+		changed = true
+	}
+	return buf.Bytes(), changed, nil
+}
+
+// parseBERElement разбирает один элемент BER в начале data
+func parseBERElement(data []byte, depth int) (*berElement, []byte, bool, error) {
+	if depth > maxBERDepth {
+		return nil, nil, false, errors.New("BER nesting too deep")
+	}
+	if len(data) < 2 {
+		return nil, nil, false, errors.New("truncated BER element")
+	}
+
+	// Идентификатор: номер тега больше 30 кодируется в следующих байтах
+	idLen := 1
+	if data[0]&0x1f == 0x1f {
+		for {
+			if idLen >= len(data) {
+				return nil, nil, false, errors.New("truncated BER tag")
+			}
+			b := data[idLen]
+			idLen++
+			if b&0x80 == 0 {
+				break
+			}
+		}
+	}
+	el := &berElement{
+		identifier:  data[:idLen],
+		constructed: data[0]&0x20 != 0,
+	}
+	rest := data[idLen:]
+	if len(rest) == 0 {
+		return nil, nil, false, errors.New("truncated BER length")
+	}
+
+	changed := false
+	lengthByte := rest[0]
+	rest = rest[1:]
+
+	// Неопределенная длина: элементы до маркера конца содержимого 00 00
+	if lengthByte == 0x80 {
+		if !el.constructed {
+			return nil, nil, false, errors.New("indefinite length for primitive BER element")
+		}
+		for {
+			if len(rest) < 2 {
+				return nil, nil, false, errors.New("missing end-of-contents in BER element")
+			}
+			if rest[0] == 0 && rest[1] == 0 {
+				rest = rest[2:]
+				break
+			}
+			child, tail, childChanged, err := parseBERElement(rest, depth+1)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			el.children = append(el.children, child)
+			rest = tail
+			changed = changed || childChanged
+		}
+		return el, rest, true, nil
+	}
+
+	length := int(lengthByte)
+	if lengthByte&0x80 != 0 {
+		n := int(lengthByte & 0x7f)
+		if n == 0 || n > 4 || n > len(rest) {
+			return nil, nil, false, fmt.Errorf("invalid BER length of %d bytes", n)
+		}
+		// DER требует минимальной кодировки длины: короткой формы до 128 и без ведущих нулей
+		if rest[0] == 0 {
+			changed = true
+		}
+		length = 0
+		for _, b := range rest[:n] {
+			length = length<<8 | int(b)
+		}
+		rest = rest[n:]
+		if length < 0x80 {
+			changed = true
+		}
+	}
+	if length < 0 || length > len(rest) {
+		return nil, nil, false, errors.New("BER length exceeds data")
+	}
+
+	content := rest[:length]
+	rest = rest[length:]
+
+	if !el.constructed {
+		el.content = content
+		return el, rest, changed, nil
+	}
+
+	for len(content) > 0 {
+		child, tail, childChanged, err := parseBERElement(content, depth+1)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		el.children = append(el.children, child)
+		content = tail
+		changed = changed || childChanged
+	}
+	return el, rest, changed, nil
+}
+
+// writeDERElement записывает элемент в DER. Возвращает true, если составной OCTET STRING
+// был объединен в простой
+func writeDERElement(buf *bytes.Buffer, el *berElement) bool {
+	if el.constructed && isUniversalOctetString(el.identifier) {
+		var content bytes.Buffer
+		collectOctets(&content, el)
+		buf.WriteByte(berTagOctetString)
+		writeDERLength(buf, content.Len())
+		buf.Write(content.Bytes())
+		return true
+	}
+
+	buf.Write(el.identifier)
+	if !el.constructed {
+		writeDERLength(buf, len(el.content))
+		buf.Write(el.content)
+		return false
+	}
+
+	var content bytes.Buffer
+	changed := false
+	for _, child := range el.children {
+		if writeDERElement(&content, child) {
+			changed = true
+		}
+	}
+	writeDERLength(buf, content.Len())
+	buf.Write(content.Bytes())
+	return changed
+}
+
+// isUniversalOctetString проверяет, что идентификатор - универсальный OCTET STRING
+// (в простой или составной форме)
+func isUniversalOctetString(identifier []byte) bool {
+	return len(identifier) == 1 && identifier[0]&^0x20 == berTagOctetString
+}
+
+// collectOctets объединяет содержимое фрагментов составного OCTET STRING
+func collectOctets(buf *bytes.Buffer, el *berElement) {
+	if !el.constructed {
+		buf.Write(el.content)
+		return
+	}
+	for _, child := range el.children {
+		collectOctets(buf, child)
+	}
+}
+
+// writeDERLength записывает длину в минимальной кодировке DER
+func writeDERLength(buf *bytes.Buffer, length int) {
+	if length < 0x80 {
+		buf.WriteByte(byte(length))
+		return
+	}
+	var octets []byte
+	for l := length; l > 0; l >>= 8 {
+		octets = append([]byte{byte(l)}, octets...)
+	}
+	buf.WriteByte(0x80 | byte(len(octets)))
+	buf.Write(octets)
+}
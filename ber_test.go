@@ -0,0 +1,109 @@
+package cprovlib
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestBERToDER(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string // hex, пробелы для читаемости
+		want        string
+		wantChanged bool
+		wantErr     bool
+	}{
+		{
+			name:  "already DER",
+			input: "30 06 02 01 05 04 01 aa",
+			want:  "30 06 02 01 05 04 01 aa",
+		},
+		{
+			name:        "indefinite length",
+			input:       "30 80 02 01 05 04 01 aa 00 00",
+			want:        "30 06 02 01 05 04 01 aa",
+			wantChanged: true,
+		},
+		{
+			name:        "nested indefinite length",
+			input:       "30 80 a0 80 02 01 01 00 00 00 00",
+			want:        "30 05 a0 03 02 01 01",
+			wantChanged: true,
+		},
+		{
+			name:        "long form for short length",
+			input:       "04 81 02 aa bb",
+			want:        "04 02 aa bb",
+			wantChanged: true,
+		},
+		{
+			name:        "length with leading zero",
+			input:       "30 82 00 03 02 01 07",
+			want:        "30 03 02 01 07",
+			wantChanged: true,
+		},
+		{
+			name:        "non-minimal length of child",
+			input:       "30 04 02 81 01 07",
+			want:        "30 03 02 01 07",
+			wantChanged: true,
+		},
+		{
+			name:        "constructed OCTET STRING",
+			input:       "24 08 04 02 aa bb 04 02 cc dd",
+			want:        "04 04 aa bb cc dd",
+			wantChanged: true,
+		},
+		{
+			name:        "constructed indefinite OCTET STRING inside SEQUENCE",
+			input:       "30 80 24 80 04 01 aa 24 80 04 01 bb 00 00 00 00 00 00",
+			want:        "30 04 04 02 aa bb",
+			wantChanged: true,
+		},
+		{
+			// Тег контекстного класса в составной форме не является OCTET STRING
+			name:  "context tag kept",
+			input: "a0 03 04 01 aa",
+			want:  "a0 03 04 01 aa",
+		},
+		{name: "truncated", input: "30", wantErr: true},
+		{name: "length exceeds data", input: "04 05 aa", wantErr: true},
+		{name: "missing end-of-contents", input: "30 80 02 01 05", wantErr: true},
+		{name: "indefinite primitive", input: "04 80 aa 00 00", wantErr: true},
+		{name: "trailing data", input: "02 01 05 00", wantErr: true},
+		{name: "too deep", input: strings.Repeat("30 80 ", maxBERDepth+2), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed, err := berToDER(decodeTestHex(t, tt.input))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("berToDER = %x, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("berToDER: %v", err)
+			}
+			if want := decodeTestHex(t, tt.want); !bytes.Equal(got, want) {
+				t.Errorf("berToDER = %x, want %x", got, want)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+		})
+	}
+}
+
+// decodeTestHex декодирует hex с пробелами между байтами
+func decodeTestHex(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
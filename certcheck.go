@@ -0,0 +1,37 @@
+package cprovlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrCertExpired     = errors.New("срок действия сертификата истек")
+	ErrCertNotYetValid = errors.New("срок действия сертификата еще не начался")
+)
+
+// checkSigningCertificate проверяет до запуска cryptcp, что сертификат thumbprint есть
+// в хранилище клиента и действует в момент подписи (WithPreSignCertCheck)
+func (c *CryptoCLI) checkSigningCertificate(ctx context.Context, thumbprint string) error {
+	cert, err := c.certificateInfo(ctx, thumbprint)
+	if err != nil {
+		return err
+	}
+
+	now, _ := c.trustedNow()
+	return checkValidityPeriod(cert, now)
+}
+
+// checkValidityPeriod проверяет срок действия сертификата на момент now.
+// Границы, которые не удалось разобрать из вывода certmgr, не проверяются
+func checkValidityPeriod(cert *CertificateInfo, now time.Time) error {
+	if !cert.NotBefore.IsZero() && now.Before(cert.NotBefore) {
+		return fmt.Errorf("%w: thumbprint %s, valid from %s", ErrCertNotYetValid, cert.Thumbprint, cert.NotBefore.Format(time.RFC3339))
+	}
+	if !cert.NotAfter.IsZero() && now.After(cert.NotAfter) {
+		return fmt.Errorf("%w: thumbprint %s, expired at %s", ErrCertExpired, cert.Thumbprint, cert.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,366 @@
+package cprovlib
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+)
+
+var (
+	ErrCertNotFound = errors.New("сертификат не найден")
+)
+
+// CertificateInfo сведения о сертификате из вывода certmgr.
+// Отпечатки - строки в нижнем регистре без разделителей
+type CertificateInfo struct {
+	Thumbprint         string    `json:"thumbprint"`             // SHA1 отпечаток (используется certmgr/cryptcp)
+	SHA256             string    `json:"sha256,omitempty"`       // SHA256 отпечаток DER сертификата
+	Subject            string    `json:"subject"`                // Владелец
+	Issuer             string    `json:"issuer"`                 // Издатель
+	SerialNumber       string    `json:"serialNumber"`           // Серийный номер
+	NotBefore          time.Time `json:"notBefore"`              // Начало срока действия
+	NotAfter           time.Time `json:"notAfter"`               // Окончание срока действия
+	SignatureAlgorithm string    `json:"signatureAlgorithm"`     // Алгоритм подписи сертификата
+	PublicKeyAlgorithm string    `json:"publicKeyAlgorithm"`     // Алгоритм открытого ключа
+	HasPrivateKey      bool      `json:"hasPrivateKey"`          // Сертификат связан с закрытым ключом
+	Container          string    `json:"container,omitempty"`    // Контейнер закрытого ключа
+	ProviderName       string    `json:"providerName,omitempty"` // Имя криптопровайдера
+	ProviderType       int       `json:"providerType,omitempty"` // Тип криптопровайдера (80 - ГОСТ 2012/256, 81 - ГОСТ 2012/512)
+	KeyUsage           []string  `json:"keyUsage,omitempty"`     // Назначение ключа (digitalSignature, nonRepudiation, ...)
+	ExtKeyUsage        []string  `json:"extKeyUsage,omitempty"`  // OID расширенного назначения ключа (EKU)
+	Policies           []string  `json:"policies,omitempty"`     // OID политик сертификата (certificatePolicies)
+}
+
+// Назначения ключа, которые не допускают подпись документов: аутентификация TLS и вход в систему
+var authOnlyExtKeyUsages = map[string]bool{
+	"1.3.6.1.5.5.7.3.1":      true, // serverAuth
+	"1.3.6.1.5.5.7.3.2":      true, // clientAuth
+	"1.3.6.1.5.5.7.3.5":      true, // ipsecEndSystem
+	"1.3.6.1.5.5.7.3.6":      true, // ipsecTunnel
+	"1.3.6.1.5.5.7.3.7":      true, // ipsecUser
+	"1.3.6.1.4.1.311.20.2.2": true, // smartcardLogon
+}
+
+// keyUsageNames имена битов KeyUsage в порядке RFC 5280
+var keyUsageNames = []string{
+	"digitalSignature",
+	"nonRepudiation",
+	"keyEncipherment",
+	"dataEncipherment",
+	"keyAgreement",
+	"keyCertSign",
+	"cRLSign",
+	"encipherOnly",
+	"decipherOnly",
+}
+
+// oidExtKeyUsage OID расширения extKeyUsage
+var oidExtKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+
+// CanSign проверяет, что назначение ключа допускает подпись документов: KeyUsage содержит
+// digitalSignature или nonRepudiation (или не ограничено), а EKU не ограничен только
+// аутентификацией TLS и входом в систему. Для сертификата, DER которого не удалось
+// экспортировать, назначение неизвестно и возвращается false
+func (ci *CertificateInfo) CanSign() bool {
+	if ci.SHA256 == "" {
+		return false
+	}
+
+	if len(ci.KeyUsage) > 0 && !slices.Contains(ci.KeyUsage, "digitalSignature") && !slices.Contains(ci.KeyUsage, "nonRepudiation") {
+		return false
+	}
+
+	if len(ci.ExtKeyUsage) == 0 {
+		return true
+	}
+	for _, oid := range ci.ExtKeyUsage {
+		if !authOnlyExtKeyUsages[oid] {
+			return true
+		}
+	}
+	return false
+}
+
+// CertificateFilter отбирает сертификаты в ListCertificatesParsed
+type CertificateFilter func(cert *CertificateInfo) bool
+
+// FilterCanSign оставляет сертификаты, пригодные для подписи документов (CertificateInfo.CanSign)
+func FilterCanSign() CertificateFilter {
+	return func(cert *CertificateInfo) bool {
+		return cert.CanSign()
+	}
+}
+
+// FilterExtKeyUsage оставляет сертификаты, EKU которых содержит хотя бы один из OID oids
+func FilterExtKeyUsage(oids ...string) CertificateFilter {
+	return func(cert *CertificateInfo) bool {
+		for _, oid := range oids {
+			if slices.Contains(cert.ExtKeyUsage, oid) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterHasPrivateKey оставляет сертификаты, связанные с закрытым ключом
+func FilterHasPrivateKey() CertificateFilter {
+	return func(cert *CertificateInfo) bool {
+		return cert.HasPrivateKey
+	}
+}
+
+// ListCertificatesParsed получает список сертификатов в хранилище в разобранном виде.
+// SHA256 отпечаток и назначение ключа определяются по DER сертификата, экспортированного
+// через certmgr. filters: в результат попадают сертификаты, прошедшие все фильтры
+func (c *CryptoCLI) ListCertificatesParsed(ctx context.Context, filters ...CertificateFilter) ([]CertificateInfo, error) {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "ListCertificatesParsed")
+	defer span.End()
+
+	output, err := c.listStore(ctx, c.store)
+	if err != nil {
+		return nil, err
+	}
+
+	certs := parseCertmgrList(output)
+	for i := range certs {
+		der, err := c.ExportCertificate(ctx, certs[i].Thumbprint)
+		if err != nil {
+			c.log(ctx).Warn("certificate export failed",
+				"thumbprint", certs[i].Thumbprint,
+				"error", err)
+			continue
+		}
+		sum := sha256.Sum256(der)
+		certs[i].SHA256 = hex.EncodeToString(sum[:])
+
+		err = parseKeyUsage(&certs[i], der)
+		if err != nil {
+			c.log(ctx).Warn("certificate key usage parse failed",
+				"thumbprint", certs[i].Thumbprint,
+				"error", err)
+		}
+	}
+
+	if len(filters) == 0 {
+		return certs, nil
+	}
+
+	filtered := certs[:0]
+	for i := range certs {
+		if matchesFilters(&certs[i], filters) {
+			filtered = append(filtered, certs[i])
+		}
+	}
+	return filtered, nil
+}
+
+// matchesFilters проверяет, что сертификат проходит все фильтры
+func matchesFilters(cert *CertificateInfo, filters []CertificateFilter) bool {
+	for _, filter := range filters {
+		if !filter(cert) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseKeyUsage заполняет KeyUsage, ExtKeyUsage и Policies по DER сертификата.
+// EKU разбирается из расширения напрямую, чтобы сохранить OID, неизвестные Go (ГОСТ, ФНС и т.п.)
+func parseKeyUsage(info *CertificateInfo, der []byte) error {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+
+	info.Policies = certPolicies(cert)
+
+	for bit, name := range keyUsageNames {
+		if cert.KeyUsage&(1<<bit) != 0 {
+			info.KeyUsage = append(info.KeyUsage, name)
+		}
+	}
+
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidExtKeyUsage) {
+			continue
+		}
+		var oids []asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(ext.Value, &oids); err != nil {
+			return fmt.Errorf("parse extKeyUsage: %v", err)
+		}
+		for _, oid := range oids {
+			info.ExtKeyUsage = append(info.ExtKeyUsage, oid.String())
+		}
+	}
+
+	return nil
+}
+
+// FindThumbprintBySHA256 возвращает SHA1 отпечаток сертификата хранилища по его SHA256 отпечатку
+func (c *CryptoCLI) FindThumbprintBySHA256(ctx context.Context, sha256Hex string) (string, error) {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "FindThumbprintBySHA256")
+	defer span.End()
+
+	want := strings.ToLower(strings.NewReplacer(" ", "", ":", "").Replace(sha256Hex))
+
+	certs, err := c.ListCertificatesParsed(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	for _, cert := range certs {
+		if cert.SHA256 == want {
+			return cert.Thumbprint, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: sha256 %s in store %s", ErrCertNotFound, want, c.store)
+}
+
+// ExportCertificate экспортирует сертификат из хранилища в DER
+func (c *CryptoCLI) ExportCertificate(ctx context.Context, thumbprint string) ([]byte, error) {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "ExportCertificate")
+	defer span.End()
+
+	thumbprint, err := NormalizeThumbprint(thumbprint)
+	if err != nil {
+		return nil, err
+	}
+
+	workDir, err := c.newWorkDir()
+	if err != nil {
+		return nil, fmt.Errorf("create work directory: %v", err)
+	}
+	defer c.removeWorkDir(workDir)
+
+	certFilePath := workDir + "/cert.cer"
+	_, stderr, err := c.runCertmgr(ctx,
+		"-export",
+		"-store", c.store,
+		"-thumbprint", thumbprint,
+		"-dest", certFilePath,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("certmgr export: %v, stderr: %s", err, stderr)
+	}
+
+	der, err := c.fileSystem.ReadFile(certFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("read exported certificate: %v", err)
+	}
+
+	return der, nil
+}
+
+// parseCertmgrList разбирает вывод certmgr -list. Каждый сертификат выводится блоком строк
+// "Ключ : значение", блоки начинаются со строки вида "1-------"
+func parseCertmgrList(output string) []CertificateInfo {
+	var certs []CertificateInfo
+	var current *CertificateInfo
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if isCertmgrBlockStart(line) {
+			certs = append(certs, CertificateInfo{})
+			current = &certs[len(certs)-1]
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "sha1 hash", "sha1 thumbprint":
+			current.Thumbprint = strings.ToLower(strings.TrimPrefix(value, "0x"))
+		case "subject":
+			current.Subject = value
+		case "issuer":
+			current.Issuer = value
+		case "serial":
+			current.SerialNumber = value
+		case "not valid before":
+			current.NotBefore = parseCertmgrTime(value)
+		case "not valid after":
+			current.NotAfter = parseCertmgrTime(value)
+		case "signature algorithm":
+			current.SignatureAlgorithm = value
+		case "publickey algorithm":
+			current.PublicKeyAlgorithm = value
+		case "privatekey link":
+			current.HasPrivateKey = strings.EqualFold(value, "yes")
+		case "container":
+			current.Container = value
+		case "provider name":
+			current.ProviderName = value
+		case "provider info":
+			current.ProviderType = parseProviderType(value)
+		}
+	}
+
+	// Отбрасываем блоки без отпечатка (например, итоговые строки вывода)
+	parsed := certs[:0]
+	for _, cert := range certs {
+		if cert.Thumbprint != "" {
+			parsed = append(parsed, cert)
+		}
+	}
+	return parsed
+}
+
+// isCertmgrBlockStart проверяет строку-заголовок блока сертификата: номер и дефисы ("1-------")
+func isCertmgrBlockStart(line string) bool {
+	digits := strings.TrimRight(line, "-")
+	if digits == line || digits == "" {
+		return false
+	}
+	_, err := strconv.Atoi(digits)
+	return err == nil
+}
+
+// parseCertmgrTime разбирает дату certmgr вида "18/04/2023  07:21:15 UTC"
+func parseCertmgrTime(value string) time.Time {
+	t, err := time.Parse("02/01/2006 15:04:05 MST", strings.Join(strings.Fields(value), " "))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// parseProviderType извлекает тип провайдера из строки "Provider Type: 80, Key Spec: 1, Flags: 0x0"
+func parseProviderType(value string) int {
+	for _, part := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(part, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(key), "provider type") {
+			n, err := strconv.Atoi(strings.TrimSpace(val))
+			if err == nil {
+				return n
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,231 @@
+package cprovlib
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+)
+
+// caCertificate сертификат УЦ, подготовленный к установке
+type caCertificate struct {
+	der        []byte
+	thumbprint string
+	subject    string
+	store      string // Хранилище назначения: корневые или промежуточные УЦ
+}
+
+// InstallCertificateWithChain устанавливает сертификат с закрытым ключом (PKCS#12 в base64)
+// в хранилище клиента, а сертификаты УЦ caCerts (DER или PEM) - в хранилища Root
+// (самоподписанные) и CA (промежуточные) того же уровня (u/m), что и хранилище клиента.
+//
+// Уже установленные сертификаты УЦ пропускаются. При ошибке на любом шаге сертификаты УЦ,
+// установленные этим вызовом, удаляются.
+func (c *CryptoCLI) InstallCertificateWithChain(ctx context.Context, p12Base64 string, pin string, caCerts [][]byte) error {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "InstallCertificateWithChain")
+	defer span.End()
+
+	p12, err := c.decodePFX(p12Base64)
+	if err != nil {
+		return err
+	}
+
+	prefix := "u"
+	if strings.HasPrefix(strings.ToLower(c.store), "m") {
+		prefix = "m"
+	}
+
+	chain := make([]caCertificate, 0, len(caCerts))
+	for i, raw := range caCerts {
+		der := raw
+		if block, _ := pem.Decode(raw); block != nil {
+			der = block.Bytes
+		}
+
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf("%w: parse CA certificate %d: %v", ErrCertificateInstallation, i, err)
+		}
+
+		sum := sha1.Sum(cert.Raw)
+		ca := caCertificate{
+			der:        cert.Raw,
+			thumbprint: hex.EncodeToString(sum[:]),
+			subject:    cert.Subject.String(),
+			store:      prefix + "CA",
+		}
+		if bytes.Equal(cert.RawSubject, cert.RawIssuer) {
+			ca.store = prefix + "Root"
+		}
+		chain = append(chain, ca)
+	}
+
+	var installed []caCertificate
+	rollback := func() {
+		// Откат выполняется и при отмене контекста вызова
+		rollbackCtx := context.WithoutCancel(ctx)
+		for i := len(installed) - 1; i >= 0; i-- {
+			ca := installed[i]
+			err := c.deleteFromStore(rollbackCtx, ca.store, ca.thumbprint)
+			if err != nil {
+				c.log(ctx).Error("rollback of CA certificate failed",
+					"thumbprint", ca.thumbprint,
+					"store", ca.store,
+					"error", err)
+			}
+		}
+	}
+
+	for _, ca := range chain {
+		output, err := c.listStore(ctx, ca.store)
+		if err == nil && strings.Contains(strings.ToLower(output), ca.thumbprint) {
+			c.log(ctx).Debug("CA certificate already installed",
+				"thumbprint", ca.thumbprint,
+				"store", ca.store)
+			continue
+		}
+
+		err = c.installCertFile(ctx, ca.store, ca.der)
+		if err != nil {
+			rollback()
+			return fmt.Errorf("%w: install CA certificate %s (%s): %v", ErrCertificateInstallation, ca.subject, ca.thumbprint, err)
+		}
+
+		c.log(ctx).Info("CA certificate installed",
+			"thumbprint", ca.thumbprint,
+			"subject", ca.subject,
+			"store", ca.store)
+		installed = append(installed, ca)
+	}
+
+	err = c.installPFX(ctx, p12, pin, "")
+	if err != nil {
+		rollback()
+		return err
+	}
+
+	return nil
+}
+
+// installCertFile устанавливает сертификат без закрытого ключа (DER) в указанное хранилище
+func (c *CryptoCLI) installCertFile(ctx context.Context, store string, der []byte) error {
+	workDir, err := c.newWorkDirIn(c.installTmpBase())
+	if err != nil {
+		return fmt.Errorf("create work directory: %v", err)
+	}
+	defer c.removeWorkDir(workDir)
+
+	certFilePath := filepath.Join(workDir, "cert.cer")
+	err = c.fileSystem.WriteFile(certFilePath, der, 0600)
+	if err != nil {
+		return fmt.Errorf("write file: %v", err)
+	}
+
+	ctx, cancel := c.certmgrContext(ctx)
+	defer cancel()
+
+	cmd := c.command(ctx, c.certmgrPath,
+		"-install",
+		"-store", store,
+		"-file", certFilePath,
+	)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = c.certmgrRun(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("certmgr: %w, stderr: %s", err, decodeOutput(stderr.Bytes()))
+	}
+	c.stats.certsInstalled.Add(1)
+
+	return nil
+}
+
+// GetCertificateChain возвращает цепочку сертификата с отпечатком thumbprint, построенную CSP
+// (certmgr -list -chain), в порядке от конечного сертификата к корневому. Используется для
+// диагностики ошибок построения цепочки при подписи: если цепочка не доходит до самоподписанного
+// корня, возвращается построенная часть, а отсутствие корня фиксируется в логе
+func (c *CryptoCLI) GetCertificateChain(ctx context.Context, thumbprint string) ([]CertificateInfo, error) {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "GetCertificateChain")
+	defer span.End()
+
+	thumbprint, err := NormalizeThumbprint(thumbprint)
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, stderr, err := c.runCertmgr(ctx,
+		"-list",
+		"-chain",
+		"-store", c.store,
+		"-thumbprint", thumbprint,
+	)
+	if err != nil {
+		if isEmptyStoreOutput(stdout + stderr) {
+			return nil, fmt.Errorf("%w: thumbprint %s in store %s", ErrCertNotFound, thumbprint, c.store)
+		}
+		return nil, fmt.Errorf("certmgr list chain: %v, stderr: %s", err, stderr)
+	}
+
+	chain, err := orderCertificateChain(parseCertmgrList(stdout), thumbprint)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v in store %s", ErrCertNotFound, err, c.store)
+	}
+
+	last := chain[len(chain)-1]
+	if last.Subject != last.Issuer {
+		c.log(ctx).Warn("certificate chain does not reach a self-signed root",
+			"thumbprint", thumbprint,
+			"length", len(chain),
+			"lastSubject", last.Subject,
+			"lastIssuer", last.Issuer)
+	}
+
+	return chain, nil
+}
+
+// orderCertificateChain упорядочивает сертификаты из вывода certmgr от сертификата thumbprint
+// к корню по совпадению издателя и владельца, пропуская повторы.
+// Сертификаты, не входящие в цепочку, отбрасываются
+func orderCertificateChain(certs []CertificateInfo, thumbprint string) ([]CertificateInfo, error) {
+	byThumbprint := make(map[string]CertificateInfo, len(certs))
+	for _, cert := range certs {
+		byThumbprint[cert.Thumbprint] = cert
+	}
+
+	current, ok := byThumbprint[thumbprint]
+	if !ok {
+		return nil, fmt.Errorf("thumbprint %s", thumbprint)
+	}
+
+	chain := []CertificateInfo{current}
+	seen := map[string]bool{current.Thumbprint: true}
+	for current.Subject != current.Issuer {
+		next, found := CertificateInfo{}, false
+		for _, cert := range certs {
+			if !seen[cert.Thumbprint] && cert.Subject == current.Issuer {
+				next, found = cert, true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+		chain = append(chain, next)
+		seen[next.Thumbprint] = true
+		current = next
+	}
+
+	return chain, nil
+}
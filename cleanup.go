@@ -0,0 +1,73 @@
+package cprovlib
+
+import (
+	"time"
+)
+
+// removeWorkDir удаляет рабочую директорию операции или очищает и возвращает ее в пул
+// (WithWorkDirPool). При включенной опции WithAsyncCleanup удаление выполняется в фоне,
+// чтобы медленная файловая система (например, NFS) не задерживала ответ
+func (c *CryptoCLI) removeWorkDir(workDir string) {
+	// Фоновое удаление учитывается в cleanupWG до завершения операции
+	defer c.operationsWG.Done()
+
+	remove := func() error {
+		if c.workDirPool != nil && c.workDirPool.owns(workDir) {
+			return c.workDirPool.release(c.fileSystem, workDir)
+		}
+		return c.fileSystem.RemoveAll(workDir)
+	}
+
+	if c.cleanupTimeout <= 0 {
+		err := remove()
+		if err != nil {
+			c.logger.Warn("work directory cleanup failed",
+				"workDir", workDir,
+				"error", err)
+		}
+		return
+	}
+
+	c.cleanupWG.Add(1)
+	go func() {
+		defer c.cleanupWG.Done()
+
+		done := make(chan error, 1)
+		go func() {
+			done <- remove()
+		}()
+
+		timer := time.NewTimer(c.cleanupTimeout)
+		defer timer.Stop()
+
+		select {
+		case err := <-done:
+			if err != nil {
+				c.logger.Warn("work directory cleanup failed",
+					"workDir", workDir,
+					"error", err)
+			}
+		case <-timer.C:
+			// RemoveAll нельзя прервать: удаление продолжится, но Close его уже не ждет
+			c.logger.Warn("work directory cleanup timed out",
+				"workDir", workDir,
+				"timeout", c.cleanupTimeout.Seconds())
+		}
+	}()
+}
+
+// Close дожидается завершения начатых операций клиента и фоновых удалений рабочих директорий,
+// затем удаляет пул рабочих директорий: подпись или проверка, еще выполняющаяся
+// в другой горутине, не теряет свою директорию. После Close клиент не следует использовать
+func (c *CryptoCLI) Close() error {
+	c.operationsWG.Wait()
+	c.cleanupWG.Wait()
+
+	if c.workDirPool == nil {
+		return nil
+	}
+	if root := c.workDirPool.rootDir(); root != "" {
+		return c.fileSystem.RemoveAll(root)
+	}
+	return nil
+}
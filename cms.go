@@ -0,0 +1,460 @@
+package cprovlib
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var (
+	oidData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+	// Атрибуты CMS (RFC 5652) и CAdES (RFC 5126)
+	oidAttrSigningTime            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidAttrSigningCertificate     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 12}
+	oidAttrSigningCertificateV2   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidAttrRevocationValues       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 24}
+	oidAttrTimeStampToken         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+	oidAttrCertificateValues      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 23}
+	oidAttrCompleteCertRefs       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 21}
+	oidAttrCompleteRevocationRefs = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 22}
+	oidAttrEscTimeStamp           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 25}
+
+	oidTSTInfo = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+)
+
+// cmsSignedData разобранная структура CMS SignedData (RFC 5652).
+// Элементы, которые библиотека не меняет, хранятся в исходном DER виде
+type cmsSignedData struct {
+	version          asn1.RawValue
+	digestAlgorithms asn1.RawValue
+	eContentType     asn1.ObjectIdentifier
+	eContent         []byte // Подписанные данные, nil для отсоединенной подписи
+	certificates     *asn1.RawValue
+	crls             *asn1.RawValue
+	signerInfos      asn1.RawValue
+}
+
+// parseSignedData разбирает ContentInfo с вложенным SignedData
+func parseSignedData(der []byte) (*cmsSignedData, error) {
+	var contentInfo asn1.RawValue
+	rest, err := asn1.Unmarshal(der, &contentInfo)
+	if err != nil {
+		return nil, fmt.Errorf("content info: %v", err)
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("content info: trailing data")
+	}
+
+	ciElements, err := asn1Elements(contentInfo)
+	if err != nil || len(ciElements) != 2 {
+		return nil, errors.New("content info: malformed sequence")
+	}
+
+	var contentType asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(ciElements[0].FullBytes, &contentType); err != nil {
+		return nil, fmt.Errorf("content type: %v", err)
+	}
+	if !contentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("content type %s is not signed data", contentType)
+	}
+
+	// content [0] EXPLICIT SignedData
+	var sdRaw asn1.RawValue
+	if _, err := asn1.Unmarshal(ciElements[1].Bytes, &sdRaw); err != nil {
+		return nil, fmt.Errorf("signed data: %v", err)
+	}
+
+	elements, err := asn1Elements(sdRaw)
+	if err != nil {
+		return nil, fmt.Errorf("signed data: %v", err)
+	}
+	if len(elements) < 4 {
+		return nil, errors.New("signed data: too few elements")
+	}
+
+	sd := &cmsSignedData{
+		version:          elements[0],
+		digestAlgorithms: elements[1],
+		signerInfos:      elements[len(elements)-1],
+	}
+
+	if err := sd.parseEncapContentInfo(elements[2]); err != nil {
+		return nil, err
+	}
+
+	// Необязательные [0] certificates и [1] crls
+	for i := 3; i < len(elements)-1; i++ {
+		el := elements[i]
+		switch {
+		case isContextTag(el, 0):
+			sd.certificates = &elements[i]
+		case isContextTag(el, 1):
+			sd.crls = &elements[i]
+		default:
+			return nil, fmt.Errorf("signed data: unexpected element with tag %d", el.Tag)
+		}
+	}
+
+	return sd, nil
+}
+
+// parseEncapContentInfo разбирает EncapsulatedContentInfo
+func (sd *cmsSignedData) parseEncapContentInfo(raw asn1.RawValue) error {
+	elements, err := asn1Elements(raw)
+	if err != nil || len(elements) == 0 || len(elements) > 2 {
+		return errors.New("encapsulated content info: malformed sequence")
+	}
+
+	if _, err := asn1.Unmarshal(elements[0].FullBytes, &sd.eContentType); err != nil {
+		return fmt.Errorf("encapsulated content type: %v", err)
+	}
+
+	if len(elements) == 1 {
+		return nil
+	}
+
+	// eContent [0] EXPLICIT OCTET STRING
+	var octets asn1.RawValue
+	if _, err := asn1.Unmarshal(elements[1].Bytes, &octets); err != nil {
+		return fmt.Errorf("encapsulated content: %v", err)
+	}
+	content, err := octetStringBytes(octets)
+	if err != nil {
+		return fmt.Errorf("encapsulated content: %v", err)
+	}
+	sd.eContent = content
+
+	return nil
+}
+
+// marshal собирает ContentInfo с SignedData обратно в DER
+func (sd *cmsSignedData) marshal() ([]byte, error) {
+	eContentTypeDER, err := asn1.Marshal(sd.eContentType)
+	if err != nil {
+		return nil, err
+	}
+
+	encap := eContentTypeDER
+	if sd.eContent != nil {
+		octets, err := asn1.Marshal(sd.eContent)
+		if err != nil {
+			return nil, err
+		}
+		explicit, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: octets})
+		if err != nil {
+			return nil, err
+		}
+		encap = append(encap, explicit...)
+	}
+	encapDER, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: encap})
+	if err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	body = append(body, sd.version.FullBytes...)
+	body = append(body, sd.digestAlgorithms.FullBytes...)
+	body = append(body, encapDER...)
+	if sd.certificates != nil {
+		body = append(body, sd.certificates.FullBytes...)
+	}
+	if sd.crls != nil {
+		body = append(body, sd.crls.FullBytes...)
+	}
+	body = append(body, sd.signerInfos.FullBytes...)
+
+	sdDER, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: body})
+	if err != nil {
+		return nil, err
+	}
+
+	contentTypeDER, err := asn1.Marshal(oidSignedData)
+	if err != nil {
+		return nil, err
+	}
+	content, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sdDER})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: append(contentTypeDER, content...)})
+}
+
+// singleSignerDER собирает подпись только с i-м SignerInfo: сертификаты, списки отзыва
+// и подписанные данные остаются прежними, поэтому такую подпись можно проверить отдельно
+func (sd *cmsSignedData) singleSignerDER(i int) ([]byte, error) {
+	elements, err := asn1Elements(sd.signerInfos)
+	if err != nil {
+		return nil, fmt.Errorf("signer infos: %v", err)
+	}
+	if i < 0 || i >= len(elements) {
+		return nil, fmt.Errorf("signer info %d out of range", i)
+	}
+
+	setDER, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: elements[i].FullBytes})
+	if err != nil {
+		return nil, err
+	}
+	single := *sd
+	if _, err := asn1.Unmarshal(setDER, &single.signerInfos); err != nil {
+		return nil, err
+	}
+
+	return single.marshal()
+}
+
+// certificatesDER возвращает DER сертификатов, включенных в подпись
+func (sd *cmsSignedData) certificatesDER() [][]byte {
+	if sd.certificates == nil {
+		return nil
+	}
+
+	elements, err := asn1Elements(*sd.certificates)
+	if err != nil {
+		return nil
+	}
+
+	var certs [][]byte
+	for _, el := range elements {
+		// CertificateChoices: берем только обычные сертификаты (SEQUENCE)
+		if el.Class == asn1.ClassUniversal && el.Tag == asn1.TagSequence {
+			certs = append(certs, el.FullBytes)
+		}
+	}
+	return certs
+}
+
+// signerCertificate ищет среди сертификатов подписи сертификат подписанта по его идентификатору (sid)
+func (sd *cmsSignedData) signerCertificate(si *cmsSignerInfo) (*x509.Certificate, error) {
+	var issuer []byte
+	var serial *big.Int
+	var keyID []byte
+
+	if isContextTag(si.sid, 0) {
+		// [0] SubjectKeyIdentifier
+		keyID = si.sid.Bytes
+	} else {
+		// IssuerAndSerialNumber ::= SEQUENCE { issuer Name, serialNumber INTEGER }
+		parts, err := asn1Elements(si.sid)
+		if err != nil || len(parts) != 2 {
+			return nil, errors.New("malformed signer identifier")
+		}
+		issuer = parts[0].FullBytes
+		serial = new(big.Int)
+		if _, err := asn1.Unmarshal(parts[1].FullBytes, &serial); err != nil {
+			return nil, fmt.Errorf("signer serial number: %v", err)
+		}
+	}
+
+	for _, der := range sd.certificatesDER() {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			continue
+		}
+		if keyID != nil && bytes.Equal(cert.SubjectKeyId, keyID) {
+			return cert, nil
+		}
+		if serial != nil && bytes.Equal(cert.RawIssuer, issuer) && cert.SerialNumber.Cmp(serial) == 0 {
+			return cert, nil
+		}
+	}
+
+	return nil, errors.New("signer certificate is not included in signature")
+}
+
+// cmsSignerInfo разобранная структура SignerInfo
+type cmsSignerInfo struct {
+	sid           asn1.RawValue
+	signedAttrs   []cmsAttribute
+	unsignedAttrs []cmsAttribute
+	signature     []byte
+}
+
+// cmsAttribute атрибут SignerInfo со значениями в исходном DER виде
+type cmsAttribute struct {
+	oid    asn1.ObjectIdentifier
+	values []asn1.RawValue
+}
+
+// signers разбирает все SignerInfo подписи
+func (sd *cmsSignedData) signers() ([]cmsSignerInfo, error) {
+	elements, err := asn1Elements(sd.signerInfos)
+	if err != nil {
+		return nil, fmt.Errorf("signer infos: %v", err)
+	}
+
+	signers := make([]cmsSignerInfo, 0, len(elements))
+	for i, el := range elements {
+		si, err := parseSignerInfo(el)
+		if err != nil {
+			return nil, fmt.Errorf("signer info %d: %v", i, err)
+		}
+		signers = append(signers, si)
+	}
+	return signers, nil
+}
+
+// parseSignerInfo разбирает SignerInfo:
+// version, sid, digestAlgorithm, [0] signedAttrs, signatureAlgorithm, signature, [1] unsignedAttrs
+func parseSignerInfo(raw asn1.RawValue) (cmsSignerInfo, error) {
+	var si cmsSignerInfo
+
+	elements, err := asn1Elements(raw)
+	if err != nil {
+		return si, err
+	}
+	if len(elements) < 5 {
+		return si, errors.New("too few elements")
+	}
+
+	si.sid = elements[1]
+	idx := 3
+
+	if isContextTag(elements[idx], 0) {
+		si.signedAttrs, err = parseAttributes(elements[idx])
+		if err != nil {
+			return si, fmt.Errorf("signed attributes: %v", err)
+		}
+		idx++
+	}
+
+	// signatureAlgorithm пропускаем, затем signature OCTET STRING
+	idx++
+	if idx >= len(elements) {
+		return si, errors.New("missing signature value")
+	}
+	si.signature, err = octetStringBytes(elements[idx])
+	if err != nil {
+		return si, fmt.Errorf("signature value: %v", err)
+	}
+	idx++
+
+	if idx < len(elements) && isContextTag(elements[idx], 1) {
+		si.unsignedAttrs, err = parseAttributes(elements[idx])
+		if err != nil {
+			return si, fmt.Errorf("unsigned attributes: %v", err)
+		}
+	}
+
+	return si, nil
+}
+
+// parseAttributes разбирает SET OF Attribute
+func parseAttributes(raw asn1.RawValue) ([]cmsAttribute, error) {
+	elements, err := asn1Elements(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := make([]cmsAttribute, 0, len(elements))
+	for _, el := range elements {
+		parts, err := asn1Elements(el)
+		if err != nil || len(parts) != 2 {
+			return nil, errors.New("malformed attribute")
+		}
+
+		var attr cmsAttribute
+		if _, err := asn1.Unmarshal(parts[0].FullBytes, &attr.oid); err != nil {
+			return nil, fmt.Errorf("attribute type: %v", err)
+		}
+		attr.values, err = asn1Elements(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s values: %v", attr.oid, err)
+		}
+		attrs = append(attrs, attr)
+	}
+	return attrs, nil
+}
+
+// findAttribute возвращает атрибут с заданным OID или nil
+func findAttribute(attrs []cmsAttribute, oid asn1.ObjectIdentifier) *cmsAttribute {
+	for i := range attrs {
+		if attrs[i].oid.Equal(oid) {
+			return &attrs[i]
+		}
+	}
+	return nil
+}
+
+// hasRevocationValues проверяет, что атрибут revocationValues (CAdES-X Long)
+// содержит хотя бы один CRL или ответ OCSP
+func (si *cmsSignerInfo) hasRevocationValues() bool {
+	attr := findAttribute(si.unsignedAttrs, oidAttrRevocationValues)
+	if attr == nil || len(attr.values) == 0 {
+		return false
+	}
+
+	// RevocationValues ::= SEQUENCE { crlVals [0], ocspVals [1], otherRevVals [2] }
+	fields, err := asn1Elements(attr.values[0])
+	if err != nil {
+		return false
+	}
+	for _, field := range fields {
+		values, err := asn1Elements(field)
+		if err == nil && len(values) > 0 {
+			// [0] и [1] содержат SEQUENCE OF, [2] - произвольную структуру
+			if field.Tag == 2 {
+				return true
+			}
+			inner, err := asn1Elements(values[0])
+			if err == nil && len(inner) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isContextTag проверяет, что значение закодировано с контекстным тегом
+func isContextTag(raw asn1.RawValue, tag int) bool {
+	return raw.Class == asn1.ClassContextSpecific && raw.Tag == tag
+}
+
+// asn1Elements возвращает элементы составного значения (SEQUENCE, SET или контекстного тега)
+func asn1Elements(raw asn1.RawValue) ([]asn1.RawValue, error) {
+	if !raw.IsCompound {
+		return nil, errors.New("value is not constructed")
+	}
+
+	var elements []asn1.RawValue
+	rest := raw.Bytes
+	for len(rest) > 0 {
+		var el asn1.RawValue
+		var err error
+		rest, err = asn1.Unmarshal(rest, &el)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, el)
+	}
+	return elements, nil
+}
+
+// octetStringBytes возвращает содержимое OCTET STRING, в том числе составной (BER)
+func octetStringBytes(raw asn1.RawValue) ([]byte, error) {
+	if raw.Class != asn1.ClassUniversal || raw.Tag != asn1.TagOctetString {
+		return nil, fmt.Errorf("expected octet string, got tag %d", raw.Tag)
+	}
+	if !raw.IsCompound {
+		return raw.Bytes, nil
+	}
+
+	parts, err := asn1Elements(raw)
+	if err != nil {
+		return nil, err
+	}
+	var content []byte
+	for _, part := range parts {
+		b, err := octetStringBytes(part)
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, b...)
+	}
+	return content, nil
+}
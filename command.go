@@ -0,0 +1,195 @@
+package cprovlib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// CommandError ошибка выполнения утилиты КриптоПро с подробностями для диагностики.
+// Возвращается обернутой в ErrSignature и т.п., доступна через errors.As
+type CommandError struct {
+	Tool      string // Имя утилиты (cryptcp, certmgr)
+	ExitCode  int    // Код завершения процесса, -1 если процесс не завершился сам
+	ErrorCode string // Код ошибки КриптоПро из вывода, например "0x20000133"
+	Stdout    string // Вывод утилиты
+	Stderr    string
+	Err       error // Исходная ошибка
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("%v, exit code: %d, error code: %s, stdout: %s, stderr: %s",
+		e.Err, e.ExitCode, e.ErrorCode, e.Stdout, e.Stderr)
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// errorCodePattern код ошибки в выводе утилит КриптоПро: "[ErrorCode: 0x20000133]"
+var errorCodePattern = regexp.MustCompile(`\[ErrorCode:\s*(0x[0-9a-fA-F]+)\]`)
+
+// parseErrorCode возвращает последний код ошибки из вывода утилиты или пустую строку
+func parseErrorCode(output string) string {
+	matches := errorCodePattern.FindAllStringSubmatch(output, -1)
+	if len(matches) == 0 {
+		return ""
+	}
+	return strings.ToLower(matches[len(matches)-1][1])
+}
+
+// exitCode возвращает код завершения процесса: 0 при успехе, -1 если процесс не был запущен
+// или был остановлен сигналом
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// command создает команду для запуска утилиты КриптоПро с учетом настроек клиента
+func (c *CryptoCLI) command(ctx context.Context, path string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, path, args...)
+
+	// Утилиты не должны ждать интерактивного ввода ("Press any key", запрос PIN):
+	// stdin сразу возвращает EOF, а управляющий терминал недоступен
+	cmd.Stdin = strings.NewReader("")
+	detachTerminal(cmd)
+
+	// После завершения процесса по таймауту не ждем бесконечно дочерние процессы,
+	// удерживающие его вывод
+	cmd.WaitDelay = commandWaitDelay
+
+	// Окружение наследуется от процесса (переменные КриптоПро), локаль задается WithSubprocessEnv
+	if len(c.subprocessEnv) > 0 {
+		cmd.Env = mergeEnv(os.Environ(), c.subprocessEnv)
+	}
+	// Унаследованные от процесса TRACEPARENT и TRACESTATE относятся к чужому span и удаляются
+	// всегда, даже если в контексте нет span; их заменяют значения текущего span
+	if c.traceContextEnv {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = mergeEnv(removeEnv(cmd.Env, "TRACEPARENT", "TRACESTATE"), traceContextEnv(ctx))
+	}
+
+	return cmd
+}
+
+// defaultSubprocessEnv локаль утилит по умолчанию: вывод на английском, чтобы разбор
+// сообщений ("Error:", коды) не зависел от локали контейнера. UTF-8, а не C, чтобы
+// кириллица в именах контейнеров и аргументах передавалась без искажений
+var defaultSubprocessEnv = []string{"LANG=C.UTF-8", "LC_ALL=C.UTF-8"}
+
+// mergeEnv возвращает окружение base, в котором переменные из overrides ("KEY=VALUE")
+// заменяют одноименные переменные base
+func mergeEnv(base []string, overrides []string) []string {
+	keys := make(map[string]bool, len(overrides))
+	for _, kv := range overrides {
+		key, _, _ := strings.Cut(kv, "=")
+		keys[key] = true
+	}
+
+	env := make([]string, 0, len(base)+len(overrides))
+	for _, kv := range base {
+		key, _, _ := strings.Cut(kv, "=")
+		if !keys[key] {
+			env = append(env, kv)
+		}
+	}
+	return append(env, overrides...)
+}
+
+// removeEnv возвращает окружение env без переменных с именами keys
+func removeEnv(env []string, keys ...string) []string {
+	filtered := make([]string, 0, len(env))
+	for _, kv := range env {
+		key, _, _ := strings.Cut(kv, "=")
+		if !slices.Contains(keys, key) {
+			filtered = append(filtered, kv)
+		}
+	}
+	return filtered
+}
+
+// traceContextEnv возвращает переменные окружения W3C Trace Context для текущего span
+// в формате "TRACEPARENT=...". Если в контексте нет валидного span, возвращает nil
+func traceContextEnv(ctx context.Context) []string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+
+	var env []string
+	for _, key := range carrier.Keys() {
+		env = append(env, strings.ToUpper(key)+"="+carrier.Get(key))
+	}
+	return env
+}
+
+// runCryptcp выполняет cryptcp в рабочей директории workDir и возвращает вывод утилиты
+func (c *CryptoCLI) runCryptcp(ctx context.Context, workDir string, args ...string) (string, string, error) {
+	cmd := c.command(ctx, c.cryptcpPath, args...)
+	cmd.Dir = workDir
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	c.log(ctx).Debug("cryptcp args", "args", maskCommandArgs(args))
+
+	err := c.run(ctx, cmd)
+	return decodeOutput(stdout.Bytes()), decodeOutput(stderr.Bytes()), err
+}
+
+const (
+	defaultCertmgrTimeout = 2 * time.Minute // Таймаут операций certmgr по умолчанию
+	commandWaitDelay      = 5 * time.Second // Ожидание закрытия вывода после завершения процесса
+)
+
+// certmgrContext ограничивает операцию certmgr таймаутом WithCertmgrTimeout, чтобы зависший
+// токен не блокировал вызов с context.Background(). Более ранний срок из ctx сохраняется
+func (c *CryptoCLI) certmgrContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := c.settings().CertmgrTimeout
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// runCertmgr выполняет certmgr и возвращает вывод утилиты
+func (c *CryptoCLI) runCertmgr(ctx context.Context, args ...string) (string, string, error) {
+	ctx, cancel := c.certmgrContext(ctx)
+	defer cancel()
+
+	cmd := c.command(ctx, c.certmgrPath, args...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := c.certmgrRun(ctx, cmd)
+	return decodeOutput(stdout.Bytes()), decodeOutput(stderr.Bytes()), err
+}
+
+// certmgrRun выполняет команду, ограниченную certmgrContext. Если процесс остановлен по сроку
+// ctx, ошибка оборачивает context.DeadlineExceeded (или context.Canceled при отмене)
+func (c *CryptoCLI) certmgrRun(ctx context.Context, cmd *exec.Cmd) error {
+	err := c.run(ctx, cmd)
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("%s stopped: %w (%v)", filepath.Base(cmd.Path), ctx.Err(), err)
+	}
+	return err
+}
@@ -0,0 +1,163 @@
+package cprovlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TestHelperProcess не тест: процесс, который запускают тесты вместо утилит КриптоПро
+// (os.Args[0] -test.run=TestHelperProcess -- <режим>)
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "helper process: no mode")
+		os.Exit(2)
+	}
+
+	switch args[1] {
+	case "readstdin":
+		// Как cryptcp с "Press any key": ждет ввода и завершается, только получив EOF
+		_, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	default:
+		fmt.Fprintf(os.Stderr, "helper process: unknown mode %q\n", args[1])
+		os.Exit(2)
+	}
+}
+
+func TestCommandStdinEOF(t *testing.T) {
+	t.Setenv("GO_WANT_HELPER_PROCESS", "1")
+	c := New("uMy", nil, 0, &DefaultLogger{}, false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cmd := c.command(ctx, os.Args[0], "-test.run=TestHelperProcess", "--", "readstdin")
+	startedAt := time.Now()
+	err := c.run(ctx, cmd)
+	if err != nil {
+		t.Fatalf("process reading stdin failed: %v", err)
+	}
+	if elapsed := time.Since(startedAt); elapsed > 5*time.Second {
+		t.Fatalf("process reading stdin exited after %s, expected immediate EOF", elapsed)
+	}
+}
+
+func TestCertmgrTimeoutKillsHungProcess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake certmgr is a shell script")
+	}
+
+	// Зависший на токене certmgr: exec, чтобы по таймауту завершался сам процесс sleep
+	certmgrPath := filepath.Join(t.TempDir(), "certmgr")
+	err := os.WriteFile(certmgrPath, []byte("#!/bin/sh\nexec sleep 60\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := New("uMy", nil, 0, &DefaultLogger{}, false, WithCertmgrTimeout(200*time.Millisecond))
+	c.certmgrPath = certmgrPath
+
+	startedAt := time.Now()
+	err = c.DeleteCertificate(context.Background(), "0123456789abcdef0123456789abcdef01234567")
+	elapsed := time.Since(startedAt)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if !errors.Is(err, ErrCertificateDeletion) {
+		t.Fatalf("expected ErrCertificateDeletion, got %v", err)
+	}
+	if elapsed > 5*time.Second {
+		t.Fatalf("hung certmgr stopped after %s, timeout is 200ms", elapsed)
+	}
+}
+
+func TestCommandTraceparentReplacesInherited(t *testing.T) {
+	t.Setenv("TRACEPARENT", "00-11111111111111111111111111111111-1111111111111111-01")
+	t.Setenv("TRACESTATE", "inherited=1")
+
+	traceID, _ := trace.TraceIDFromHex("0af7651916cd43dd8448eb211c80319c")
+	spanID, _ := trace.SpanIDFromHex("b7ad6b7169203331")
+	spanCtx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	tests := []struct {
+		name            string
+		ctx             context.Context
+		opts            []Option
+		wantTraceparent []string
+		wantTracestate  []string
+	}{
+		{
+			name:            "current span",
+			ctx:             spanCtx,
+			opts:            []Option{WithTraceContextEnv(true)},
+			wantTraceparent: []string{"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
+		},
+		{
+			// Без span унаследованный TRACEPARENT не передается: он относится к чужой трассе
+			name: "no span",
+			ctx:  context.Background(),
+			opts: []Option{WithTraceContextEnv(true)},
+		},
+		{
+			name:            "disabled",
+			ctx:             spanCtx,
+			wantTraceparent: []string{"00-11111111111111111111111111111111-1111111111111111-01"},
+			wantTracestate:  []string{"inherited=1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New("uMy", nil, 0, &DefaultLogger{}, false, tt.opts...)
+			cmd := c.command(tt.ctx, "cryptcp")
+			env := cmd.Env
+			if env == nil {
+				env = os.Environ()
+			}
+
+			var traceparents, tracestates []string
+			for _, kv := range env {
+				if value, ok := strings.CutPrefix(kv, "TRACEPARENT="); ok {
+					traceparents = append(traceparents, value)
+				}
+				if value, ok := strings.CutPrefix(kv, "TRACESTATE="); ok {
+					tracestates = append(tracestates, value)
+				}
+			}
+			if !slices.Equal(traceparents, tt.wantTraceparent) {
+				t.Errorf("TRACEPARENT values %v, want %v", traceparents, tt.wantTraceparent)
+			}
+			if !slices.Equal(tracestates, tt.wantTracestate) {
+				t.Errorf("TRACESTATE values %v, want %v", tracestates, tt.wantTracestate)
+			}
+		})
+	}
+}
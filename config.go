@@ -0,0 +1,256 @@
+package cprovlib
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Config полные настройки клиента для NewFromConfig, например загруженные из YAML или
+// переменных окружения. Нулевое значение поля означает значение по умолчанию, как без
+// соответствующей опции New. Длительности в YAML задаются строкой ("30s"), в JSON - в наносекундах
+type Config struct {
+	Store               string      `json:"store" yaml:"store"`                             // Хранилище сертификатов, например "uMy"
+	TSPServers          []TSPServer `json:"tspServers" yaml:"tspServers"`                   // Службы временных меток, пустой список - DefaultTSPServers
+	SignType            uint        `json:"signType" yaml:"signType"`                       // 0 = CAdES-BES, 1 = CAdES-T, 2 = CAdES-X Long Type 1
+	SkipChainValidation bool        `json:"skipChainValidation" yaml:"skipChainValidation"` // Флаги -nochain -norev
+
+	CryptcpPath  string `json:"cryptcpPath" yaml:"cryptcpPath"`   // По умолчанию /opt/cprocsp/bin/amd64/cryptcp
+	CertmgrPath  string `json:"certmgrPath" yaml:"certmgrPath"`   // По умолчанию /opt/cprocsp/bin/amd64/certmgr
+	CsptestPath  string `json:"csptestPath" yaml:"csptestPath"`   // По умолчанию /opt/cprocsp/bin/amd64/csptest
+	CpconfigPath string `json:"cpconfigPath" yaml:"cpconfigPath"` // По умолчанию /opt/cprocsp/sbin/amd64/cpconfig
+
+	TmpDir        string `json:"tmpDir" yaml:"tmpDir"`               // WithTmpDir, по умолчанию /tmp
+	SignTmpDir    string `json:"signTmpDir" yaml:"signTmpDir"`       // WithSignTmpDir
+	InstallTmpDir string `json:"installTmpDir" yaml:"installTmpDir"` // WithInstallTmpDir
+	RequireTmpfs  bool   `json:"requireTmpfs" yaml:"requireTmpfs"`   // WithRequireTmpfs
+
+	SignTimeout         time.Duration  `json:"signTimeout" yaml:"signTimeout"`                 // Время одной подписи со всеми повторами, по умолчанию 5 минут
+	AttemptTimeout      time.Duration  `json:"attemptTimeout" yaml:"attemptTimeout"`           // WithAttemptTimeout
+	CertmgrTimeout      *time.Duration `json:"certmgrTimeout" yaml:"certmgrTimeout"`           // WithCertmgrTimeout, nil - 2 минуты, 0 - без таймаута
+	StartupTimeout      time.Duration  `json:"startupTimeout" yaml:"startupTimeout"`           // WithStartupTimeout
+	RetryUnresponsive   bool           `json:"retryUnresponsive" yaml:"retryUnresponsive"`     // WithStartupTimeout
+	RetryMaxAttempts    int            `json:"retryMaxAttempts" yaml:"retryMaxAttempts"`       // WithRetryPolicy, по умолчанию 3
+	RetryBackoff        time.Duration  `json:"retryBackoff" yaml:"retryBackoff"`               // WithRetryPolicy, по умолчанию 1 секунда
+	TSPFailoverAttempts int            `json:"tspFailoverAttempts" yaml:"tspFailoverAttempts"` // WithRetryBudget
+	TransientAttempts   int            `json:"transientAttempts" yaml:"transientAttempts"`     // WithRetryBudget
+	NoRetry             bool           `json:"noRetry" yaml:"noRetry"`                         // WithNoRetry
+	TSPFallbackToBES    bool           `json:"tspFallbackToBes" yaml:"tspFallbackToBes"`       // WithTSPFallbackToBES
+	TSPRateLimit        float64        `json:"tspRateLimit" yaml:"tspRateLimit"`               // WithTSPRateLimit, запросов в секунду
+	TSPRateBurst        int            `json:"tspRateBurst" yaml:"tspRateBurst"`               // WithTSPRateLimit
+
+	ProviderType      int               `json:"providerType" yaml:"providerType"`           // WithProviderType
+	DefaultAttached   bool              `json:"defaultAttached" yaml:"defaultAttached"`     // WithDefaultAttached
+	IncludeCertChain  bool              `json:"includeCertChain" yaml:"includeCertChain"`   // WithIncludeCertChain
+	EmbedOCSP         bool              `json:"embedOcsp" yaml:"embedOcsp"`                 // WithEmbedOCSP
+	SignAndVerify     bool              `json:"signAndVerify" yaml:"signAndVerify"`         // WithSignAndVerify
+	PreSignCertCheck  bool              `json:"preSignCertCheck" yaml:"preSignCertCheck"`   // WithPreSignCertCheck
+	DocumentDigest    []DigestAlgorithm `json:"documentDigest" yaml:"documentDigest"`       // WithDocumentDigest
+	StrictStderr      bool              `json:"strictStderr" yaml:"strictStderr"`           // WithStrictStderr
+	SuccessMarker     string            `json:"successMarker" yaml:"successMarker"`         // WithSuccessMarker
+	SignatureFileGlob string            `json:"signatureFileGlob" yaml:"signatureFileGlob"` // WithSignatureFileGlob
+	LenientBase64     bool              `json:"lenientBase64" yaml:"lenientBase64"`         // WithLenientBase64
+	KeyLocking        *bool             `json:"keyLocking" yaml:"keyLocking"`               // WithKeyLocking, nil - включено
+	StdoutSignature   *bool             `json:"stdoutSignature" yaml:"stdoutSignature"`     // WithStdoutSignatureFallback, nil - включено
+	RequireCachedPin  bool              `json:"requireCachedPin" yaml:"requireCachedPin"`   // WithRequireCachedPin
+
+	MaxConcurrency    int           `json:"maxConcurrency" yaml:"maxConcurrency"`       // WithMaxConcurrency
+	MaxDocumentSize   int64         `json:"maxDocumentSize" yaml:"maxDocumentSize"`     // WithMaxDocumentSize
+	DiskSpaceHeadroom float64       `json:"diskSpaceHeadroom" yaml:"diskSpaceHeadroom"` // WithDiskSpaceHeadroom, по умолчанию 3, < 0 - без проверки
+	WriteBufferSize   int           `json:"writeBufferSize" yaml:"writeBufferSize"`     // WithWriteBufferSize
+	WorkDirPoolSize   int           `json:"workDirPoolSize" yaml:"workDirPoolSize"`     // WithWorkDirPool
+	AsyncCleanup      time.Duration `json:"asyncCleanup" yaml:"asyncCleanup"`           // WithAsyncCleanup
+	VerifyCacheSize   int           `json:"verifyCacheSize" yaml:"verifyCacheSize"`     // WithVerifyCache
+	VerifyCacheTTL    time.Duration `json:"verifyCacheTtl" yaml:"verifyCacheTtl"`       // WithVerifyCache
+	QualifiedPolicies []string      `json:"qualifiedPolicies" yaml:"qualifiedPolicies"` // WithQualifiedPolicies, пустой список - DefaultQualifiedPolicies
+
+	Niceness        int      `json:"niceness" yaml:"niceness"`               // WithNiceness
+	Cgroup          string   `json:"cgroup" yaml:"cgroup"`                   // WithCgroup
+	SubprocessEnv   []string `json:"subprocessEnv" yaml:"subprocessEnv"`     // WithSubprocessEnv, nil - локаль C.UTF-8
+	TraceContextEnv bool     `json:"traceContextEnv" yaml:"traceContextEnv"` // WithTraceContextEnv
+	LogOutputLimit  int      `json:"logOutputLimit" yaml:"logOutputLimit"`   // WithLogOutputLimit, по умолчанию 4 КБ, < 0 - без ограничения
+	FakeBackend     bool     `json:"fakeBackend" yaml:"fakeBackend"`         // WithFakeBackend, только для разработки и только с CPROVLIB_FAKE_BACKEND=1
+
+	// Logger получатель логов, nil - NewDefaultLogger
+	Logger Logger `json:"-" yaml:"-"`
+	// Options опции, которые нельзя задать данными (WithFileSystem, WithCommandObserver,
+	// WithTimeSource и т.п.). Применяются после полей Config
+	Options []Option `json:"-" yaml:"-"`
+}
+
+// NewFromConfig создает клиент по Config, предварительно проверяя настройки: задано хранилище,
+// пути утилит абсолютные и указывают на файлы (кроме FakeBackend), временные директории
+// существуют, тип подписи известен, адреса TSP - URL http или https (ErrInvalidTSPURL).
+// FakeBackend допускается, только если в окружении задано CPROVLIB_FAKE_BACKEND=1: флаг,
+// попавший в конфигурацию по ошибке, не подменяет проверку подписей фиктивной.
+// Все найденные ошибки возвращаются вместе, обернутыми в ErrInvalidConfig
+func NewFromConfig(cfg Config) (*CryptoCLI, error) {
+	err := cfg.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	c := New(cfg.Store, nil, cfg.SignType, cfg.Logger, cfg.SkipChainValidation, cfg.options()...)
+
+	c.cryptcpPath = cmp.Or(cfg.CryptcpPath, c.cryptcpPath)
+	c.certmgrPath = cmp.Or(cfg.CertmgrPath, c.certmgrPath)
+	c.csptestPath = cmp.Or(cfg.CsptestPath, c.csptestPath)
+	c.cpconfigPath = cmp.Or(cfg.CpconfigPath, c.cpconfigPath)
+
+	return c, nil
+}
+
+// options переводит поля Config в опции New
+func (cfg *Config) options() []Option {
+	opts := []Option{
+		WithTmpDir(cmp.Or(cfg.TmpDir, "/tmp")),
+		WithSignTmpDir(cfg.SignTmpDir),
+		WithInstallTmpDir(cfg.InstallTmpDir),
+		WithRequireTmpfs(cfg.RequireTmpfs),
+		WithStartupTimeout(cfg.StartupTimeout, cfg.RetryUnresponsive),
+		WithAttemptTimeout(cfg.AttemptTimeout),
+		WithTSPFallbackToBES(cfg.TSPFallbackToBES),
+		WithTSPRateLimit(cfg.TSPRateLimit, cfg.TSPRateBurst),
+		WithProviderType(cfg.ProviderType),
+		WithDefaultAttached(cfg.DefaultAttached),
+		WithIncludeCertChain(cfg.IncludeCertChain),
+		WithEmbedOCSP(cfg.EmbedOCSP),
+		WithSignAndVerify(cfg.SignAndVerify),
+		WithPreSignCertCheck(cfg.PreSignCertCheck),
+		WithDocumentDigest(cfg.DocumentDigest...),
+		WithRequireCachedPin(cfg.RequireCachedPin),
+		WithStrictStderr(cfg.StrictStderr),
+		WithSuccessMarker(cfg.SuccessMarker),
+		WithSignatureFileGlob(cfg.SignatureFileGlob),
+		WithLenientBase64(cfg.LenientBase64),
+		WithMaxConcurrency(cfg.MaxConcurrency),
+		WithMaxDocumentSize(cfg.MaxDocumentSize),
+		WithWriteBufferSize(cmp.Or(cfg.WriteBufferSize, defaultWriteBufferSize)),
+		WithWorkDirPool(cfg.WorkDirPoolSize),
+		WithAsyncCleanup(cfg.AsyncCleanup),
+		WithVerifyCache(cfg.VerifyCacheSize, cfg.VerifyCacheTTL),
+		WithQualifiedPolicies(cfg.QualifiedPolicies...),
+		WithNiceness(cfg.Niceness),
+		WithCgroup(cfg.Cgroup),
+		WithTraceContextEnv(cfg.TraceContextEnv),
+		WithRetryPolicy(cmp.Or(cfg.RetryMaxAttempts, 3), cmp.Or(cfg.RetryBackoff, time.Second)),
+		WithDiskSpaceHeadroom(cmp.Or(cfg.DiskSpaceHeadroom, defaultDiskSpaceHeadroom)),
+		WithLogOutputLimit(cmp.Or(cfg.LogOutputLimit, defaultLogOutputLimit)),
+	}
+
+	if len(cfg.TSPServers) > 0 {
+		opts = append(opts, WithTSPServers(cfg.TSPServers...))
+	}
+	if cfg.SignTimeout > 0 {
+		opts = append(opts, func(c *CryptoCLI) {
+			c.settings().SignTimeout = cfg.SignTimeout
+		})
+	}
+	if cfg.CertmgrTimeout != nil {
+		opts = append(opts, WithCertmgrTimeout(*cfg.CertmgrTimeout))
+	}
+	if cfg.TSPFailoverAttempts > 0 || cfg.TransientAttempts > 0 {
+		opts = append(opts, WithRetryBudget(cfg.TSPFailoverAttempts, cfg.TransientAttempts))
+	}
+	if cfg.NoRetry {
+		opts = append(opts, WithNoRetry())
+	}
+	if cfg.KeyLocking != nil {
+		opts = append(opts, WithKeyLocking(*cfg.KeyLocking))
+	}
+	if cfg.StdoutSignature != nil {
+		opts = append(opts, WithStdoutSignatureFallback(*cfg.StdoutSignature))
+	}
+	if cfg.SubprocessEnv != nil {
+		opts = append(opts, WithSubprocessEnv(cfg.SubprocessEnv...))
+	}
+	if cfg.FakeBackend {
+		opts = append(opts, WithFakeBackend())
+	}
+
+	return append(opts, cfg.Options...)
+}
+
+// validate проверяет Config и возвращает все найденные ошибки
+func (cfg *Config) validate() error {
+	var problems []error
+
+	if strings.TrimSpace(cfg.Store) == "" {
+		problems = append(problems, errors.New("store is empty"))
+	}
+	if cfg.SignType > SignTypeXLongType1 {
+		problems = append(problems, fmt.Errorf("unknown sign type %d", cfg.SignType))
+	}
+
+	if cfg.FakeBackend && !fakeBackendAllowed() {
+		problems = append(problems, fmt.Errorf("fakeBackend requires %s=1 in the environment", fakeBackendEnv))
+	}
+
+	_, err := normalizeTSPServers(cfg.TSPServers)
+	if err != nil {
+		problems = append(problems, err)
+	}
+
+	for _, field := range [][2]string{
+		{"cryptcpPath", cfg.CryptcpPath},
+		{"certmgrPath", cfg.CertmgrPath},
+		{"csptestPath", cfg.CsptestPath},
+		{"cpconfigPath", cfg.CpconfigPath},
+	} {
+		name, path := field[0], field[1]
+		if path == "" {
+			continue
+		}
+		if !filepath.IsAbs(path) {
+			problems = append(problems, fmt.Errorf("%s %q is not an absolute path", name, path))
+			continue
+		}
+		if cfg.FakeBackend && fakeBackendAllowed() {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s: %v", name, err))
+		} else if info.IsDir() {
+			problems = append(problems, fmt.Errorf("%s %q is a directory", name, path))
+		}
+	}
+
+	for _, field := range [][2]string{
+		{"tmpDir", cfg.TmpDir},
+		{"signTmpDir", cfg.SignTmpDir},
+		{"installTmpDir", cfg.InstallTmpDir},
+		{"cgroup", cfg.Cgroup},
+	} {
+		name, dir := field[0], field[1]
+		if dir == "" {
+			continue
+		}
+		info, err := os.Stat(dir)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s: %v", name, err))
+		} else if !info.IsDir() {
+			problems = append(problems, fmt.Errorf("%s %q is not a directory", name, dir))
+		}
+	}
+
+	if cfg.SignTimeout < 0 || cfg.AttemptTimeout < 0 || cfg.RetryBackoff < 0 || cfg.StartupTimeout < 0 ||
+		cfg.VerifyCacheTTL < 0 || (cfg.CertmgrTimeout != nil && *cfg.CertmgrTimeout < 0) {
+		problems = append(problems, errors.New("negative duration"))
+	}
+	if cfg.RetryMaxAttempts < 0 || cfg.TSPFailoverAttempts < 0 || cfg.TransientAttempts < 0 {
+		problems = append(problems, errors.New("negative retry attempts"))
+	}
+	if cfg.Niceness < -20 || cfg.Niceness > 19 {
+		problems = append(problems, fmt.Errorf("niceness %d is out of range -20..19", cfg.Niceness))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, errors.Join(problems...))
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package cprovlib
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+)
+
+// ListContainers возвращает полные имена (FQCN) ключевых контейнеров, доступных CSP,
+// например "\\.\HDIMAGE\test"
+func (c *CryptoCLI) ListContainers(ctx context.Context) ([]string, error) {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "ListContainers")
+	defer span.End()
+
+	cmd := c.command(ctx, c.csptestPath,
+		"-keyset",
+		"-enum_cont",
+		"-fqcn",
+		"-verifyc",
+	)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := c.run(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("csptest enum containers: %v, stderr: %s", err, decodeOutput(stderr.Bytes()))
+	}
+
+	// Имена контейнеров выводятся отдельными строками вида \\.\READER\name,
+	// остальные строки - служебная информация csptest
+	var containers []string
+	for _, line := range strings.Split(decodeOutput(stdout.Bytes()), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, `\\.\`) {
+			containers = append(containers, line)
+		}
+	}
+
+	return containers, nil
+}
+
+// findContainer ищет контейнер по полному (FQCN) или короткому имени.
+// Возвращает FQCN найденного контейнера или пустую строку, если контейнер не найден
+func (c *CryptoCLI) findContainer(ctx context.Context, name string) (string, error) {
+	containers, err := c.ListContainers(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	for _, fqcn := range containers {
+		if strings.EqualFold(fqcn, name) || strings.EqualFold(containerShortName(fqcn), name) {
+			return fqcn, nil
+		}
+	}
+
+	return "", nil
+}
+
+// deleteContainer удаляет ключевой контейнер через csptest с таймаутом WithCertmgrTimeout
+func (c *CryptoCLI) deleteContainer(ctx context.Context, container string) error {
+	ctx, cancel := c.certmgrContext(ctx)
+	defer cancel()
+
+	cmd := c.command(ctx, c.csptestPath,
+		"-keyset",
+		"-deletekeyset",
+		"-container", container,
+	)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := c.certmgrRun(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("csptest delete container %s: %w, stderr: %s", container, err, decodeOutput(stderr.Bytes()))
+	}
+
+	return nil
+}
+
+// copyContainer копирует ключ контейнера source в новый контейнер destination через csptest
+// с таймаутом WithCertmgrTimeout. PIN нового контейнера совпадает с PIN исходного
+func (c *CryptoCLI) copyContainer(ctx context.Context, source string, destination string, pin string) error {
+	ctx, cancel := c.certmgrContext(ctx)
+	defer cancel()
+
+	cmd := c.command(ctx, c.csptestPath,
+		"-keycopy",
+		"-contsrc", source,
+		"-contdest", destination,
+		"-pinsrc", pin,
+		"-pindest", pin,
+	)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := c.certmgrRun(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("csptest copy container %s to %s: %w, stderr: %s", source, destination, err, decodeOutput(stderr.Bytes()))
+	}
+
+	return nil
+}
+
+// containerShortName возвращает имя контейнера без префикса считывателя:
+// "\\.\HDIMAGE\test" -> "test"
+func containerShortName(fqcn string) string {
+	trimmed := strings.TrimPrefix(fqcn, `\\.\`)
+	if idx := strings.Index(trimmed, `\`); idx >= 0 {
+		return trimmed[idx+1:]
+	}
+	return trimmed
+}
+
+// containerReader возвращает имя считывателя из полного имени контейнера (FQCN)
+func containerReader(fqcn string) string {
+	trimmed := strings.TrimPrefix(fqcn, `\\.\`)
+	if idx := strings.Index(trimmed, `\`); idx >= 0 {
+		return trimmed[:idx]
+	}
+	return ""
+}
+
+// ReaderInfo считыватель ключевых носителей (токен, смарт-карта, HDIMAGE) и контейнеры на нем
+type ReaderInfo struct {
+	Name           string   `json:"name"`               // Имя считывателя, как в FQCN контейнеров
+	Nickname       string   `json:"nickname,omitempty"` // Короткое имя считывателя из csptest
+	Containers     []string `json:"containers"`         // Полные имена (FQCN) контейнеров на носителе
+	ContainerCount int      `json:"containerCount"`     // Количество контейнеров, 0 - носитель пуст или не вставлен
+}
+
+// ListReaders возвращает считыватели, известные CSP (csptest -enum -info -type PP_ENUMREADERS),
+// и контейнеры на вставленных в них носителях (ListContainers). Позволяет убедиться, что токен
+// подключен и содержит ключ, до разбора ошибок подписи. Считыватели, которых нет в списке
+// CSP, но на которых найдены контейнеры, также возвращаются
+func (c *CryptoCLI) ListReaders(ctx context.Context) ([]ReaderInfo, error) {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "ListReaders")
+	defer span.End()
+
+	cmd := c.command(ctx, c.csptestPath,
+		"-enum",
+		"-info",
+		"-type", "PP_ENUMREADERS",
+	)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := c.run(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("csptest enum readers: %v, stderr: %s", err, decodeOutput(stderr.Bytes()))
+	}
+
+	readers := parseReaders(decodeOutput(stdout.Bytes()))
+
+	containers, err := c.ListContainers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fqcn := range containers {
+		name := containerReader(fqcn)
+		i := slices.IndexFunc(readers, func(r ReaderInfo) bool {
+			return strings.EqualFold(r.Name, name) || r.Nickname != "" && strings.EqualFold(r.Nickname, name)
+		})
+		if i < 0 {
+			readers = append(readers, ReaderInfo{Name: name})
+			i = len(readers) - 1
+		}
+		readers[i].Containers = append(readers[i].Containers, fqcn)
+		readers[i].ContainerCount++
+	}
+
+	c.log(ctx).Debug("readers listed",
+		"readers", len(readers),
+		"containers", len(containers))
+
+	return readers, nil
+}
+
+// parseReaders разбирает таблицу считывателей csptest: строки вида "Имя | Короткое имя | Флаги".
+// Заголовок, разделители и служебные строки пропускаются
+func parseReaders(output string) []ReaderInfo {
+	var readers []ReaderInfo
+	for _, line := range strings.Split(output, "\n") {
+		columns := strings.Split(line, "|")
+		if len(columns) < 2 {
+			continue
+		}
+		name := strings.TrimSpace(columns[0])
+		nickname := strings.TrimSpace(columns[1])
+		if name == "" || strings.Trim(name, "-") == "" || strings.EqualFold(name, "name") || strings.EqualFold(nickname, "nickname") {
+			continue
+		}
+		readers = append(readers, ReaderInfo{Name: name, Nickname: nickname, Containers: []string{}})
+	}
+	return readers
+}
@@ -0,0 +1,87 @@
+package cprovlib
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+)
+
+var (
+	ErrSignatureConversion = errors.New("ошибка преобразования подписи")
+)
+
+// ToAttached преобразует отсоединенную подпись в присоединенную, помещая данные внутрь PKCS#7.
+//
+// cryptcp не умеет менять тип подписи без повторного подписания, поэтому преобразование
+// выполняется на уровне структуры CMS: SignerInfo (значение подписи, подписанные атрибуты
+// и штамп времени CAdES-T) не изменяется и остается действительным.
+// Соответствие данных подписи при этом не проверяется.
+func (c *CryptoCLI) ToAttached(ctx context.Context, detachedSigBase64 string, dataBase64 string) (string, error) {
+
+	_, span := otel.Tracer("internal/cprovlib").Start(ctx, "ToAttached")
+	defer span.End()
+
+	sigData, err := c.decodeBase64(detachedSigBase64)
+	if err != nil {
+		return "", fmt.Errorf("%w: signature base64 decode: %v", ErrSignatureConversion, err)
+	}
+
+	data, err := c.decodeBase64(dataBase64)
+	if err != nil {
+		return "", fmt.Errorf("%w: data base64 decode: %v", ErrSignatureConversion, err)
+	}
+
+	sd, err := parseSignedData(sigData)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrSignatureConversion, err)
+	}
+	if sd.eContent != nil {
+		return "", fmt.Errorf("%w: signature is already attached", ErrSignatureConversion)
+	}
+
+	// Пустые данные кодируются как пустой OCTET STRING, а не отсутствие содержимого
+	sd.eContent = data
+	if sd.eContent == nil {
+		sd.eContent = []byte{}
+	}
+
+	der, err := sd.marshal()
+	if err != nil {
+		return "", fmt.Errorf("%w: encode: %v", ErrSignatureConversion, err)
+	}
+
+	return base64.StdEncoding.EncodeToString(der), nil
+}
+
+// ToDetached преобразует присоединенную подпись в отсоединенную, удаляя данные из PKCS#7.
+// Как и ToAttached, не выполняет повторного подписания: подпись и штамп времени сохраняются
+func (c *CryptoCLI) ToDetached(ctx context.Context, attachedSigBase64 string) (string, error) {
+
+	_, span := otel.Tracer("internal/cprovlib").Start(ctx, "ToDetached")
+	defer span.End()
+
+	sigData, err := c.decodeBase64(attachedSigBase64)
+	if err != nil {
+		return "", fmt.Errorf("%w: signature base64 decode: %v", ErrSignatureConversion, err)
+	}
+
+	sd, err := parseSignedData(sigData)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrSignatureConversion, err)
+	}
+	if sd.eContent == nil {
+		return "", fmt.Errorf("%w: signature is already detached", ErrSignatureConversion)
+	}
+
+	sd.eContent = nil
+
+	der, err := sd.marshal()
+	if err != nil {
+		return "", fmt.Errorf("%w: encode: %v", ErrSignatureConversion, err)
+	}
+
+	return base64.StdEncoding.EncodeToString(der), nil
+}
@@ -0,0 +1,127 @@
+package cprovlib
+
+import (
+	"bytes"
+	"context"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+// testDetachedCMS собирает отсоединенную подпись с сертификатом ca и одним SignerInfo
+func testDetachedCMS(t *testing.T, ca *testCA) []byte {
+	t.Helper()
+	der, err := certSignatureCMS([]byte("signature value"), ca.cert,
+		asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1},
+		asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	detached := testDetachedCMS(t, ca)
+	original, err := parseSignedData(detached)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "data", data: []byte("document content")},
+		{name: "empty data", data: []byte{}},
+		{name: "large data", data: bytes.Repeat([]byte{0xab}, 70000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New("uMy", nil, 0, &DefaultLogger{}, false)
+			ctx := context.Background()
+
+			attachedBase64, err := c.ToAttached(ctx, base64.StdEncoding.EncodeToString(detached), base64.StdEncoding.EncodeToString(tt.data))
+			if err != nil {
+				t.Fatalf("ToAttached: %v", err)
+			}
+			attached, err := base64.StdEncoding.DecodeString(attachedBase64)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sd, err := parseSignedData(attached)
+			if err != nil {
+				t.Fatalf("parse attached: %v", err)
+			}
+			if sd.eContent == nil || !bytes.Equal(sd.eContent, tt.data) {
+				t.Fatalf("attached content %d bytes, want %d", len(sd.eContent), len(tt.data))
+			}
+			// SignerInfo и сертификаты переносятся без изменений
+			if !bytes.Equal(sd.signerInfos.FullBytes, original.signerInfos.FullBytes) {
+				t.Error("signer infos changed")
+			}
+			if len(sd.certificatesDER()) != 1 || !bytes.Equal(sd.certificatesDER()[0], ca.cert.Raw) {
+				t.Error("certificates changed")
+			}
+			if cert, err := sd.signerCertificate(&mustSigners(t, sd)[0]); err != nil || !cert.Equal(ca.cert) {
+				t.Errorf("signer certificate %v, %v", cert, err)
+			}
+
+			detachedBase64, err := c.ToDetached(ctx, attachedBase64)
+			if err != nil {
+				t.Fatalf("ToDetached: %v", err)
+			}
+			if detachedBase64 != base64.StdEncoding.EncodeToString(detached) {
+				t.Fatal("ToDetached(ToAttached(signature)) differs from the original signature")
+			}
+		})
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	detached := base64.StdEncoding.EncodeToString(testDetachedCMS(t, ca))
+	data := base64.StdEncoding.EncodeToString([]byte("document"))
+	c := New("uMy", nil, 0, &DefaultLogger{}, false)
+	ctx := context.Background()
+
+	attached, err := c.ToAttached(ctx, detached, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		convert func() (string, error)
+	}{
+		{name: "attach attached", convert: func() (string, error) { return c.ToAttached(ctx, attached, data) }},
+		{name: "detach detached", convert: func() (string, error) { return c.ToDetached(ctx, detached) }},
+		{name: "invalid signature base64", convert: func() (string, error) { return c.ToAttached(ctx, "not base64!", data) }},
+		{name: "invalid data base64", convert: func() (string, error) { return c.ToAttached(ctx, detached, "not base64!") }},
+		{name: "not CMS", convert: func() (string, error) {
+			return c.ToDetached(ctx, base64.StdEncoding.EncodeToString(ca.cert.Raw))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.convert()
+			if !errors.Is(err, ErrSignatureConversion) {
+				t.Fatalf("error %v, want ErrSignatureConversion", err)
+			}
+		})
+	}
+}
+
+// mustSigners возвращает SignerInfo подписи sd
+func mustSigners(t *testing.T, sd *cmsSignedData) []cmsSignerInfo {
+	t.Helper()
+	signers, err := sd.signers()
+	if err != nil || len(signers) == 0 {
+		t.Fatalf("signers: %v, %v", signers, err)
+	}
+	return signers
+}
@@ -3,13 +3,18 @@ package cprovlib
 import (
 	"bytes"
 	"context"
+	"crypto/x509"
+	"encoding/asn1"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"math/rand"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.opentelemetry.io/otel"
@@ -18,7 +23,10 @@ import (
 var (
 	ErrCertificateInstallation = errors.New("ошибка установки сертификата")
 	ErrCertificateDeletion     = errors.New("ошибка удаления сертификата")
+	ErrContainerExists         = errors.New("контейнер уже существует")
 	ErrSignature               = errors.New("ошибка подписи")
+	ErrSignTimeout             = errors.New("превышено время ожидания подписи")
+	ErrDocumentTooLarge        = errors.New("размер документа превышает допустимый")
 	DefaultTSPServers          = []string{
 		"http://qs.cryptopro.ru/tsp/tsp.srf",
 		"http://pki.tax.gov.ru/tsp/tsp.srf",
@@ -26,20 +34,72 @@ var (
 	}
 )
 
+// Типы подписи CAdES
+const (
+	SignTypeBES        uint = 0 // CAdES-BES (базовая подпись)
+	SignTypeT          uint = 1 // CAdES-T (с временной меткой)
+	SignTypeXLongType1 uint = 2 // CAdES-X Long Type 1 (с временной меткой и доказательствами проверки статуса)
+)
+
 // CryptoCLI представляет обертку для работы с CLI утилитами КриптоПро
 type CryptoCLI struct {
-	store               string   // Хранилище сертификатов (например, "uMy")
-	tspURL              string   // URL службы временных меток (TSP) - устаревшее, используйте tspServers
-	tspServers          []string // Список URL служб временных меток (TSP)
-	signType            uint     // Тип подписи: 0 = CAdES-BES, 1 = CAdES-T
-	skipChainValidation bool     // Отключить проверку цепочки и отзыва сертификатов (флаги -nochain -norev)
-	certmgrPath         string   // Путь к утилите certmgr
-	cryptcpPath         string   // Путь к утилите cryptcp
-	tmpDir              string   // Временная директория
-	logger              Logger   // Логгер для вывода сообщений
-}
-
-func New(store string, tspServers []string, signType uint, logger Logger, skipChainValidation bool) *CryptoCLI {
+	store             string                        // Хранилище сертификатов (например, "uMy")
+	legacyTSPURL      string                        // Адрес из устаревшего WithTSPURL, добавляется в tspServers в New
+	config            atomic.Pointer[RuntimeConfig] // Настройки, изменяемые Reconfigure во время работы
+	certmgrPath       string                        // Путь к утилите certmgr
+	cryptcpPath       string                        // Путь к утилите cryptcp
+	csptestPath       string                        // Путь к утилите csptest
+	cpconfigPath      string                        // Путь к утилите cpconfig
+	tmpDir            string                        // Временная директория
+	signTmpDir        string                        // Временная директория подписи, пусто - tmpDir
+	installTmpDir     string                        // Временная директория установки сертификатов, пусто - tmpDir
+	logger            Logger                        // Логгер для вывода сообщений
+	logOutputLimit    int                           // Максимальная длина вывода утилит в логах, 0 - без ограничения
+	signatureFileGlob string                        // Шаблон поиска файла подписи в рабочей директории
+	diskSpaceHeadroom float64                       // Запас свободного места в tmpDir относительно размера документа
+	verifyCache       *verifyCache                  // Кэш результатов VerifySignature, nil - без кэша
+	niceness          int                           // Приоритет (nice) процессов утилит, 0 - не менять
+	cgroup            string                        // Директория cgroup для процессов утилит
+	workDirPool       *workDirPool                  // Пул рабочих директорий, nil - директория на каждую операцию
+	strictStderr      bool                          // Считать любой вывод cryptcp в stderr ошибкой подписи
+	lenientBase64     bool                          // Удалять пробелы и заголовки PEM перед декодированием base64
+	includeCertChain  bool                          // Включать в подпись всю цепочку сертификата подписанта
+	embedOCSP         bool                          // Встраивать в подпись ответ OCSP на момент подписи
+	startupTimeout    time.Duration                 // Время до первого вывода утилиты, 0 - без ограничения
+	retryUnresponsive bool                          // Повторять подпись после ErrTokenUnresponsive
+	fileSystem        FileSystem                    // Файловые операции с рабочими директориями
+	writeBufferSize   int                           // Размер буфера потоковой записи документа
+	requireTmpfs      bool                          // Требовать, чтобы tmpDir находился в памяти
+	defaultAttached   bool                          // Форма подписи при attachSignature == nil
+	signSlots         chan struct{}                 // Слоты одновременных подписей, nil - без ограничения
+	keyLocks          *keyLocks                     // Последовательные операции с одним ключом, nil - без блокировки
+	providerType      int                           // Тип провайдера для cryptcp -provtype, 0 - по сертификату
+	providerTypes     sync.Map                      // Определенные типы провайдеров по отпечатку сертификата
+	crlLeases         crlLeases                     // Списки отзыва VerifyWithCRLs, установленные на время проверок
+	commandObserver   func(record CommandRecord)    // Получатель сведений о запусках утилит для аудита
+	successMarker     string                        // Строка вывода cryptcp, обязательная для успешной подписи
+	tspValidator      func(tsaCertDER []byte) error // Проверка сертификата TSA штампа времени
+	traceContextEnv   bool                          // Передавать TRACEPARENT в окружение утилит
+	subprocessEnv     []string                      // Переменные окружения утилит ("KEY=VALUE") поверх окружения процесса
+	tspLimiter        *tokenBucket                  // Ограничитель частоты запросов к TSP серверам
+	signAndVerify     bool                          // Проверять подпись сразу после создания
+	tspFallbackToBES  bool                          // Создавать CAdES-BES, если TSP серверы недоступны
+	maxDocumentSize   int64                         // Максимальный размер документа в байтах (0 - без ограничения)
+	cleanupTimeout    time.Duration                 // Таймаут фонового удаления рабочих директорий (0 - удалять синхронно)
+	cleanupWG         sync.WaitGroup                // Незавершенные фоновые удаления
+	operationsWG      sync.WaitGroup                // Операции, владеющие рабочей директорией (до removeWorkDir)
+	timeSource        func() time.Time              // Доверенный источник времени (например, синхронизированный по NTP)
+	fakeBackend       bool                          // Фиктивные подписи без КриптоПро для локальной разработки (WithFakeBackend)
+	fakeRefused       bool                          // WithFakeBackend отклонена: не задано CPROVLIB_FAKE_BACKEND=1
+	preSignCertCheck  bool                          // Проверять наличие и срок действия сертификата до подписи
+	documentDigest    []DigestAlgorithm             // Алгоритмы хэша документа для SignResult и лога (WithDocumentDigest)
+	stdoutSignature   bool                          // Читать подпись из stdout cryptcp, если файл не создан
+	requireCachedPin  bool                          // Подписывать без -pin, PIN из кэша CSP (WithRequireCachedPin)
+	qualifiedPolicies []string                      // Политики квалифицированного сертификата для VerifyQualified
+	stats             stats                         // Счетчики операций
+}
+
+func New(store string, tspServers []string, signType uint, logger Logger, skipChainValidation bool, opts ...Option) *CryptoCLI {
 	if logger == nil {
 		logger = NewDefaultLogger()
 	}
@@ -48,149 +108,786 @@ func New(store string, tspServers []string, signType uint, logger Logger, skipCh
 		tspServers = DefaultTSPServers
 	}
 
-	return &CryptoCLI{
-		store:               store,
-		tspURL:              "",
-		tspServers:          tspServers,
-		signType:            signType,
-		skipChainValidation: skipChainValidation,
-		certmgrPath:         "/opt/cprocsp/bin/amd64/certmgr",
-		cryptcpPath:         "/opt/cprocsp/bin/amd64/cryptcp",
-		tmpDir:              "/tmp",
-		logger:              logger,
+	c := &CryptoCLI{
+		store:             store,
+		certmgrPath:       "/opt/cprocsp/bin/amd64/certmgr",
+		cryptcpPath:       "/opt/cprocsp/bin/amd64/cryptcp",
+		csptestPath:       "/opt/cprocsp/bin/amd64/csptest",
+		cpconfigPath:      "/opt/cprocsp/sbin/amd64/cpconfig",
+		tmpDir:            "/tmp",
+		fileSystem:        osFileSystem{},
+		writeBufferSize:   defaultWriteBufferSize,
+		logger:            logger,
+		logOutputLimit:    defaultLogOutputLimit,
+		diskSpaceHeadroom: defaultDiskSpaceHeadroom,
+		keyLocks:          newKeyLocks(),
+		subprocessEnv:     defaultSubprocessEnv,
+		stdoutSignature:   true,
+	}
+
+	c.config.Store(&RuntimeConfig{
+		TSPServers:          tspServersFromURLs(tspServers),
+		SignType:            signType,
+		SkipChainValidation: skipChainValidation,
+		SignTimeout:         defaultSignTimeout,
+		CertmgrTimeout:      defaultCertmgrTimeout,
+		RetryMaxAttempts:    3,
+		RetryBackoff:        time.Second,
+	})
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.legacyTSPURL != "" {
+		config := c.settings()
+		config.TSPServers = mergeLegacyTSPURL(config.TSPServers, c.legacyTSPURL)
+		c.logger.Warn("WithTSPURL is deprecated, use the tspServers argument of New or WithTSPServers",
+			"tspURL", maskTSPURL(c.legacyTSPURL))
+	}
+
+	// Некорректный адрес TSP иначе обнаружился бы только при первой подписи CAdES-T:
+	// такие адреса отбрасываются, а ошибка возвращается ConfigError и HealthCheck
+	config := c.settings()
+	config.TSPServers, config.invalidTSP = validTSPServers(config.TSPServers)
+	if config.invalidTSP != nil {
+		c.logger.Error("invalid TSP server URLs dropped",
+			"tspServersCount", len(config.TSPServers),
+			"error", config.invalidTSP)
+	}
+
+	if c.fakeBackend {
+		c.logger.Error("FAKE BACKEND ENABLED: signatures are not real, CryptoPro is not used. Never enable in production")
+	}
+	if c.fakeRefused {
+		c.logger.Error("WithFakeBackend refused, CryptoPro is used: set " + fakeBackendEnv + "=1 to enable the fake backend")
+	}
+
+	return c
+}
+
+// SignResult результат подписи документа
+type SignResult struct {
+	SignatureBase64 string        `json:"signatureBase64"`         // Подпись в DER, закодированная в base64
+	Thumbprint      string        `json:"thumbprint"`              // SHA1 отпечаток сертификата подписанта
+	SignType        uint          `json:"signType"`                // Фактический тип подписи CAdES
+	Attached        bool          `json:"attached"`                // Присоединенная подпись
+	Mode            SignMode      `json:"mode"`                    // Форма подписи: enveloping (attached) или detached
+	TSPServer       string        `json:"tspServer,omitempty"`     // TSP сервер, выдавший штамп времени (без учетных данных)
+	FallbackToBES   bool          `json:"fallbackToBes"`           // Вместо CAdES-T создана CAdES-BES из-за недоступности TSP
+	Attempts        int           `json:"attempts"`                // Количество запусков cryptcp
+	OCSPResponder   string        `json:"ocspResponder,omitempty"` // Отправитель ответа OCSP, встроенного в подпись (WithEmbedOCSP)
+	SigningTime     time.Time     `json:"signingTime"`             // Время подписи по доверенному источнику (WithTimeSource) или системным часам
+	Duration        time.Duration `json:"duration"`                // Общее время подписи
+	Timings         SignTimings   `json:"timings"`                 // Время по этапам подписи
+	Error           string        `json:"error,omitempty"`         // Ошибка подписи этим подписантом (SignMultiSigner)
+	OperationID     string        `json:"operationId,omitempty"`   // Идентификатор операции (SignWithOperationID или ContextWithCorrelationID)
+
+	// DocumentDigests хэши подписанного документа в hex по алгоритмам WithDocumentDigest
+	DocumentDigests map[DigestAlgorithm]string `json:"documentDigests,omitempty"`
+
+	// SignatureDER подпись в DER, та же, что в SignatureBase64. В JSON не сериализуется,
+	// чтобы не передавать подпись дважды
+	SignatureDER []byte `json:"-"`
+}
+
+// SignTimings приблизительное время этапов подписи. Обращение к TSP выполняется внутри cryptcp,
+// поэтому время сетевого запроса входит в Cryptcp и отдельно не измеряется
+type SignTimings struct {
+	WriteFile  time.Duration `json:"writeFile"`  // Запись документа в рабочую директорию
+	TSPWait    time.Duration `json:"tspWait"`    // Ожидание ограничителя частоты TSP (WithTSPRateLimit)
+	Backoff    time.Duration `json:"backoff"`    // Паузы между повторными попытками
+	Cryptcp    time.Duration `json:"cryptcp"`    // Выполнение cryptcp во всех попытках (CSP и запрос к TSP)
+	ReadOutput time.Duration `json:"readOutput"` // Чтение и разбор файла подписи
+	Verify     time.Duration `json:"verify"`     // Контрольная проверка (WithSignAndVerify)
+	Cleanup    time.Duration `json:"cleanup"`    // Удаление рабочей директории (с WithAsyncCleanup - только запуск)
+}
+
+// addAttempts добавляет время попыток запуска cryptcp
+func (t *SignTimings) addAttempts(other SignTimings) {
+	t.TSPWait += other.TSPWait
+	t.Backoff += other.Backoff
+	t.Cryptcp += other.Cryptcp
+}
+
+// SignDocument подписывает документ через cryptcp с поддержкой CAdES-BES, CAdES-T и CAdES-X Long Type 1
+// attachSignature: nil = форма из SignWithMode или WithDefaultAttached (по умолчанию detached),
+// true = присоединенная подпись, false = отсоединенная
+// signType: nil = тип из конфига, 1 = CAdES-T (с временной меткой), 0 = CAdES-BES (базовая подпись),
+// 2 = CAdES-X Long Type 1 (с встроенными CRL/OCSP)
+// opts: необязательные параметры вызова (например, SignWithTSPServers)
+func (c *CryptoCLI) SignDocument(ctx context.Context, thumbprint string, pin string, dataBase64 string, attachSignature *bool, signType *uint, opts ...SignOption) (string, error) {
+	result, err := c.SignDocumentDetailed(ctx, thumbprint, pin, dataBase64, attachSignature, signType, opts...)
+	if err != nil {
+		return "", err
 	}
+	return result.SignatureBase64, nil
 }
 
-// SignDocument подписывает документ через cryptcp с поддержкой CAdES-T и CAdES-BES
-// signType: nil или 1 = CAdES-T (с временной меткой), 0 = CAdES-BES (базовая подпись)
-func (c *CryptoCLI) SignDocument(ctx context.Context, thumbprint string, pin string, dataBase64 string, attachSignature *bool, signType *uint) (string, error) {
+// SignDocumentDetailed подписывает документ так же, как SignDocument,
+// и возвращает подпись вместе со сведениями о ее создании
+func (c *CryptoCLI) SignDocumentDetailed(ctx context.Context, thumbprint string, pin string, dataBase64 string, attachSignature *bool, signType *uint, opts ...SignOption) (*SignResult, error) {
 
 	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "SignDocument")
 	defer span.End()
 
-	// Декодируем данные из base64
-	data, err := base64.StdEncoding.DecodeString(dataBase64)
+	c.stats.signsAttempted.Add(1)
+	result, err := c.signBase64(ctx, thumbprint, pin, dataBase64, attachSignature, signType, opts)
+	return c.recordSign(result, err)
+}
+
+// SignDocumentBytes подписывает документ так же, как SignDocument, но принимает данные
+// и возвращает подпись в DER без кодирования base64
+func (c *CryptoCLI) SignDocumentBytes(ctx context.Context, thumbprint string, pin string, data []byte, attachSignature *bool, signType *uint, opts ...SignOption) ([]byte, error) {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "SignDocumentBytes")
+	defer span.End()
+
+	c.stats.signsAttempted.Add(1)
+	result, err := c.recordSign(c.signDocument(ctx, thumbprint, pin, bytesDocument(data), attachSignature, signType, opts))
+	if err != nil {
+		return nil, err
+	}
+
+	return result.SignatureDER, nil
+}
+
+// recordSign учитывает результат подписи в счетчиках Stats
+func (c *CryptoCLI) recordSign(result *SignResult, err error) (*SignResult, error) {
+	if err != nil {
+		c.stats.signsFailed.Add(1)
+		return nil, err
+	}
+	c.stats.signsSucceeded.Add(1)
+
+	return result, nil
+}
+
+// signBase64 декодирует документ из base64, подписывает его и кодирует подпись в base64
+func (c *CryptoCLI) signBase64(ctx context.Context, thumbprint string, pin string, dataBase64 string, attachSignature *bool, signType *uint, opts []SignOption) (*SignResult, error) {
+	// Проверяем размер до декодирования, чтобы не выделять память под слишком большой документ
+	err := c.checkDocumentSize(dataBase64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSignature, err)
+	}
+
+	// Данные декодируются из base64 при записи во временный файл, без копии всего документа в памяти
+	doc, err := c.base64Document(dataBase64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: base64 decode: %v", ErrSignature, err)
+	}
+
+	result, err := c.signDocument(ctx, thumbprint, pin, doc, attachSignature, signType, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Кодируем бинарные данные в base64 для передачи
+	result.SignatureBase64 = base64.StdEncoding.EncodeToString(result.SignatureDER)
+
+	return result, nil
+}
+
+// signDocument выполняет подпись документа doc
+func (c *CryptoCLI) signDocument(ctx context.Context, thumbprint string, pin string, doc *document, attachSignature *bool, signType *uint, opts []SignOption) (*SignResult, error) {
+
+	startTime := time.Now()
+	options := newSignOptions(opts)
+	ctx = operationContext(ctx, options)
+
+	thumbprint, err := NormalizeThumbprint(thumbprint)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSignature, err)
+	}
+
+	// Определяем тип подписи: attached или detached
+	// Если attachSignature == nil и форма не задана, используем WithDefaultAttached (по умолчанию detached)
+	isAttached, err := options.resolveAttached(attachSignature, c.defaultAttached)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSignature, err)
+	}
+
+	// Нормализация требует всего документа, поэтому поток читается в память
+	if options.textNormalization != nil {
+		data, err := doc.materialize()
+		if err != nil {
+			return nil, fmt.Errorf("%w: read document: %v", ErrSignature, err)
+		}
+		doc = bytesDocument(options.textNormalization.normalize(data))
+		c.log(ctx).Debug("text input normalized",
+			"originalSize", len(data),
+			"normalizedSize", doc.size)
+	}
+
+	err = c.checkDataSize(doc.size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSignature, err)
+	}
+
+	// Проверяем свободное место до записи, чтобы вместо ошибки записи вернуть понятную причину
+	err = c.checkDiskSpace(c.signTmpBase(), doc.size)
 	if err != nil {
-		return "", fmt.Errorf("%w: base64 decode: %v", ErrSignature, err)
+		return nil, fmt.Errorf("%w: %w", ErrSignature, err)
 	}
 
 	// Создаем уникальную временную директорию для изоляции каждого запроса
 	// Это предотвращает конфликты при одновременных вызовах
-	workDir, err := os.MkdirTemp(c.tmpDir, "cprov_*")
+	workDir, err := c.newWorkDirIn(c.signTmpBase())
 	if err != nil {
-		return "", fmt.Errorf("%w: create work directory: %v", ErrSignature, err)
+		return nil, fmt.Errorf("%w: create work directory: %v", ErrSignature, err)
 	}
-	defer os.RemoveAll(workDir) // Удаляем всю директорию со всеми файлами
+	var result *SignResult
+	defer func() {
+		// Удаляем всю директорию со всеми файлами
+		cleanupStart := time.Now()
+		c.removeWorkDir(workDir)
+		if result != nil {
+			result.Timings.Cleanup = time.Since(cleanupStart)
+		}
+	}()
 
-	// Создаем файл с данными в изолированной директории
-	dataFilePath := workDir + "/data.txt"
-	err = os.WriteFile(dataFilePath, data, 0600)
+	// Создаем файл с данными в изолированной директории.
+	// Имя файла случайное, чтобы не полагаться на фиксированное имя внутри workDir
+	writeStart := time.Now()
+	dataFile, err := c.writeDocument(workDir, "data_*.txt", doc)
 	if err != nil {
-		return "", fmt.Errorf("%w: write data file: %v", ErrSignature, err)
+		return nil, fmt.Errorf("%w: write data file: %v", ErrSignature, err)
+	}
+	writeDuration := time.Since(writeStart)
+
+	input := &signInput{
+		workDir:       workDir,
+		dataFile:      dataFile,
+		thumbprint:    thumbprint,
+		pin:           pin,
+		isAttached:    isAttached,
+		signType:      signType,
+		options:       options,
+		startTime:     startTime,
+		writeDuration: writeDuration,
 	}
+	result, err = c.signInputFile(ctx, input)
+	return result, err
+}
 
-	// Определяем тип подписи: attached или detached
-	// По умолчанию используем detached (если attachSignature == nil или false)
-	isAttached := attachSignature != nil && *attachSignature
+// signInput подписываемый документ, уже записанный в файл, и параметры подписи
+type signInput struct {
+	workDir       string        // Рабочая директория cryptcp, в нее записывается подпись
+	dataFile      string        // Файл документа: имя в workDir или абсолютный путь к общему файлу
+	thumbprint    string        // Отпечаток сертификата подписанта
+	pin           string        // PIN контейнера
+	isAttached    bool          // Присоединенная подпись
+	signType      *uint         // Тип подписи вызова, nil - из конфига
+	options       *signOptions  // Опции вызова
+	startTime     time.Time     // Начало операции для SignResult.Duration
+	writeDuration time.Duration // Время записи документа
+}
 
-	// Формируем аргументы команды
-	args := []string{
-		"-sign",
-		c.formatStoreOption(),
-		"-thumbprint", thumbprint,
-		"-pin", pin,
+// filePath возвращает путь к файлу документа
+func (input *signInput) filePath() string {
+	if filepath.IsAbs(input.dataFile) {
+		return input.dataFile
 	}
+	return filepath.Join(input.workDir, input.dataFile)
+}
 
-	// Добавляем флаги пропуска проверки цепочки и отзыва (если включено)
-	if c.skipChainValidation {
-		args = append(args, "-nochain") // Не проверять цепочку сертификатов
-		args = append(args, "-norev")   // Не проверять отзыв сертификатов (CRL/OCSP)
+// signInputFile подписывает документ input.dataFile через cryptcp в input.workDir.
+// Если документ лежит вне workDir (общий файл SignMultiSigner), подпись записывается в workDir (-dir)
+func (c *CryptoCLI) signInputFile(ctx context.Context, input *signInput) (*SignResult, error) {
+	ctx = operationContext(ctx, input.options)
+
+	// Хэши подписываемых байтов для журнала, сама подпись от них не зависит
+	var digests map[DigestAlgorithm]string
+	if len(c.documentDigest) > 0 {
+		var err error
+		digests, err = c.documentDigests(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrSignature, err)
+		}
 	}
 
-	// Добавляем флаг attached/detached
-	if isAttached {
-		args = append(args, "-attached") // Создать присоединенную подпись
-	} else {
-		args = append(args, "-detached") // Создать отсоединенную подпись
+	if c.fakeBackend {
+		result, err := c.fakeSign(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		result.DocumentDigests = digests
+		return result, nil
 	}
 
-	args = append(args, "-der") // Использовать DER формат (бинарный) вместо BASE64
+	workDir := input.workDir
+	dataFile := input.dataFile
+	thumbprint := input.thumbprint
+	pin := input.pin
+	isAttached := input.isAttached
+	signType := input.signType
+	options := input.options
+	startTime := input.startTime
+	writeDuration := input.writeDuration
+
+	// Настройки на момент начала подписи: Reconfigure не меняет их для начатой операции
+	config := c.settings()
+
+	// Просроченный или отсутствующий сертификат обнаруживается до запуска cryptcp,
+	// который сообщает о нем малопонятной ошибкой
+	if c.preSignCertCheck {
+		err := c.checkSigningCertificate(ctx, thumbprint)
+		if err != nil {
+			c.log(ctx).Error("signing certificate check failed",
+				"thumbprint", thumbprint,
+				"error", err)
+			return nil, fmt.Errorf("%w: %w", ErrSignature, err)
+		}
+	}
+
+	// TSP серверы: переданные в вызове имеют приоритет над настройками клиента
+	tspServers := config.TSPServers
+	if options.tspServersSet {
+		servers, err := normalizeTSPServers(options.tspServers)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrSignature, err)
+		}
+		tspServers = servers
+	}
+
+	// Тип провайдера (WithProviderType или по алгоритму ключа), чтобы cryptcp
+	// не подписал провайдером по умолчанию с другим алгоритмом
+	extraArgs := c.providerTypeArgs(ctx, thumbprint)
+
+	// Хэш подписи, отличный от соответствующего ключу, проверяется до запуска cryptcp
+	if options.digestAlgorithm != "" {
+		digestArgs, err := c.digestAlgorithmArgs(ctx, thumbprint, options.digestAlgorithm)
+		if err != nil {
+			c.log(ctx).Error("signature digest algorithm rejected",
+				"thumbprint", thumbprint,
+				"digestAlgorithm", options.digestAlgorithm,
+				"error", err)
+			return nil, fmt.Errorf("%w: %w", ErrSignature, err)
+		}
+		extraArgs = append(extraArgs, digestArgs...)
+	}
+
+	// Документ вне рабочей директории: cryptcp записывает подпись рядом с документом,
+	// поэтому выходная директория задается явно
+	if filepath.IsAbs(dataFile) {
+		extraArgs = append(extraArgs, "-dir", workDir)
+	}
 
 	// Определяем тип подписи CAdES
 	// По умолчанию используем CAdES-T (signType == nil или signType == 1)
-	effectiveSignType := c.signType // используем из конфига по умолчанию
+	effectiveSignType := config.SignType // используем из конфига по умолчанию
 	if signType != nil {
 		effectiveSignType = *signType // переопределяем переданным значением
 	}
 
-	// Добавляем тип подписи CAdES
+	// Ответ OCSP встраивается только в CAdES-X Long Type 1, поэтому CAdES-T повышается до него
+	if c.embedOCSP && effectiveSignType == SignTypeT {
+		c.log(ctx).Debug("signature type upgraded to embed OCSP response",
+			"thumbprint", thumbprint,
+			"requestedSignType", effectiveSignType,
+			"signType", SignTypeXLongType1)
+		effectiveSignType = SignTypeXLongType1
+	}
+
+	// Выбираем TSP сервер для подписи с временной меткой
 	var selectedTSP string
-	if effectiveSignType == 1 {
-		// CAdES-T (с временной меткой)
-		selectedTSP = c.getRandomTSPServer()
+	switch effectiveSignType {
+	case SignTypeT:
+		selectedTSP = selectTSPServer(tspServers, nil)
 		if selectedTSP == "" {
-			return "", fmt.Errorf("%w: TSP server is required for CAdES-T signature type but none configured", ErrSignature)
+			return nil, noTSPServerError("CAdES-T", config, options.tspServersSet)
+		}
+	case SignTypeXLongType1:
+		// Проверка отзыва обязательна, т.к. ее результаты встраиваются в подпись
+		if config.SkipChainValidation {
+			return nil, fmt.Errorf("%w: CAdES-X Long requires chain and revocation checks, skipChainValidation must be disabled", ErrSignature)
+		}
+		selectedTSP = selectTSPServer(tspServers, nil)
+		if selectedTSP == "" {
+			return nil, noTSPServerError("CAdES-X Long", config, options.tspServersSet)
 		}
-		args = append(args, "-cadest")
-		args = append(args, "-cadestsa", selectedTSP)
-	} else {
-		// CAdES-BES (базовая подпись)
-		args = append(args, "-cadesbes")
 	}
 
-	// Добавляем входной файл и расширение для выходного файла.
-	// Используем только имя файла, т.к. cryptcp будет работать в workDir
 	// Для attached используем .sig, для detached - .sgn
 	fileExt := ".sgn"
 	if isAttached {
 		fileExt = ".sig"
 	}
-	args = append(args, "data.txt", "-fext", fileExt)
 
-	c.logger.Debug("cryptcp args", "args", args)
+	plan := &signPlan{
+		config:     config,
+		workDir:    workDir,
+		thumbprint: thumbprint,
+		dataFile:   dataFile,
+		signFile:   workDir + "/" + filepath.Base(dataFile) + fileExt,
+		tspServers: tspServers,
+		tspURL:     selectedTSP,
+		buildArgs: func(tspURL string) []string {
+			return append(c.signArgs(config, thumbprint, pin, options, isAttached, effectiveSignType, tspURL, dataFile, fileExt), extraArgs...)
+		},
+	}
 
 	// Проверяем контекст перед запуском
 	if ctx.Err() != nil {
-		return "", fmt.Errorf("%w: context cancelled before cryptcp execution: %v", ErrSignature, ctx.Err())
+		return nil, fmt.Errorf("%w: context cancelled before cryptcp execution: %v", ErrSignature, ctx.Err())
 	}
 
 	logFields := []interface{}{
 		"thumbprint", thumbprint,
 		"workDir", workDir,
 		"signType", effectiveSignType,
-		"skipChainValidation", c.skipChainValidation,
+		"skipChainValidation", config.SkipChainValidation,
+	}
+	if options.container != "" {
+		logFields = append(logFields, "container", options.container)
 	}
 	if selectedTSP != "" {
-		logFields = append(logFields, "tspURL", selectedTSP)
-		logFields = append(logFields, "tspServersCount", len(c.tspServers))
+		logFields = append(logFields, "tspURL", maskTSPURL(selectedTSP))
+		logFields = append(logFields, "tspServersCount", len(tspServers))
+	}
+	// Время подписи по доверенному источнику (WithTimeSource). Атрибут signingTime
+	// cryptcp берет из системных часов, поэтому расхождение фиксируется в логе
+	signingTime, clockDelta := c.trustedNow()
+	if c.timeSource != nil {
+		logFields = append(logFields, "trustedTime", signingTime, "clockDelta", clockDelta.Seconds())
+		if clockDelta > maxClockDelta || clockDelta < -maxClockDelta {
+			c.log(ctx).Warn("system clock differs from trusted time source",
+				"trustedTime", signingTime,
+				"clockDelta", clockDelta.Seconds())
+		}
+	}
+
+	// Подписи одним ключом выполняются последовательно. Блокировка берется до слота
+	// WithMaxConcurrency, чтобы ожидающая ключа подпись не занимала слот
+	unlockKey, err := c.acquireKeyLock(ctx, thumbprint, options.container)
+	if err != nil {
+		return nil, fmt.Errorf("%w: wait for key lock: %v", ErrSignature, err)
 	}
-	c.logger.Info("cryptcp starting", logFields...)
+	defer unlockKey()
+
+	// Ограничение одновременных подписей (WithMaxConcurrency) учитывает и подписи SignMultiSigner
+	release, err := c.acquireSignSlot(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: wait for sign slot: %v", ErrSignature, err)
+	}
+	defer release()
+
+	c.log(ctx).Info("cryptcp starting", logFields...)
 
 	// Создаем контекст с таймаутом для операции подписи
 	// Для CAdES-T (с TSP) операция может занять много времени
-	signCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	signCtx, cancel := context.WithTimeout(ctx, config.SignTimeout)
 	defer cancel()
 
-	// Retry логика: максимум 3 попытки при ошибках HTTP error от TSP сервера
-	const maxAttempts = 3
+	outcome, err := c.runSignAttempts(signCtx, plan)
+
+	result := &SignResult{
+		Thumbprint:      thumbprint,
+		SignType:        effectiveSignType,
+		Attached:        isAttached,
+		Mode:            SignModeDetached,
+		TSPServer:       maskTSPURL(outcome.tspURL),
+		Attempts:        outcome.attempts,
+		SigningTime:     signingTime,
+		Timings:         SignTimings{WriteFile: writeDuration},
+		OperationID:     contextCorrelationID(ctx),
+		DocumentDigests: digests,
+	}
+	result.Timings.addAttempts(outcome.timings)
+	if isAttached {
+		result.Mode = SignModeEnveloping
+	}
+
+	// Все TSP серверы недоступны: при включенной опции создаем CAdES-BES вместо CAdES-T
+	if err != nil && outcome.tspError && effectiveSignType == SignTypeT && c.tspFallbackToBES {
+		c.log(ctx).Warn("TSP retries exhausted, falling back to CAdES-BES",
+			"thumbprint", thumbprint,
+			"tspURL", maskTSPURL(selectedTSP),
+			"error", err)
+
+		plan.tspURL = ""
+		plan.buildArgs = func(string) []string {
+			return append(c.signArgs(config, thumbprint, pin, options, isAttached, SignTypeBES, "", dataFile, fileExt), extraArgs...)
+		}
+		outcome, err = c.runSignAttempts(signCtx, plan)
+
+		result.SignType = SignTypeBES
+		result.TSPServer = ""
+		result.FallbackToBES = true
+		result.Attempts += outcome.attempts
+		result.Timings.addAttempts(outcome.timings)
+	}
+
+	// Если после всех попыток есть ошибка - возвращаем её
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSignature, err)
+	}
+	signFile := outcome.signFile
+
+	// Финальная проверка существования файла подписи (на всякий случай)
+	if _, err := c.fileSystem.Stat(signFile); os.IsNotExist(err) {
+		filesInDir := c.workDirFiles(workDir)
+		c.log(ctx).Error("signature file not created",
+			"file", signFile,
+			"workDir", workDir,
+			"filesInDir", filesInDir,
+			"contextErr", ctx.Err())
+		return nil, fmt.Errorf("%w: signature file not created (expected: %s, workDir: %s, files: %v)",
+			ErrSignature, signFile, workDir, filesInDir)
+	}
+
+	// Читаем файл подписи (бинарный DER формат)
+	readStart := time.Now()
+	signData, err := c.fileSystem.ReadFile(signFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: read signature file %s: %v, stdout: %s, stderr: %s",
+			ErrSignature, signFile, err, outcome.stdout, outcome.stderr)
+	}
+
+	// cryptcp может без ошибки создать подпись уровня CAdES-T вместо X Long,
+	// поэтому проверяем, что значения CRL/OCSP действительно встроены
+	if result.SignType == SignTypeXLongType1 {
+		err = checkRevocationValues(signData)
+		if err != nil {
+			c.log(ctx).Error("CAdES-X Long signature has no revocation values",
+				"thumbprint", thumbprint,
+				"error", err)
+			return nil, fmt.Errorf("%w: %v", ErrSignature, err)
+		}
+	}
+
+	// Для проверки без доступа к OCSP в будущем нужен именно ответ OCSP, а не только CRL
+	if c.embedOCSP && result.SignType == SignTypeXLongType1 {
+		result.OCSPResponder, err = embeddedOCSPResponder(signData)
+		if err != nil {
+			c.log(ctx).Error("signature has no embedded OCSP response",
+				"thumbprint", thumbprint,
+				"error", err)
+			return nil, fmt.Errorf("%w: %v", ErrSignature, err)
+		}
+	}
+
+	// Партнерам для проверки без доступа к УЦ нужна вся цепочка внутри подписи
+	if c.includeCertChain {
+		err = checkCertChainIncluded(signData)
+		if err != nil {
+			c.log(ctx).Error("signature does not contain full certificate chain",
+				"thumbprint", thumbprint,
+				"error", err)
+			return nil, fmt.Errorf("%w: %v", ErrSignature, err)
+		}
+	}
+
+	result.Timings.ReadOutput = time.Since(readStart)
+
+	// Проверка TSA, выдавшего штамп, по правилам вызывающей стороны (WithTSPValidator)
+	if c.tspValidator != nil && (result.SignType == SignTypeT || result.SignType == SignTypeXLongType1) {
+		err = c.validateTimestamp(signData)
+		if err != nil {
+			c.log(ctx).Error("timestamp rejected by TSP validator",
+				"thumbprint", thumbprint,
+				"tspURL", result.TSPServer,
+				"error", err)
+			return nil, fmt.Errorf("%w: %w", ErrSignature, err)
+		}
+	}
+
+	// Контрольная проверка только что созданной подписи
+	if c.signAndVerify {
+		verifyDataFile := dataFile
+		if isAttached {
+			verifyDataFile = ""
+		}
+		verifyResult := c.verifyFilesWith(signCtx, config, workDir, verifyDataFile, filepath.Base(signFile))
+		result.Timings.Verify = verifyResult.Duration
+		if !verifyResult.Valid {
+			return nil, fmt.Errorf("%w: verification of created signature failed: %s", ErrSignature, verifyResult.Error)
+		}
+	}
+
+	result.SignatureDER = signData
+	result.Duration = time.Since(startTime)
+
+	return result, nil
+}
+
+// signArgs формирует аргументы cryptcp для подписи файла dataFile в рабочей директории
+func (c *CryptoCLI) signArgs(config *RuntimeConfig, thumbprint string, pin string, options *signOptions, isAttached bool, signType uint, tspURL string, dataFile string, fileExt string) []string {
+	args := []string{
+		"-sign",
+		c.formatStoreOption(),
+		"-thumbprint", thumbprint,
+	}
+
+	// С WithRequireCachedPin PIN берется из кэша CSP (CachePin), а не из аргумента
+	if !c.requireCachedPin {
+		args = append(args, "-pin", pin)
+	}
+
+	// Контейнер ключа на конкретном считывателе (если подключено несколько токенов)
+	if options.container != "" {
+		args = append(args, "-cont", options.container)
+	}
+
+	// Добавляем флаги пропуска проверки цепочки и отзыва (если включено)
+	if config.SkipChainValidation {
+		args = append(args, "-nochain") // Не проверять цепочку сертификатов
+		args = append(args, "-norev")   // Не проверять отзыв сертификатов (CRL/OCSP)
+	}
+
+	// Включаем в подпись сертификаты УЦ из цепочки подписанта, а не только его сертификат
+	if c.includeCertChain {
+		args = append(args, "-addchain")
+	}
+
+	// Добавляем флаг attached/detached
+	if isAttached {
+		args = append(args, "-attached") // Создать присоединенную подпись
+	} else {
+		args = append(args, "-detached") // Создать отсоединенную подпись
+	}
+
+	args = append(args, "-der") // Использовать DER формат (бинарный) вместо BASE64
+
+	// Добавляем тип подписи CAdES
+	switch signType {
+	case SignTypeT:
+		// CAdES-T (с временной меткой)
+		args = append(args, "-cadest")
+		args = append(args, "-cadestsa", tspURL)
+	case SignTypeXLongType1:
+		// CAdES-X Long Type 1: временная метка + значения CRL/OCSP внутри подписи
+		args = append(args, "-cadesxlt1")
+		args = append(args, "-cadestsa", tspURL)
+	default:
+		// CAdES-BES (базовая подпись)
+		args = append(args, "-cadesbes")
+	}
+
+	// Добавляем входной файл и расширение для выходного файла.
+	// Используем только имя файла, т.к. cryptcp будет работать в workDir
+	args = append(args, dataFile, "-fext", fileExt)
+
+	return args
+}
+
+// signPlan параметры запуска cryptcp для подписи
+type signPlan struct {
+	config     *RuntimeConfig               // Настройки клиента на момент начала подписи
+	workDir    string                       // Рабочая директория операции
+	thumbprint string                       // Отпечаток сертификата подписанта
+	dataFile   string                       // Имя файла подписываемого документа в workDir
+	signFile   string                       // Ожидаемый файл подписи
+	tspServers []TSPServer                  // TSP серверы для переключения при ошибках
+	tspURL     string                       // TSP сервер первой попытки, пустой для CAdES-BES
+	buildArgs  func(tspURL string) []string // Аргументы cryptcp для выбранного TSP сервера
+}
+
+// signOutcome итог выполнения попыток подписи
+type signOutcome struct {
+	stdout   string // Вывод cryptcp последней попытки
+	stderr   string
+	attempts int    // Количество выполненных попыток
+	signFile string // Найденный файл подписи
+	tspURL   string // TSP сервер последней попытки
+	tspError bool   // Последняя попытка завершилась ошибкой TSP сервера
+
+	timings SignTimings // Время ожидания и выполнения попыток
+}
+
+// runSignAttempts запускает cryptcp с повтором при ошибках HTTP от TSP сервера.
+// При повторе выбирается другой TSP сервер из списка, если он есть; с WithRetryBudget
+// сначала выполняются повторы на том же сервере, затем переключение на следующий.
+// Возвращает ошибку последней попытки, если подпись так и не была создана
+func (c *CryptoCLI) runSignAttempts(signCtx context.Context, plan *signPlan) (*signOutcome, error) {
+	// Retry логика: по умолчанию максимум 3 попытки при ошибках HTTP error от TSP сервера
+	config := plan.config
+	maxAttempts := max(config.RetryMaxAttempts, 1)
+	splitRetries := config.TSPFailoverAttempts > 0
+	if splitRetries {
+		maxAttempts = config.TSPFailoverAttempts * config.TransientAttempts
+	}
 	var lastErr error
-	var stdoutStr, stderrStr string
 	var duration time.Duration
-	signFile := workDir + "/data.txt" + fileExt
+	workDir := plan.workDir
+	signFile := plan.signFile
+	outcome := &signOutcome{tspURL: plan.tspURL}
+	triedTSP := map[string]bool{plan.tspURL: true}
+	serversUsed := 1    // TSP серверы, на которых выполнялись попытки (WithRetryBudget)
+	serverAttempts := 0 // Попытки на текущем TSP сервере
+	switchServer := true
 
 	for attempt := 1; attempt <= maxAttempts; attempt++ {
 		if attempt > 1 {
-			c.logger.Warn("retrying signature",
+			c.stats.retries.Add(1)
+
+			// Переключаемся на другой TSP сервер, т.к. предыдущий вернул ошибку:
+			// сначала того же приоритета, затем резервный
+			if outcome.tspURL != "" && switchServer {
+				next := nextTSPServer(plan.tspServers, triedTSP, outcome.tspURL)
+				if next != outcome.tspURL {
+					c.stats.tspFailovers.Add(1)
+					c.log(signCtx).Warn("switching TSP server",
+						"previousTspURL", maskTSPURL(outcome.tspURL),
+						"tspURL", maskTSPURL(next))
+					outcome.tspURL = next
+				}
+				serversUsed++
+				serverAttempts = 0
+			}
+
+			c.log(signCtx).Warn("retrying signature",
 				"attempt", attempt,
 				"maxAttempts", maxAttempts,
-				"previousError", lastErr)
-			// Небольшая задержка между попытками
-			time.Sleep(time.Second * time.Duration(attempt-1))
+				"previousError", c.logOutput(lastErr.Error()))
+			// Небольшая задержка между попытками, прерываемая отменой операции
+			backoff := config.RetryBackoff * time.Duration(attempt-1)
+			backoffStart := time.Now()
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-signCtx.Done():
+				timer.Stop()
+				outcome.timings.Backoff += time.Since(backoffStart)
+				return outcome, signCtx.Err()
+			}
+			outcome.timings.Backoff += backoff
+		}
+
+		// Файл подписи, оставшийся от предыдущей попытки или операции в переиспользуемой
+		// директории пула, не должен сойти за результат этой попытки
+		err := c.removeStaleSignatureFiles(signCtx, workDir, plan.dataFile, signFile)
+		if err != nil {
+			return outcome, fmt.Errorf("remove stale signature file: %v", err)
+		}
+
+		args := plan.buildArgs(outcome.tspURL)
+		c.log(signCtx).Debug("cryptcp args", "args", maskCommandArgs(args))
+
+		// Каждая попытка с временной меткой обращается к TSP серверу
+		if outcome.tspURL != "" && c.tspLimiter != nil {
+			waitStart := time.Now()
+			err := c.tspLimiter.wait(signCtx)
+			outcome.timings.TSPWait += time.Since(waitStart)
+			if err != nil {
+				return outcome, fmt.Errorf("wait for TSP rate limit: %v", err)
+			}
 		}
 
+		outcome.attempts = attempt
+		serverAttempts++
+
+		// С WithAttemptTimeout у каждой попытки свой срок в пределах общего времени подписи,
+		// чтобы медленная попытка не израсходовала время переключения на другой TSP сервер
+		attemptTimeout := config.SignTimeout
+		if config.AttemptTimeout > 0 {
+			attemptTimeout = config.AttemptTimeout
+		}
+		attemptCtx, cancelAttempt := context.WithTimeout(signCtx, attemptTimeout)
+
 		// Выполняем команду cryptcp с рабочей директорией = изолированная временная директория
 		// Это гарантирует, что все файлы (включая промежуточные) создаются в workDir
-		cmd := exec.CommandContext(signCtx, c.cryptcpPath, args...)
+		cmd := c.command(attemptCtx, c.cryptcpPath, args...)
 		cmd.Dir = workDir // устанавливаем рабочую директорию
 
 		var stdout, stderr bytes.Buffer
@@ -199,33 +896,111 @@ func (c *CryptoCLI) SignDocument(ctx context.Context, thumbprint string, pin str
 
 		// Засекаем время выполнения
 		startTime := time.Now()
-		err = cmd.Run()
+		err = c.run(attemptCtx, cmd)
 		duration = time.Since(startTime)
+		attemptErr := attemptCtx.Err()
+		cancelAttempt()
+		unresponsive := errors.Is(err, ErrTokenUnresponsive)
+		outcome.timings.Cryptcp += duration
 
 		// Логируем stdout/stderr и результат выполнения
-		stdoutStr = stdout.String()
-		stderrStr = stderr.String()
+		stdoutStr := decodeOutput(stdout.Bytes())
+		stderrStr := decodeOutput(stderr.Bytes())
+		outcome.stdout = stdoutStr
+		outcome.stderr = stderrStr
+
+		// Код завершения процесса и код ошибки КриптоПро из вывода ([ErrorCode: 0x...]).
+		// Код завершения в Linux усекается до байта, поэтому полный код берется из вывода
+		code := exitCode(err)
+		cspErrorCode := parseErrorCode(stdoutStr + "\n" + stderrStr)
 
-		c.logger.Info("cryptcp completed",
+		c.log(signCtx).Info("cryptcp completed",
 			"attempt", attempt,
 			"duration", duration.Seconds(),
 			"hasError", err != nil,
+			"exitCode", code,
+			"errorCode", cspErrorCode,
 			"hasStdout", stdoutStr != "",
 			"hasStderr", stderrStr != "")
 
 		if stdoutStr != "" || stderrStr != "" {
-			c.logger.Debug("cryptcp output",
+			c.log(signCtx).Debug("cryptcp output",
 				"attempt", attempt,
-				"stdout", stdoutStr,
-				"stderr", stderrStr,
+				"stdout", c.logOutput(stdoutStr),
+				"stderr", c.logOutput(stderrStr),
 				"duration", duration.Seconds())
 		}
 
+		// cryptcp остановлен по таймауту подписи, попытки или отмене контекста: сохраняем вывод,
+		// накопленный до остановки, и файлы workDir, чтобы было видно, на каком этапе он завис
+		if err != nil && attemptErr != nil {
+			filesInDir := c.workDirFiles(workDir)
+			lastErr = &CommandError{
+				Tool:      "cryptcp",
+				ExitCode:  code,
+				ErrorCode: cspErrorCode,
+				Stdout:    stdoutStr,
+				Stderr:    stderrStr,
+				Err: fmt.Errorf("cryptcp stopped after %.2fs: %w (%v, workDir: %s, files: %v)",
+					duration.Seconds(), attemptErr, err, workDir, filesInDir),
+			}
+			if errors.Is(attemptErr, context.DeadlineExceeded) {
+				lastErr = fmt.Errorf("%w: %w", ErrSignTimeout, lastErr)
+			}
+
+			// Истек срок только этой попытки: повторяем на следующем TSP сервере
+			lastAttempt := attempt == maxAttempts || splitRetries && serversUsed >= config.TSPFailoverAttempts
+			if signCtx.Err() == nil && !lastAttempt {
+				outcome.tspError = outcome.tspURL != ""
+				switchServer = true
+				c.log(signCtx).Warn("cryptcp attempt timed out, will retry",
+					"attempt", attempt,
+					"maxAttempts", maxAttempts,
+					"attemptTimeout", config.AttemptTimeout.Seconds(),
+					"tspURL", maskTSPURL(outcome.tspURL),
+					"stdout", c.logOutput(stdoutStr),
+					"stderr", c.logOutput(stderrStr),
+					"filesInDir", filesInDir)
+				continue
+			}
+
+			outcome.tspError = signCtx.Err() == nil && outcome.tspURL != ""
+			c.log(signCtx).Error("cryptcp stopped by timeout, partial output captured",
+				"attempt", attempt,
+				"duration", duration.Seconds(),
+				"signTimeout", config.SignTimeout.Seconds(),
+				"attemptTimeout", config.AttemptTimeout.Seconds(),
+				"contextErr", attemptErr,
+				"errorCode", cspErrorCode,
+				"stdout", c.logOutput(stdoutStr),
+				"stderr", c.logOutput(stderrStr),
+				"workDir", workDir,
+				"filesInDir", filesInDir)
+			break
+		}
+
 		// Проверяем, был ли создан файл подписи
 		// Это критично, т.к. cryptcp может вернуть err=nil, но не создать файл
-		signFileExists := false
-		if _, statErr := os.Stat(signFile); statErr == nil {
-			signFileExists = true
+		foundFile, findErr := c.findSignatureFile(workDir, plan.dataFile, signFile)
+		signFileExists := foundFile != ""
+
+		// Некоторые версии и настройки cryptcp выводят подпись в stdout вместо файла.
+		// Подпись из вывода записывается в ожидаемый файл и дальше обрабатывается как обычно
+		if !signFileExists && findErr == nil && err == nil && c.stdoutSignature {
+			if der, ok := signatureFromStdout(stdout.Bytes()); ok {
+				writeErr := c.fileSystem.WriteFile(signFile, der, 0600)
+				if writeErr != nil {
+					c.log(signCtx).Warn("signature found in cryptcp stdout but not saved",
+						"attempt", attempt,
+						"error", writeErr)
+				} else {
+					c.log(signCtx).Info("signature file not created, signature read from cryptcp stdout",
+						"attempt", attempt,
+						"size", len(der))
+					foundFile = signFile
+					signFileExists = true
+				}
+			}
 		}
 
 		// Проверяем наличие ошибок в выводе cryptcp
@@ -233,104 +1008,406 @@ func (c *CryptoCLI) SignDocument(ctx context.Context, thumbprint string, pin str
 		errorText := strings.ToLower(fmt.Sprintf("%v %s %s", err, stdoutStr, stderrStr))
 		hasErrorInOutput := strings.Contains(errorText, "error:")
 
+		// В строгом режиме (WithStrictStderr) любой вывод в stderr, включая предупреждения, - ошибка
+		strictStderrViolation := c.strictStderr && strings.TrimSpace(stderrStr) != ""
+
+		// С WithSuccessMarker успех подтверждается строкой в выводе cryptcp
+		hasSuccessMarker := c.successMarker == "" ||
+			strings.Contains(strings.ToLower(stdoutStr+"\n"+stderrStr), strings.ToLower(c.successMarker))
+
 		// Операция успешна только если:
 		// 1. err == nil (команда завершилась без ошибки)
 		// 2. файл подписи был создан
 		// 3. в выводе нет текста "Error:"
-		if err == nil && signFileExists && !hasErrorInOutput {
-			c.logger.Info("signature created successfully",
+		// 4. в строгом режиме stderr пуст
+		// 5. в выводе есть строка WithSuccessMarker, если она задана
+		if err == nil && signFileExists && !hasErrorInOutput && !strictStderrViolation && hasSuccessMarker {
+			c.log(signCtx).Info("signature created successfully",
 				"attempt", attempt,
-				"signFile", signFile)
-			break
+				"signFile", foundFile)
+			outcome.signFile = foundFile
+			return outcome, nil
 		}
 
 		// Формируем сообщение об ошибке
-		if !signFileExists {
+		if findErr != nil {
+			err = findErr
+		} else if !signFileExists {
 			// Проверяем, какие файлы реально созданы в workDir для диагностики
-			dirEntries, _ := os.ReadDir(workDir)
-			var filesInDir []string
-			for _, entry := range dirEntries {
-				filesInDir = append(filesInDir, entry.Name())
-			}
-			lastErr = fmt.Errorf("signature file not created after %.2fs (expected: %s, workDir: %s, files: %v), stdout: %s, stderr: %s",
-				duration.Seconds(), signFile, workDir, filesInDir, stdoutStr, stderrStr)
+			err = fmt.Errorf("signature file not created after %.2fs (expected: %s, workDir: %s, files: %v)",
+				duration.Seconds(), signFile, workDir, c.workDirFiles(workDir))
 		} else if hasErrorInOutput {
-			lastErr = fmt.Errorf("cryptcp reported error in output after %.2fs, stdout: %s, stderr: %s",
-				duration.Seconds(), stdoutStr, stderrStr)
+			err = fmt.Errorf("cryptcp reported error in output after %.2fs", duration.Seconds())
+		} else if err == nil && strictStderrViolation {
+			err = fmt.Errorf("cryptcp wrote to stderr in strict mode after %.2fs", duration.Seconds())
+		} else if err == nil && !hasSuccessMarker {
+			err = fmt.Errorf("cryptcp output has no success marker %q after %.2fs", c.successMarker, duration.Seconds())
 		} else {
-			lastErr = fmt.Errorf("cryptcp failed after %.2fs: %v, stdout: %s, stderr: %s",
-				duration.Seconds(), err, stdoutStr, stderrStr)
+			err = fmt.Errorf("cryptcp failed after %.2fs: %v", duration.Seconds(), err)
+		}
+		lastErr = &CommandError{
+			Tool:      "cryptcp",
+			ExitCode:  code,
+			ErrorCode: cspErrorCode,
+			Stdout:    stdoutStr,
+			Stderr:    stderrStr,
+			Err:       err,
+		}
+
+		// С истекшей лицензией cryptcp не выполнит ни одну операцию, повторять бесполезно
+		if isLicenseError(errorText) {
+			lastErr = fmt.Errorf("%w: %w", ErrLicenseExpired, lastErr)
+			c.log(signCtx).Error("CryptoPro license expired or missing, stopping retries",
+				"attempt", attempt,
+				"errorCode", cspErrorCode)
+			break
+		}
+
+		// Ключ запросил PIN интерактивно: токен не принимает -pin или PIN нет в кэше CSP
+		if isPinPromptError(errorText) {
+			lastErr = fmt.Errorf("%w: %w", ErrCachedPinRequired, lastErr)
+			c.log(signCtx).Error("key requested PIN interactively, cache it with CachePin and enable WithRequireCachedPin",
+				"attempt", attempt,
+				"thumbprint", plan.thumbprint,
+				"requireCachedPin", c.requireCachedPin,
+				"errorCode", cspErrorCode)
+			break
+		}
+
+		// Сертификата нет в хранилище: повтор и другой TSP сервер не помогут
+		if isCertNotFoundError(errorText) {
+			lastErr = fmt.Errorf("%w: thumbprint %s in store %s: %w", ErrCertNotFound, plan.thumbprint, c.store, lastErr)
+			c.log(signCtx).Error("signing certificate not found in store, stopping retries",
+				"attempt", attempt,
+				"thumbprint", plan.thumbprint,
+				"store", c.store,
+				"errorCode", cspErrorCode)
+			break
+		}
+
+		// Зависший токен: повтор имеет смысл, только если это разрешено WithStartupTimeout
+		if unresponsive {
+			lastErr = fmt.Errorf("%w: %w", ErrTokenUnresponsive, lastErr)
+			if !c.retryUnresponsive || attempt == maxAttempts || splitRetries && serverAttempts >= config.TransientAttempts {
+				c.log(signCtx).Error("token unresponsive, stopping retries",
+					"attempt", attempt,
+					"maxAttempts", maxAttempts)
+				break
+			}
+			c.log(signCtx).Warn("token unresponsive, will retry",
+				"attempt", attempt,
+				"maxAttempts", maxAttempts)
+			// Зависание токена не связано с TSP сервером, с WithRetryBudget сервер не меняется
+			switchServer = !splitRetries
+			continue
+		}
+
+		// HTTP ошибка TSP сервера может быть временной, а недействительный сертификат TSA - нет
+		failure := classifySignFailure(errorText, outcome.tspURL != "")
+		isHTTPError := failure == failureTSPHTTP
+		outcome.tspError = failure == failureTSPHTTP || failure == failureTSACertificate
+
+		// Расхождение часов не исправится ни повтором, ни другим TSP сервером
+		if failure == failureClockSkew {
+			lastErr = fmt.Errorf("%w: %s: %w", ErrClockSkew, maskTSPURL(outcome.tspURL), lastErr)
+			logFields := []interface{}{
+				"attempt", attempt,
+				"tspURL", maskTSPURL(outcome.tspURL),
+				"localTime", time.Now(),
+			}
+			if c.timeSource != nil {
+				trustedTime, clockDelta := c.trustedNow()
+				logFields = append(logFields, "trustedTime", trustedTime, "clockDelta", clockDelta.Seconds())
+			}
+			c.log(signCtx).Error("TSP server rejected request due to clock skew, check NTP synchronization", logFields...)
+			break
 		}
 
-		// Проверяем, содержит ли ошибка "HTTP error" (проблема с TSP сервером)
-		isHTTPError := strings.Contains(errorText, "http error")
+		if failure == failureTSACertificate {
+			lastErr = fmt.Errorf("%w: %s: %w", ErrTSACertificate, maskTSPURL(outcome.tspURL), lastErr)
+			c.log(signCtx).Error("TSA certificate rejected, remove the TSP server from the list",
+				"attempt", attempt,
+				"tspURL", maskTSPURL(outcome.tspURL),
+				"errorCode", cspErrorCode,
+				"error", c.logOutput(lastErr.Error()))
+			break
+		}
 
 		// Если это последняя попытка или ошибка не связана с HTTP - прерываем
 		if attempt == maxAttempts {
-			c.logger.Error("all retry attempts exhausted",
+			c.log(signCtx).Error("all retry attempts exhausted",
 				"attempt", attempt,
 				"maxAttempts", maxAttempts,
-				"lastError", lastErr)
+				"lastError", c.logOutput(lastErr.Error()))
 			break
 		}
 
 		if !isHTTPError {
-			c.logger.Warn("non-HTTP error detected, stopping retries",
+			c.log(signCtx).Warn("non-HTTP error detected, stopping retries",
 				"attempt", attempt,
-				"error", lastErr)
+				"error", c.logOutput(lastErr.Error()))
 			break
 		}
 
-		c.logger.Warn("detected HTTP error from TSP server, will retry",
+		// WithRetryBudget: повторы на том же сервере, затем переключение на следующий
+		if splitRetries {
+			switch {
+			case serverAttempts < config.TransientAttempts:
+				switchServer = false
+			case serversUsed < config.TSPFailoverAttempts:
+				switchServer = true
+			default:
+				c.log(signCtx).Error("TSP failover attempts exhausted",
+					"attempt", attempt,
+					"tspServers", serversUsed,
+					"lastError", c.logOutput(lastErr.Error()))
+				return outcome, lastErr
+			}
+		}
+
+		c.log(signCtx).Warn("detected HTTP error from TSP server, will retry",
 			"attempt", attempt,
 			"maxAttempts", maxAttempts,
-			"error", lastErr)
+			"sameServer", !switchServer,
+			"error", c.logOutput(lastErr.Error()))
 	}
 
-	// Если после всех попыток есть ошибка - возвращаем её
-	if lastErr != nil {
-		return "", fmt.Errorf("%w: %v", ErrSignature, lastErr)
+	return outcome, lastErr
+}
+
+// workDirFiles возвращает имена файлов рабочей директории для диагностики
+func (c *CryptoCLI) workDirFiles(workDir string) []string {
+	dirEntries, _ := c.fileSystem.ReadDir(workDir)
+	var filesInDir []string
+	for _, entry := range dirEntries {
+		filesInDir = append(filesInDir, entry.Name())
 	}
+	return filesInDir
+}
 
-	// Финальная проверка существования файла подписи (на всякий случай)
-	if _, err := os.Stat(signFile); os.IsNotExist(err) {
-		dirEntries, _ := os.ReadDir(workDir)
-		var filesInDir []string
-		for _, entry := range dirEntries {
-			filesInDir = append(filesInDir, entry.Name())
+// validateTimestamp передает сертификат TSA из штампа времени подписи в WithTSPValidator
+func (c *CryptoCLI) validateTimestamp(signData []byte) error {
+	token, err := extractTimestampToken(signData)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTSPRejected, err)
+	}
+
+	cert, err := timestampCertificate(token)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTSPRejected, err)
+	}
+
+	err = c.tspValidator(cert.Raw)
+	if err != nil {
+		return fmt.Errorf("%w: TSA %s (%s): %w", ErrTSPRejected, cert.Subject, certThumbprint(cert), err)
+	}
+
+	return nil
+}
+
+// maxClockDelta допустимое расхождение системных часов с доверенным источником времени
+const maxClockDelta = time.Minute
+
+// trustedNow возвращает текущее время по доверенному источнику и его расхождение
+// с системными часами (доверенное минус системное). Без источника возвращает системное время
+func (c *CryptoCLI) trustedNow() (time.Time, time.Duration) {
+	systemTime := time.Now()
+	if c.timeSource == nil {
+		return systemTime, 0
+	}
+	trusted := c.timeSource()
+	return trusted, trusted.Sub(systemTime)
+}
+
+// checkDocumentSize проверяет размер документа в base64 без декодирования
+func (c *CryptoCLI) checkDocumentSize(dataBase64 string) error {
+	if c.maxDocumentSize <= 0 {
+		return nil
+	}
+
+	size := int64(base64.StdEncoding.DecodedLen(len(dataBase64))) - int64(len(dataBase64)-len(strings.TrimRight(dataBase64, "=")))
+	return c.checkDataSize(size)
+}
+
+// checkDataSize проверяет размер декодированного документа по ограничению WithMaxDocumentSize
+func (c *CryptoCLI) checkDataSize(size int64) error {
+	if c.maxDocumentSize > 0 && size > c.maxDocumentSize {
+		return fmt.Errorf("%w: %d bytes, limit %d bytes", ErrDocumentTooLarge, size, c.maxDocumentSize)
+	}
+	return nil
+}
+
+// checkRevocationValues проверяет, что каждая подпись в PKCS#7 содержит значения CRL/OCSP
+func checkRevocationValues(signData []byte) error {
+	sd, err := parseSignedData(signData)
+	if err != nil {
+		return fmt.Errorf("parse signature: %v", err)
+	}
+
+	signers, err := sd.signers()
+	if err != nil {
+		return fmt.Errorf("parse signature: %v", err)
+	}
+	if len(signers) == 0 {
+		return errors.New("signature has no signer infos")
+	}
+
+	for i := range signers {
+		if !signers[i].hasRevocationValues() {
+			return errors.New("cryptcp produced signature without revocation values (not a CAdES-X Long signature)")
 		}
-		c.logger.Error("signature file not created",
-			"file", signFile,
-			"workDir", workDir,
-			"filesInDir", filesInDir,
-			"contextErr", ctx.Err())
-		return "", fmt.Errorf("%w: signature file not created (expected: %s, workDir: %s, files: %v)",
-			ErrSignature, signFile, workDir, filesInDir)
 	}
 
-	// Читаем файл подписи (бинарный DER формат)
-	signData, err := os.ReadFile(signFile)
+	return nil
+}
+
+// checkCertChainIncluded проверяет, что в подпись включена цепочка сертификата каждого
+// подписанта до самоподписанного корня
+func checkCertChainIncluded(signData []byte) error {
+	sd, err := parseSignedData(signData)
 	if err != nil {
-		return "", fmt.Errorf("%w: read signature file %s: %v, stdout: %s, stderr: %s",
-			ErrSignature, signFile, err, stdoutStr, stderrStr)
+		return fmt.Errorf("parse signature: %v", err)
 	}
 
-	// Кодируем бинарные данные в base64 для передачи
-	signBase64 := base64.StdEncoding.EncodeToString(signData)
-	//slog.Info("signData", "len", len(signData), "base64Len", len(signBase64))
+	signers, err := sd.signers()
+	if err != nil {
+		return fmt.Errorf("parse signature: %v", err)
+	}
+	if len(signers) == 0 {
+		return errors.New("signature has no signer infos")
+	}
+
+	var pool []*x509.Certificate
+	for _, der := range sd.certificatesDER() {
+		cert, err := x509.ParseCertificate(der)
+		if err == nil {
+			pool = append(pool, cert)
+		}
+	}
+
+	for i := range signers {
+		current, err := sd.signerCertificate(&signers[i])
+		if err != nil {
+			return err
+		}
 
-	return signBase64, nil
+		for depth := 0; !bytes.Equal(current.RawSubject, current.RawIssuer); depth++ {
+			if depth == maxChainLength {
+				return errors.New("certificate chain is too long")
+			}
+
+			var issuer *x509.Certificate
+			for _, candidate := range pool {
+				if !candidate.Equal(current) && isIssuerCandidate(current, candidate) {
+					issuer = candidate
+					break
+				}
+			}
+			if issuer == nil {
+				return fmt.Errorf("cryptcp produced signature without issuer certificate %s of %s", current.Issuer, current.Subject)
+			}
+			current = issuer
+		}
+	}
+
+	return nil
 }
 
-// getRandomTSPServer возвращает случайный TSP сервер из списка
-func (c *CryptoCLI) getRandomTSPServer() string {
-	if len(c.tspServers) == 0 {
-		return ""
+// writeTempFile создает в dir файл со случайным именем по шаблону pattern ("*" заменяется
+// случайным числом, как в os.CreateTemp), записывает в него data и возвращает имя файла без пути.
+// dir - рабочая директория операции, поэтому имя достаточно выбрать среди уже существующих
+func (c *CryptoCLI) writeTempFile(dir string, pattern string, data []byte) (string, error) {
+	name, path := c.tempFileName(dir, pattern)
+	err := c.fileSystem.WriteFile(path, data, 0600)
+	if err != nil {
+		return "", err
 	}
-	if len(c.tspServers) == 1 {
-		return c.tspServers[0]
+	return name, nil
+}
+
+// tempFileName выбирает в dir несуществующее имя файла по шаблону pattern
+// и возвращает имя и полный путь
+func (c *CryptoCLI) tempFileName(dir string, pattern string) (string, string) {
+	for {
+		name := strings.Replace(pattern, "*", strconv.FormatUint(uint64(rand.Uint32()), 10), 1)
+		path := filepath.Join(dir, name)
+		if _, err := c.fileSystem.Stat(path); err == nil {
+			continue
+		}
+		return name, path
+	}
+}
+
+// findSignatureFile ищет созданный cryptcp файл подписи в workDir. По умолчанию это файл expected,
+// с WithSignatureFileGlob - первый по алфавиту обычный файл, подходящий под шаблон,
+// кроме документа dataFile. Возвращает пустую строку, если файл не найден
+func (c *CryptoCLI) findSignatureFile(workDir string, dataFile string, expected string) (string, error) {
+	if c.signatureFileGlob == "" {
+		if _, err := c.fileSystem.Stat(expected); err != nil {
+			return "", nil
+		}
+		return expected, nil
+	}
+
+	if _, err := filepath.Match(c.signatureFileGlob, ""); err != nil {
+		return "", fmt.Errorf("signature file glob %q: %v", c.signatureFileGlob, err)
+	}
+
+	// ReadDir возвращает записи, отсортированные по имени
+	entries, err := c.fileSystem.ReadDir(workDir)
+	if err != nil {
+		return "", fmt.Errorf("read work directory: %v", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == dataFile || !entry.Type().IsRegular() {
+			continue
+		}
+		if matched, _ := filepath.Match(c.signatureFileGlob, name); matched {
+			return filepath.Join(workDir, name), nil
+		}
+	}
+
+	return "", nil
+}
+
+// removeStaleSignatureFiles удаляет из workDir файлы, которые findSignatureFile приняла бы
+// за созданную подпись: файл expected, а с WithSignatureFileGlob также все подходящие под шаблон,
+// кроме документа dataFile
+func (c *CryptoCLI) removeStaleSignatureFiles(ctx context.Context, workDir string, dataFile string, expected string) error {
+	remove := func(stale string) error {
+		c.log(ctx).Warn("stale signature file removed before cryptcp run",
+			"file", stale,
+			"workDir", workDir)
+		err := c.fileSystem.RemoveAll(stale)
+		if err != nil {
+			return err
+		}
+		if _, err := c.fileSystem.Stat(stale); err == nil {
+			return fmt.Errorf("%s still exists after removal", stale)
+		}
+		return nil
+	}
+
+	// С WithSignatureFileGlob expected может не подходить под шаблон, но cryptcp создаст именно его
+	if _, err := c.fileSystem.Stat(expected); err == nil {
+		err = remove(expected)
+		if err != nil {
+			return err
+		}
+	}
+
+	for {
+		stale, err := c.findSignatureFile(workDir, dataFile, expected)
+		if err != nil || stale == "" {
+			return err
+		}
+		err = remove(stale)
+		if err != nil {
+			return err
+		}
 	}
-	return c.tspServers[rand.Intn(len(c.tspServers))]
 }
 
 // formatStoreOption форматирует опцию хранилища для cryptcp
@@ -359,32 +1436,45 @@ func (c *CryptoCLI) ListCertificates(ctx context.Context) (string, error) {
 	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "ListCertificates")
 	defer span.End()
 
-	cmd := exec.CommandContext(ctx, c.certmgrPath,
+	return c.listStore(ctx, c.store)
+}
+
+// listStore получает список сертификатов в указанном хранилище
+func (c *CryptoCLI) listStore(ctx context.Context, store string) (string, error) {
+	ctx, cancel := c.certmgrContext(ctx)
+	defer cancel()
+
+	cmd := c.command(ctx, c.certmgrPath,
 		"-list",
-		"-store", c.store,
+		"-store", store,
 	)
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	err := cmd.Run()
+	err := c.certmgrRun(ctx, cmd)
 	if err != nil {
-		return "", fmt.Errorf("certmgr list: %v, stderr: %s", err, stderr.String())
+		return "", fmt.Errorf("certmgr list: %w, stderr: %s", err, decodeOutput(stderr.Bytes()))
 	}
 
-	return stdout.String(), nil
+	return decodeOutput(stdout.Bytes()), nil
 }
 
 // IsCertificateInstalled проверяет, установлен ли сертификат
 func (c *CryptoCLI) IsCertificateInstalled(ctx context.Context, thumbprint string) bool {
+	thumbprint, err := NormalizeThumbprint(thumbprint)
+	if err != nil {
+		return false
+	}
+
 	output, err := c.ListCertificates(ctx)
 	if err != nil {
 		return false
 	}
 
 	// Проверяем наличие thumbprint в выводе
-	return strings.Contains(strings.ToLower(output), strings.ToLower(thumbprint))
+	return strings.Contains(strings.ToLower(output), thumbprint)
 }
 
 // InstallCertificate устанавливает сертификат из base64 строки
@@ -393,49 +1483,190 @@ func (c *CryptoCLI) InstallCertificate(ctx context.Context, certBase64 string, p
 	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "ensureCertificate")
 	defer span.End()
 
-	// Декодируем сертификат из base64
-	certData, err := base64.StdEncoding.DecodeString(certBase64)
+	certData, err := c.decodePFX(certBase64)
 	if err != nil {
-		return fmt.Errorf("%w: base64 decode: %v", ErrCertificateInstallation, err)
+		return err
+	}
+
+	return c.InstallCertificateBytes(ctx, certData, pin)
+}
+
+// InstallCertificateBytes устанавливает сертификат из PKCS#12 (например, прочитанного из .p12 файла)
+// без промежуточного кодирования в base64
+func (c *CryptoCLI) InstallCertificateBytes(ctx context.Context, p12 []byte, pin string) error {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "InstallCertificateBytes")
+	defer span.End()
+
+	return c.installPFX(ctx, p12, pin, "")
+}
+
+// InstallCertificateToContainer устанавливает сертификат из base64 строки в контейнер с заданным именем.
+// Если контейнер уже существует, возвращается ErrContainerExists, либо при overwrite == true
+// ключ сначала устанавливается во временный контейнер и заменяет существующий только после
+// успешной установки: при неверном PIN или PFX прежний ключ сохраняется
+func (c *CryptoCLI) InstallCertificateToContainer(ctx context.Context, certBase64 string, pin string, container string, overwrite bool) error {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "InstallCertificateToContainer")
+	defer span.End()
+
+	if container == "" {
+		return fmt.Errorf("%w: container name is required", ErrCertificateInstallation)
 	}
 
-	// Создаем уникальный временный файл для сертификата (безопасно для concurrent вызовов)
-	certFile, err := os.CreateTemp(c.tmpDir, "cert_*.p12")
+	// Декодируем и проверяем структуру PFX до изменения существующего контейнера
+	certData, err := c.decodePFX(certBase64)
 	if err != nil {
-		return fmt.Errorf("%w: create temp file: %v", ErrCertificateInstallation, err)
+		return err
+	}
+	err = validatePFX(certData)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCertificateInstallation, err)
 	}
-	certFilePath := certFile.Name()
-	defer os.Remove(certFilePath)
 
-	// Записываем данные и закрываем файл
-	_, err = certFile.Write(certData)
+	existing, err := c.findContainer(ctx, container)
 	if err != nil {
-		certFile.Close()
-		return fmt.Errorf("%w: write file: %v", ErrCertificateInstallation, err)
+		return fmt.Errorf("%w: %v", ErrCertificateInstallation, err)
+	}
+
+	if existing != "" {
+		if !overwrite {
+			return fmt.Errorf("%w: %w: %s", ErrCertificateInstallation, ErrContainerExists, existing)
+		}
+
+		c.log(ctx).Warn("overwriting existing container", "container", existing)
+		return c.replaceContainer(ctx, certData, pin, existing)
 	}
-	err = certFile.Close()
+
+	return c.installPFX(ctx, certData, pin, container)
+}
+
+// replaceContainer заменяет ключ существующего контейнера existing ключом из PFX.
+// PFX устанавливается во временный контейнер (это проверяет PIN и PFX), и только после этого
+// прежний контейнер удаляется, а новый ключ копируется под его имя и связывается с сертификатом
+// в хранилище. Если копирование не удалось, новый ключ остается во временном контейнере
+func (c *CryptoCLI) replaceContainer(ctx context.Context, certData []byte, pin string, existing string) error {
+	temporary := fmt.Sprintf("%s.tmp%d", existing, rand.Uint32())
+
+	err := c.installPFX(ctx, certData, pin, temporary)
 	if err != nil {
-		return fmt.Errorf("%w: close file: %v", ErrCertificateInstallation, err)
+		c.log(ctx).Error("certificate installation into temporary container failed, existing container kept",
+			"container", existing,
+			"error", err)
+		return err
+	}
+
+	err = c.deleteContainer(ctx, existing)
+	if err != nil {
+		c.removeTemporaryContainer(ctx, temporary)
+		return fmt.Errorf("%w: %v", ErrCertificateInstallation, err)
+	}
+
+	err = c.copyContainer(ctx, temporary, existing, pin)
+	if err != nil {
+		return fmt.Errorf("%w: %v (new key kept in container %s)", ErrCertificateInstallation, err, temporary)
+	}
+
+	// Сертификат в хранилище связан с временным контейнером, переносим связь на итоговый
+	_, stderr, err := c.runCertmgr(ctx,
+		"-install",
+		"-store", c.store,
+		"-cont", existing,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: certmgr link certificate to %s: %v, stderr: %s (new key kept in container %s)",
+			ErrCertificateInstallation, existing, err, stderr, temporary)
+	}
+
+	c.removeTemporaryContainer(ctx, temporary)
+
+	return nil
+}
+
+// removeTemporaryContainer удаляет временный контейнер replaceContainer; ошибка только логируется
+func (c *CryptoCLI) removeTemporaryContainer(ctx context.Context, container string) {
+	err := c.deleteContainer(ctx, container)
+	if err != nil {
+		c.log(ctx).Warn("failed to remove temporary container",
+			"container", container,
+			"error", err)
+	}
+}
+
+// validatePFX проверяет, что данные - структура PKCS#12 PFX версии 3 (RFC 7292).
+// PIN и ключ проверяет certmgr при установке
+func validatePFX(data []byte) error {
+	var pfx struct {
+		Version  int
+		AuthSafe asn1.RawValue
+		MacData  asn1.RawValue `asn1:"optional"`
+	}
+	rest, err := asn1.Unmarshal(data, &pfx)
+	if err != nil {
+		return fmt.Errorf("parse PFX: %v", err)
+	}
+	if len(rest) > 0 {
+		return errors.New("parse PFX: trailing data")
+	}
+	if pfx.Version != 3 {
+		return fmt.Errorf("unsupported PFX version %d", pfx.Version)
+	}
+	return nil
+}
+
+// decodePFX декодирует PKCS#12 из base64 строки
+func (c *CryptoCLI) decodePFX(certBase64 string) ([]byte, error) {
+	certData, err := c.decodeBase64(certBase64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: base64 decode: %v", ErrCertificateInstallation, err)
+	}
+	return certData, nil
+}
+
+// installPFX устанавливает PKCS#12 через certmgr.
+// Если container не пустой, ключ помещается в контейнер с этим именем (флаг -cont)
+func (c *CryptoCLI) installPFX(ctx context.Context, certData []byte, pin string, container string) error {
+
+	// Файл с закрытым ключом пишется в изолированную рабочую директорию (безопасно для concurrent вызовов)
+	workDir, err := c.newWorkDirIn(c.installTmpBase())
+	if err != nil {
+		return fmt.Errorf("%w: create work directory: %v", ErrCertificateInstallation, err)
+	}
+	defer c.removeWorkDir(workDir)
+
+	certFilePath := filepath.Join(workDir, "cert.p12")
+	err = c.fileSystem.WriteFile(certFilePath, certData, 0600)
+	if err != nil {
+		return fmt.Errorf("%w: write file: %v", ErrCertificateInstallation, err)
 	}
 
 	// Устанавливаем сертификат через certmgr
-	cmd := exec.CommandContext(ctx, c.certmgrPath,
+	args := []string{
 		"-install",
 		"-pfx",
 		"-store", c.store,
 		"-file", certFilePath,
 		"-pin", pin,
 		"-newpin", pin,
-	)
+	}
+	if container != "" {
+		args = append(args, "-cont", container)
+	}
+
+	ctx, cancel := c.certmgrContext(ctx)
+	defer cancel()
+
+	cmd := c.command(ctx, c.certmgrPath, args...)
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	err = cmd.Run()
+	err = c.certmgrRun(ctx, cmd)
 	if err != nil {
-		return fmt.Errorf("%w: certmgr: %v, stderr: %s", ErrCertificateInstallation, err, stderr.String())
+		return fmt.Errorf("%w: certmgr: %w, stderr: %s", ErrCertificateInstallation, err, decodeOutput(stderr.Bytes()))
 	}
+	c.stats.certsInstalled.Add(1)
 
 	return nil
 }
@@ -446,9 +1677,22 @@ func (c *CryptoCLI) DeleteCertificate(ctx context.Context, thumbprint string) er
 	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "DeleteCertificate")
 	defer span.End()
 
-	cmd := exec.CommandContext(ctx, c.certmgrPath,
+	thumbprint, err := NormalizeThumbprint(thumbprint)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCertificateDeletion, err)
+	}
+
+	return c.deleteFromStore(ctx, c.store, thumbprint)
+}
+
+// deleteFromStore удаляет сертификат по thumbprint из указанного хранилища
+func (c *CryptoCLI) deleteFromStore(ctx context.Context, store string, thumbprint string) error {
+	ctx, cancel := c.certmgrContext(ctx)
+	defer cancel()
+
+	cmd := c.command(ctx, c.certmgrPath,
 		"-delete",
-		"-store", c.store,
+		"-store", store,
 		"-thumbprint", thumbprint,
 	)
 
@@ -456,10 +1700,11 @@ func (c *CryptoCLI) DeleteCertificate(ctx context.Context, thumbprint string) er
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	err := cmd.Run()
+	err := c.certmgrRun(ctx, cmd)
 	if err != nil {
-		return fmt.Errorf("%w: certmgr: %v, stderr: %s", ErrCertificateDeletion, err, stderr.String())
+		return fmt.Errorf("%w: certmgr: %w, stderr: %s", ErrCertificateDeletion, err, decodeOutput(stderr.Bytes()))
 	}
+	c.stats.certsDeleted.Add(1)
 
 	return nil
 }
@@ -0,0 +1,195 @@
+package cprovlib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// memFileSystem FileSystem в памяти для тестов файловых операций без диска
+type memFileSystem struct {
+	files fstest.MapFS
+}
+
+func (m *memFileSystem) MkdirTemp(dir string, pattern string) (string, error) {
+	return "", errors.New("memFileSystem: MkdirTemp is not supported")
+}
+
+func (m *memFileSystem) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.files[filepath.ToSlash(name)] = &fstest.MapFile{Data: data, Mode: perm}
+	return nil
+}
+
+func (m *memFileSystem) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(m.files, filepath.ToSlash(name))
+}
+
+func (m *memFileSystem) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(m.files, filepath.ToSlash(name))
+}
+
+func (m *memFileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(m.files, filepath.ToSlash(name))
+}
+
+func (m *memFileSystem) RemoveAll(path string) error {
+	path = filepath.ToSlash(path)
+	for name := range m.files {
+		if name == path || strings.HasPrefix(name, path+"/") {
+			delete(m.files, name)
+		}
+	}
+	return nil
+}
+
+func TestRemoveStaleSignatureFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		glob  string
+		files []string
+		want  []string // Файлы, оставшиеся в рабочей директории
+	}{
+		{
+			name:  "expected only",
+			files: []string{"doc.txt", "doc.txt.sgn", "other.p7s"},
+			want:  []string{"doc.txt", "other.p7s"},
+		},
+		{
+			name:  "no stale files",
+			files: []string{"doc.txt"},
+			want:  []string{"doc.txt"},
+		},
+		{
+			name:  "glob matches",
+			glob:  "*.p7s",
+			files: []string{"doc.txt", "doc.txt.sgn", "a.p7s", "b.p7s", "notes.log"},
+			want:  []string{"doc.txt", "notes.log"},
+		},
+		{
+			name:  "glob matches document",
+			glob:  "doc*",
+			files: []string{"doc.txt", "doc.txt.sgn", "doc.p7s"},
+			want:  []string{"doc.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := &memFileSystem{files: fstest.MapFS{}}
+			for _, name := range tt.files {
+				fsys.files["work/"+name] = &fstest.MapFile{Data: []byte(name), Mode: 0600}
+			}
+
+			c := New("uMy", nil, 0, &DefaultLogger{}, false,
+				WithFileSystem(fsys),
+				WithSignatureFileGlob(tt.glob))
+
+			err := c.removeStaleSignatureFiles(context.Background(), "work", "doc.txt", filepath.Join("work", "doc.txt.sgn"))
+			if err != nil {
+				t.Fatalf("removeStaleSignatureFiles: %v", err)
+			}
+
+			var got []string
+			for name := range fsys.files {
+				got = append(got, strings.TrimPrefix(name, "work/"))
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("remaining files %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResultsJSON(t *testing.T) {
+	signingTime := time.Date(2026, 3, 1, 12, 30, 0, 0, time.FixedZone("MSK", 3*60*60))
+	thumbprint, err := NormalizeThumbprint("AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67:89:AB:CD:EF:01")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		value any
+		want  map[string]any // Ожидаемые значения полей JSON
+	}{
+		{
+			name: "SignResult",
+			value: SignResult{
+				SignatureBase64: "MIIB",
+				SignatureDER:    []byte{0x30},
+				Thumbprint:      thumbprint,
+				Mode:            SignModeDetached,
+				SigningTime:     signingTime,
+				Duration:        time.Second,
+			},
+			want: map[string]any{
+				"signatureBase64": "MIIB",
+				"thumbprint":      "abcdef0123456789abcdef0123456789abcdef01",
+				"mode":            "detached",
+				"signingTime":     "2026-03-01T12:30:00+03:00",
+				"duration":        float64(time.Second),
+			},
+		},
+		{
+			name: "CertificateInfo",
+			value: CertificateInfo{
+				Thumbprint: thumbprint,
+				Subject:    "CN=Test",
+				NotBefore:  signingTime,
+				NotAfter:   signingTime.AddDate(1, 0, 0),
+			},
+			want: map[string]any{
+				"thumbprint":    "abcdef0123456789abcdef0123456789abcdef01",
+				"subject":       "CN=Test",
+				"notBefore":     "2026-03-01T12:30:00+03:00",
+				"notAfter":      "2027-03-01T12:30:00+03:00",
+				"hasPrivateKey": false,
+			},
+		},
+		{
+			name: "VerifyResult",
+			value: VerifyResult{
+				Valid:       true,
+				SigningTime: &signingTime,
+				Signers:     []SignerInfo{{Thumbprint: thumbprint}},
+			},
+			want: map[string]any{
+				"valid":       true,
+				"cached":      false,
+				"signingTime": "2026-03-01T12:30:00+03:00",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+
+			var got map[string]any
+			err = json.Unmarshal(data, &got)
+			if err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+
+			for key, want := range tt.want {
+				if got[key] != want {
+					t.Errorf("%s = %#v, want %#v (%s)", key, got[key], want, data)
+				}
+			}
+			if _, ok := got["SignatureDER"]; ok {
+				t.Errorf("SignatureDER must not be serialized: %s", data)
+			}
+		})
+	}
+}
@@ -0,0 +1,483 @@
+package cprovlib
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// parseCRLs разбирает списки отзыва в DER или PEM
+func parseCRLs(raw [][]byte) ([]*x509.RevocationList, error) {
+	crls := make([]*x509.RevocationList, 0, len(raw))
+	for i, der := range raw {
+		if block, _ := pem.Decode(der); block != nil {
+			der = block.Bytes
+		}
+		crl, err := x509.ParseRevocationList(der)
+		if err != nil {
+			return nil, fmt.Errorf("parse CRL %d: %v", i, err)
+		}
+		crls = append(crls, crl)
+	}
+	return crls, nil
+}
+
+// caStore возвращает хранилище промежуточных УЦ того же уровня (u/m), что и хранилище клиента.
+// cryptcp ищет в нем списки отзыва, если точки распространения CRL недоступны
+func (c *CryptoCLI) caStore() string {
+	if strings.HasPrefix(strings.ToLower(c.store), "m") {
+		return "mCA"
+	}
+	return "uCA"
+}
+
+// crlLeases учет списков отзыва VerifyWithCRLs, установленных в хранилище CA: CRL удаляется
+// после последней проверки, которая его использует. Блокировка не удерживается на время
+// запуска certmgr
+type crlLeases struct {
+	mu     sync.Mutex
+	leases map[string]*crlLease
+}
+
+// crlLease список отзыва на время проверок; refs - количество проверок, использующих его.
+// installed закрывается после установки (err - ее результат), removed - после удаления.
+// preinstalled - CRL был в хранилище до проверки: он не устанавливается и не удаляется
+type crlLease struct {
+	refs         int
+	installed    chan struct{}
+	err          error
+	preinstalled bool
+	removed      chan struct{}
+}
+
+// errCRLStoreEmpty код, с которым certmgr -list сообщает о пустом хранилище
+const errCRLStoreEmpty = "0x8010002c"
+
+// installCRLs устанавливает списки отзыва в хранилище CA, где их использует cryptcp при проверке
+// без доступа к сети, и возвращает функцию, удаляющую их после проверки. Параллельные проверки
+// с одним и тем же CRL устанавливают его один раз, а удаляет его последняя из них. CRL, который
+// уже был в хранилище (установлен администратором), не устанавливается и не удаляется
+func (c *CryptoCLI) installCRLs(ctx context.Context, crls []*x509.RevocationList) (func(), error) {
+	store := c.caStore()
+	var acquired []string
+	release := func() {
+		for _, id := range acquired {
+			c.releaseCRL(ctx, store, id)
+		}
+	}
+
+	var present map[string]bool
+	for _, crl := range crls {
+		sum := sha1.Sum(crl.Raw)
+		id := hex.EncodeToString(sum[:])
+		if slices.Contains(acquired, id) {
+			continue
+		}
+
+		lease, owner, err := c.acquireCRL(ctx, id)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		acquired = append(acquired, id)
+		if !owner {
+			select {
+			case <-lease.installed:
+			case <-ctx.Done():
+				release()
+				return nil, ctx.Err()
+			}
+			if lease.err != nil {
+				release()
+				return nil, fmt.Errorf("install CRL of %s: %v", crl.Issuer, lease.err)
+			}
+			continue
+		}
+
+		// Содержимое хранилища читается один раз за вызов, до первой установки
+		if present == nil {
+			present, err = c.storeCRLs(ctx, store)
+		}
+		if err == nil && present[id] {
+			lease.preinstalled = true
+			close(lease.installed)
+			c.log(ctx).Debug("offline CRL already in store, it will be kept after verification",
+				"issuer", crl.Issuer.String(),
+				"store", store)
+			continue
+		}
+
+		if err == nil {
+			if !crl.NextUpdate.IsZero() && time.Now().After(crl.NextUpdate) {
+				c.log(ctx).Warn("offline CRL is past its next update time",
+					"issuer", crl.Issuer.String(),
+					"nextUpdate", crl.NextUpdate)
+			}
+			err = c.installCRLFile(ctx, store, crl.Raw)
+		}
+		lease.err = err
+		close(lease.installed)
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("install CRL of %s: %v", crl.Issuer, err)
+		}
+
+		c.log(ctx).Debug("offline CRL installed",
+			"issuer", crl.Issuer.String(),
+			"thisUpdate", crl.ThisUpdate,
+			"store", store)
+	}
+	return release, nil
+}
+
+// storeCRLs возвращает SHA1 отпечатки списков отзыва в хранилище store
+func (c *CryptoCLI) storeCRLs(ctx context.Context, store string) (map[string]bool, error) {
+	stdout, stderr, err := c.runCertmgr(ctx,
+		"-list",
+		"-crl",
+		"-store", store,
+	)
+	if err != nil {
+		if parseErrorCode(stdout+stderr) == errCRLStoreEmpty {
+			return map[string]bool{}, nil
+		}
+		return nil, fmt.Errorf("certmgr list CRLs of %s: %w, stderr: %s", store, err, stderr)
+	}
+	return parseCRLThumbprints(stdout), nil
+}
+
+// parseCRLThumbprints разбирает SHA1 отпечатки списков отзыва из вывода certmgr -list -crl
+func parseCRLThumbprints(output string) map[string]bool {
+	thumbprints := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "sha1 hash", "sha1 thumbprint":
+			thumbprint, err := NormalizeThumbprint(value)
+			if err == nil {
+				thumbprints[thumbprint] = true
+			}
+		}
+	}
+	return thumbprints
+}
+
+// acquireCRL увеличивает счетчик использования CRL id. owner означает, что CRL нужно
+// установить вызывающему; удаляемый в этот момент CRL сначала дожидается удаления
+func (c *CryptoCLI) acquireCRL(ctx context.Context, id string) (lease *crlLease, owner bool, err error) {
+	leases := &c.crlLeases
+	for {
+		leases.mu.Lock()
+		if leases.leases == nil {
+			leases.leases = make(map[string]*crlLease)
+		}
+		lease, ok := leases.leases[id]
+		if ok && lease.removed != nil {
+			leases.mu.Unlock()
+			select {
+			case <-lease.removed:
+			case <-ctx.Done():
+				return nil, false, ctx.Err()
+			}
+			continue
+		}
+		if !ok {
+			lease = &crlLease{installed: make(chan struct{})}
+			leases.leases[id] = lease
+		}
+		lease.refs++
+		leases.mu.Unlock()
+		return lease, !ok, nil
+	}
+}
+
+// releaseCRL уменьшает счетчик использования CRL id и удаляет его из хранилища store,
+// если его больше не использует ни одна проверка и он был установлен installCRLs.
+// Ошибка удаления только записывается в лог
+func (c *CryptoCLI) releaseCRL(ctx context.Context, store string, id string) {
+	leases := &c.crlLeases
+	leases.mu.Lock()
+	lease := leases.leases[id]
+	lease.refs--
+	if lease.refs > 0 {
+		leases.mu.Unlock()
+		return
+	}
+	if lease.err != nil || lease.preinstalled {
+		delete(leases.leases, id)
+		leases.mu.Unlock()
+		return
+	}
+	lease.removed = make(chan struct{})
+	leases.mu.Unlock()
+
+	// Удаление выполняется и после отмены контекста проверки
+	_, stderr, err := c.runCertmgr(context.WithoutCancel(ctx),
+		"-delete",
+		"-crl",
+		"-store", store,
+		"-thumbprint", id,
+	)
+	if err != nil {
+		c.log(ctx).Warn("failed to remove offline CRL from store",
+			"thumbprint", id,
+			"store", store,
+			"error", err,
+			"stderr", stderr)
+	}
+
+	leases.mu.Lock()
+	delete(leases.leases, id)
+	leases.mu.Unlock()
+	close(lease.removed)
+}
+
+// installCRLFile устанавливает список отзыва (DER) в указанное хранилище
+func (c *CryptoCLI) installCRLFile(ctx context.Context, store string, der []byte) error {
+	workDir, err := c.newWorkDirIn(c.installTmpBase())
+	if err != nil {
+		return fmt.Errorf("create work directory: %v", err)
+	}
+	defer c.removeWorkDir(workDir)
+
+	crlFilePath := filepath.Join(workDir, "list.crl")
+	err = c.fileSystem.WriteFile(crlFilePath, der, 0600)
+	if err != nil {
+		return fmt.Errorf("write file: %v", err)
+	}
+
+	_, stderr, err := c.runCertmgr(ctx,
+		"-install",
+		"-crl",
+		"-store", store,
+		"-file", crlFilePath,
+	)
+	if err != nil {
+		return fmt.Errorf("certmgr install CRL: %v, stderr: %s", err, stderr)
+	}
+
+	return nil
+}
+
+// checkOfflineCRLs проверяет сертификаты подписантов по спискам отзыва из VerifyWithCRLs
+// и отражает результат в result.Revocation. Сертификат, найденный в CRL своего издателя,
+// делает подпись недействительной независимо от результата cryptcp. Издатель ищется среди
+// сертификатов подписи и intermediates; CRL с непроверенной подписью не учитывается, а если
+// других сведений об отзыве нет, статус отзыва - RevocationUnknown
+func (c *CryptoCLI) checkOfflineCRLs(ctx context.Context, workDir string, result *VerifyResult, signData []byte, crls []*x509.RevocationList, intermediates []*x509.Certificate) {
+	if len(crls) == 0 {
+		return
+	}
+
+	sd, err := parseSignedData(signData)
+	if err != nil {
+		return
+	}
+	signers, err := sd.signers()
+	if err != nil {
+		return
+	}
+
+	pool := append([]*x509.Certificate(nil), intermediates...)
+	for _, der := range sd.certificatesDER() {
+		cert, err := x509.ParseCertificate(der)
+		if err == nil {
+			pool = append(pool, cert)
+		}
+	}
+
+	unverified := false
+	for i := range signers {
+		cert, err := sd.signerCertificate(&signers[i])
+		if err != nil {
+			continue
+		}
+
+		check := c.findInCRLs(ctx, workDir, cert, crlIssuer(cert, pool), crls)
+		unverified = unverified || check.unverified && check.crl == nil
+		if check.crl == nil {
+			continue
+		}
+
+		// Сведения об отзыве указываются по первому подписанту, для которого найден CRL.
+		// Отзыв, обнаруженный cryptcp, сохраняется
+		if result.Revocation == nil || !result.Revocation.OfflineCRL {
+			status := RevocationGood
+			if result.Revocation != nil && result.Revocation.Status == RevocationRevoked {
+				status = RevocationRevoked
+			}
+			result.Revocation = &RevocationInfo{
+				Status:     status,
+				Method:     "crl",
+				Source:     "offline CRL of " + check.crl.Issuer.String(),
+				OfflineCRL: true,
+			}
+		}
+
+		if check.revokedAt != nil {
+			markRevokedByCRL(result, cert, check)
+			c.log(ctx).Warn("signer certificate revoked according to offline CRL",
+				"thumbprint", certThumbprint(cert),
+				"issuer", check.crl.Issuer.String(),
+				"revokedAt", *check.revokedAt)
+			return
+		}
+	}
+
+	// Без проверенного CRL хотя бы одного подписанта "good" по спискам отзыва не указывается
+	if unverified && (result.Revocation == nil || result.Revocation.OfflineCRL ||
+		result.Revocation.Status == RevocationNotChecked) {
+		result.Revocation = &RevocationInfo{
+			Status: RevocationUnknown,
+			Method: "crl",
+			Source: "offline CRL signature not verified",
+		}
+	}
+}
+
+// checkChainCRLs проверяет по спискам отзыва VerifyWithCRLs все сертификаты цепочек chains,
+// кроме доверенных корней: в режиме VerifyWithTrustedRoots cryptcp отзыв не проверяет.
+// Издатель каждого звена известен из цепочки. Статус отзыва - RevocationGood, только если
+// для каждого сертификата найден CRL с проверенной подписью, иначе RevocationUnknown
+func (c *CryptoCLI) checkChainCRLs(ctx context.Context, workDir string, result *VerifyResult, chains [][]*x509.Certificate, crls []*x509.RevocationList) {
+	covered := len(crls) > 0
+	for _, chain := range chains {
+		for i := 0; i+1 < len(chain); i++ {
+			cert := chain[i]
+			check := c.findInCRLs(ctx, workDir, cert, chain[i+1], crls)
+			if check.crl == nil {
+				covered = false
+				continue
+			}
+			if check.revokedAt != nil {
+				markRevokedByCRL(result, cert, check)
+				c.log(ctx).Warn("chain certificate revoked according to offline CRL",
+					"thumbprint", certThumbprint(cert),
+					"issuer", check.crl.Issuer.String(),
+					"revokedAt", *check.revokedAt)
+				return
+			}
+		}
+	}
+
+	switch {
+	case covered:
+		result.Revocation = &RevocationInfo{
+			Status:     RevocationGood,
+			Method:     "crl",
+			Source:     "offline CRLs of the trusted root chain",
+			OfflineCRL: true,
+		}
+	case len(crls) > 0:
+		result.Revocation = &RevocationInfo{
+			Status: RevocationUnknown,
+			Method: "crl",
+			Source: "offline CRLs do not cover every certificate of the trusted root chain",
+		}
+	default:
+		result.Revocation = &RevocationInfo{
+			Status: RevocationUnknown,
+			Source: "revocation is checked only by VerifyWithCRLs with trusted roots",
+		}
+	}
+}
+
+// markRevokedByCRL делает подпись недействительной из-за отзыва сертификата cert по check.crl
+func markRevokedByCRL(result *VerifyResult, cert *x509.Certificate, check crlCheck) {
+	result.Revocation = &RevocationInfo{
+		Status:     RevocationRevoked,
+		Method:     "crl",
+		Source:     "offline CRL of " + check.crl.Issuer.String(),
+		OfflineCRL: true,
+	}
+	result.Valid = false
+	result.Failure = FailureCertificate
+	result.Content = nil
+	result.Error = fmt.Sprintf("certificate %s (%s) revoked at %s according to offline CRL of %s",
+		cert.Subject, certThumbprint(cert), check.revokedAt.Format(time.RFC3339), check.crl.Issuer)
+}
+
+// crlIssuer возвращает возможного издателя cert из pool (isIssuerCandidate), nil - если его нет
+func crlIssuer(cert *x509.Certificate, pool []*x509.Certificate) *x509.Certificate {
+	for _, issuer := range pool {
+		if isIssuerCandidate(cert, issuer) {
+			return issuer
+		}
+	}
+	return nil
+}
+
+// crlCheck результат сверки сертификата со списками отзыва его издателя
+type crlCheck struct {
+	crl        *x509.RevocationList // CRL издателя с проверенной подписью, nil - такого нет
+	revokedAt  *time.Time           // Время отзыва по crl, nil - сертификат не отозван
+	unverified bool                 // Найден CRL издателя, подпись которого не удалось проверить
+}
+
+// findInCRLs находит CRL издателя cert с подписью issuer и время отзыва cert в нем.
+// CRL, подпись которого неверна или не может быть проверена (издатель неизвестен,
+// фиктивный бэкенд), пропускается с unverified
+func (c *CryptoCLI) findInCRLs(ctx context.Context, workDir string, cert *x509.Certificate, issuer *x509.Certificate, crls []*x509.RevocationList) crlCheck {
+	var check crlCheck
+	for _, crl := range crls {
+		if !bytes.Equal(crl.RawIssuer, cert.RawIssuer) {
+			continue
+		}
+		if len(crl.AuthorityKeyId) > 0 && len(cert.AuthorityKeyId) > 0 &&
+			!bytes.Equal(crl.AuthorityKeyId, cert.AuthorityKeyId) {
+			continue
+		}
+
+		err := c.checkCRLSignature(ctx, workDir, crl, issuer)
+		if err != nil {
+			c.log(ctx).Warn("offline CRL skipped, its signature is not verified",
+				"issuer", crl.Issuer.String(),
+				"error", err)
+			check.unverified = true
+			continue
+		}
+
+		check.crl = crl
+		for _, entry := range crl.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				revokedAt := entry.RevocationTime
+				check.revokedAt = &revokedAt
+				break
+			}
+		}
+		return check
+	}
+	return check
+}
+
+// checkCRLSignature проверяет подпись CRL ключом issuer. Алгоритмы, которые поддерживает Go,
+// проверяются в процессе, подписи ГОСТ - через cryptcp (verifySignedObjectCSP), как звенья
+// цепочки в checkIssuedBy
+func (c *CryptoCLI) checkCRLSignature(ctx context.Context, workDir string, crl *x509.RevocationList, issuer *x509.Certificate) error {
+	if issuer == nil {
+		return errors.New("CRL issuer certificate is not available")
+	}
+	err := crl.CheckSignatureFrom(issuer)
+	if !errors.Is(err, x509.ErrUnsupportedAlgorithm) {
+		return err
+	}
+	if c.fakeBackend {
+		return fmt.Errorf("fake backend cannot check %s CRL signature", crl.SignatureAlgorithm)
+	}
+
+	sum := sha1.Sum(crl.Raw)
+	return c.verifySignedObjectCSP(ctx, workDir, "crl_"+hex.EncodeToString(sum[:]), crl.Raw, issuer)
+}
@@ -0,0 +1,310 @@
+package cprovlib
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA сертификат и ключ тестового УЦ
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+// issue выпускает сертификат подписанта с серийным номером serial
+func (ca *testCA) issue(t *testing.T, serial int64) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// crl выпускает список отзыва УЦ с отозванными серийными номерами revoked
+func (ca *testCA) crl(t *testing.T, revoked ...int64) *x509.RevocationList {
+	t.Helper()
+	template := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Hour),
+		NextUpdate: time.Now().Add(time.Hour),
+	}
+	for _, serial := range revoked {
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   big.NewInt(serial),
+			RevocationTime: time.Now().Add(-time.Minute).UTC().Truncate(time.Second),
+		})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, template, ca.cert, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crl
+}
+
+func TestFindInCRLs(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	// Другой УЦ с тем же именем: его ключ не подписывал CRL
+	impostor := newTestCA(t, "Test CA")
+	signer := ca.issue(t, 10)
+
+	tests := []struct {
+		name           string
+		issuer         *x509.Certificate
+		crls           []*x509.RevocationList
+		wantCRL        bool
+		wantRevoked    bool
+		wantUnverified bool
+	}{
+		{name: "not revoked", issuer: ca.cert, crls: []*x509.RevocationList{ca.crl(t, 11)}, wantCRL: true},
+		{name: "revoked", issuer: ca.cert, crls: []*x509.RevocationList{ca.crl(t, 11, 10)}, wantCRL: true, wantRevoked: true},
+		{name: "no CRL of issuer", issuer: ca.cert, crls: nil},
+		{name: "issuer unknown", issuer: nil, crls: []*x509.RevocationList{ca.crl(t, 10)}, wantUnverified: true},
+		{name: "signed by another key", issuer: impostor.cert, crls: []*x509.RevocationList{ca.crl(t, 10)}, wantUnverified: true},
+		{
+			// Идентификатор ключа CRL другого УЦ не совпадает с AuthorityKeyId подписанта
+			name:        "CRL of another key ignored",
+			issuer:      ca.cert,
+			crls:        []*x509.RevocationList{impostor.crl(t), ca.crl(t, 10)},
+			wantCRL:     true,
+			wantRevoked: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New("uMy", nil, 0, &DefaultLogger{}, false)
+			check := c.findInCRLs(context.Background(), t.TempDir(), signer, tt.issuer, tt.crls)
+
+			if (check.crl != nil) != tt.wantCRL {
+				t.Errorf("crl found = %v, want %v", check.crl != nil, tt.wantCRL)
+			}
+			if (check.revokedAt != nil) != tt.wantRevoked {
+				t.Errorf("revoked = %v, want %v", check.revokedAt != nil, tt.wantRevoked)
+			}
+			if check.unverified != tt.wantUnverified {
+				t.Errorf("unverified = %v, want %v", check.unverified, tt.wantUnverified)
+			}
+		})
+	}
+}
+
+func TestCheckChainCRLs(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	other := newTestCA(t, "Other CA")
+	signer := ca.issue(t, 10)
+	chain := []*x509.Certificate{signer, ca.cert}
+
+	tests := []struct {
+		name       string
+		crls       []*x509.RevocationList
+		wantValid  bool
+		wantStatus RevocationStatus
+	}{
+		// Без CRL отзыв в режиме доверенных корней не проверен: статус явно неизвестен
+		{name: "no CRLs", crls: nil, wantValid: true, wantStatus: RevocationUnknown},
+		{name: "chain covered", crls: []*x509.RevocationList{ca.crl(t, 11)}, wantValid: true, wantStatus: RevocationGood},
+		{name: "CRL of another CA", crls: []*x509.RevocationList{other.crl(t, 10)}, wantValid: true, wantStatus: RevocationUnknown},
+		{name: "signer revoked", crls: []*x509.RevocationList{ca.crl(t, 10)}, wantValid: false, wantStatus: RevocationRevoked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New("uMy", nil, 0, &DefaultLogger{}, false)
+			result := &VerifyResult{Valid: true}
+			c.checkChainCRLs(context.Background(), t.TempDir(), result, [][]*x509.Certificate{chain}, tt.crls)
+
+			if result.Valid != tt.wantValid {
+				t.Errorf("valid = %v, want %v (%s)", result.Valid, tt.wantValid, result.Error)
+			}
+			if result.Revocation == nil {
+				t.Fatal("revocation status is not set")
+			}
+			if result.Revocation.Status != tt.wantStatus {
+				t.Errorf("revocation status = %v, want %v", result.Revocation.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// fakeCRLCertmgr пишет certmgr, который записывает аргументы в лог и выводит в -list
+// отпечатки listed
+func fakeCRLCertmgr(t *testing.T, listed ...string) (path string, log string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake certmgr is a shell script")
+	}
+
+	dir := t.TempDir()
+	log = filepath.Join(dir, "args.log")
+	script := "#!/bin/sh\necho \"$@\" >> " + log + "\n"
+	script += "case \"$1\" in -list)\n"
+	if len(listed) == 0 {
+		script += "  echo '[ErrorCode: 0x8010002c]'; exit 1;;\n"
+	} else {
+		for i, thumbprint := range listed {
+			script += "  echo '" + string(rune('1'+i)) + "-------'; echo 'SHA1 Hash : 0x" + strings.ToUpper(thumbprint) + "';\n"
+		}
+		script += "  ;;\n"
+	}
+	script += "esac\n"
+
+	path = filepath.Join(dir, "certmgr")
+	err := os.WriteFile(path, []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, log
+}
+
+func crlThumbprint(crl *x509.RevocationList) string {
+	sum := sha1.Sum(crl.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestInstallCRLs(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	own := ca.crl(t, 1)
+	operator := ca.crl(t, 2)
+
+	tests := []struct {
+		name     string
+		listed   []string
+		wantArgs []string // Операции certmgr без аргумента -file
+	}{
+		{
+			name: "empty store",
+			wantArgs: []string{
+				"-list -crl -store uCA",
+				"-install -crl -store uCA",
+				"-install -crl -store uCA",
+				"-delete -crl -store uCA -thumbprint " + crlThumbprint(own),
+				"-delete -crl -store uCA -thumbprint " + crlThumbprint(operator),
+			},
+		},
+		{
+			name:   "operator CRL kept",
+			listed: []string{crlThumbprint(operator)},
+			wantArgs: []string{
+				"-list -crl -store uCA",
+				"-install -crl -store uCA",
+				"-delete -crl -store uCA -thumbprint " + crlThumbprint(own),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certmgrPath, log := fakeCRLCertmgr(t, tt.listed...)
+			c := New("uMy", nil, 0, &DefaultLogger{}, false, WithTmpDir(t.TempDir()))
+			c.certmgrPath = certmgrPath
+
+			release, err := c.installCRLs(context.Background(), []*x509.RevocationList{own, operator})
+			if err != nil {
+				t.Fatalf("installCRLs: %v", err)
+			}
+			release()
+
+			data, err := os.ReadFile(log)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+				operation, _, _ := strings.Cut(line, " -file ")
+				got = append(got, operation)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.wantArgs, "\n") {
+				t.Fatalf("certmgr calls:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.wantArgs, "\n"))
+			}
+			if len(c.crlLeases.leases) != 0 {
+				t.Fatalf("%d CRL leases left after release", len(c.crlLeases.leases))
+			}
+		})
+	}
+}
+
+func TestInstallCRLsWaitRespectsContext(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	crl := ca.crl(t)
+	c := New("uMy", nil, 0, &DefaultLogger{}, false)
+
+	// Другая проверка устанавливает тот же CRL и зависла в certmgr
+	lease, owner, err := c.acquireCRL(context.Background(), crlThumbprint(crl))
+	if err != nil || !owner {
+		t.Fatalf("acquireCRL: owner %v, error %v", owner, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = c.installCRLs(ctx, []*x509.RevocationList{crl})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("installCRLs error %v, want context.DeadlineExceeded", err)
+	}
+
+	c.crlLeases.mu.Lock()
+	refs := lease.refs
+	c.crlLeases.mu.Unlock()
+	if refs != 1 {
+		t.Fatalf("lease refs %d after cancelled wait, want 1", refs)
+	}
+}
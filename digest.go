@@ -0,0 +1,116 @@
+package cprovlib
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// ErrDigestIncompatible алгоритм хэша подписи не поддерживается ключом подписанта
+var ErrDigestIncompatible = errors.New("алгоритм хэша несовместим с ключом подписанта")
+
+// DigestAlgorithm алгоритм хэша подписываемого документа (WithDocumentDigest)
+// или хэша подписи (SignWithDigestAlgorithm)
+type DigestAlgorithm string
+
+const (
+	DigestSHA256      DigestAlgorithm = "sha256"            // SHA-256
+	DigestGOST2012256 DigestAlgorithm = "gost3411-2012-256" // ГОСТ Р 34.11-2012, 256 бит (cryptcp -hash)
+	DigestGOST2012512 DigestAlgorithm = "gost3411-2012-512" // ГОСТ Р 34.11-2012, 512 бит (cryptcp -hash)
+)
+
+// documentDigests вычисляет хэши документа подписи алгоритмами WithDocumentDigest
+// и записывает их в лог. Хэш вычисляется от того же файла, который подписывает cryptcp
+func (c *CryptoCLI) documentDigests(ctx context.Context, input *signInput) (map[DigestAlgorithm]string, error) {
+	digests := make(map[DigestAlgorithm]string, len(c.documentDigest))
+
+	for _, algorithm := range c.documentDigest {
+		switch algorithm {
+		case DigestSHA256:
+			digest, err := c.hashFileSHA256(input.filePath())
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrHash, err)
+			}
+			digests[algorithm] = digest
+
+		case DigestGOST2012256, DigestGOST2012512:
+			// Без КриптоПро хэш ГОСТ вычислить нечем
+			if c.fakeBackend {
+				c.log(ctx).Warn("FAKE BACKEND: GOST document digest skipped",
+					"algorithm", algorithm)
+				continue
+			}
+			bits := 256
+			if algorithm == DigestGOST2012512 {
+				bits = 512
+			}
+			digest, err := c.hashFileGOST(ctx, input.workDir, input.dataFile, gostHashAlgorithms[bits], bits/8)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrHash, algorithm, err)
+			}
+			digests[algorithm] = digest
+
+		default:
+			return nil, fmt.Errorf("%w: unsupported digest algorithm %q", ErrHash, algorithm)
+		}
+	}
+
+	c.log(ctx).Info("document digest computed",
+		"thumbprint", input.thumbprint,
+		"digests", digests)
+
+	return digests, nil
+}
+
+// hashFileSHA256 вычисляет SHA-256 файла path потоком, не читая документ в память целиком
+func (c *CryptoCLI) hashFileSHA256(path string) (string, error) {
+	f, err := c.openFile(path)
+	if err != nil {
+		return "", fmt.Errorf("open data file: %v", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", fmt.Errorf("read data file: %v", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// signDigestAlgorithms алгоритмы хэша подписи, допустимые для ключей каждого типа провайдера.
+// С ключом ГОСТ Р 34.10-2012 256 бит КриптоПро позволяет хэш 512 бит, с ключом 512 бит -
+// только хэш 512 бит; с ключами ГОСТ Р 34.10-2001 хэши ГОСТ Р 34.11-2012 не используются
+var signDigestAlgorithms = map[int][]DigestAlgorithm{
+	ProviderTypeGOST2012256: {DigestGOST2012256, DigestGOST2012512},
+	ProviderTypeGOST2012512: {DigestGOST2012512},
+}
+
+// digestAlgorithmArgs возвращает аргументы cryptcp -hashAlg для хэша подписи algorithm,
+// предварительно проверив, что алгоритм совместим с ключом сертификата thumbprint
+func (c *CryptoCLI) digestAlgorithmArgs(ctx context.Context, thumbprint string, algorithm DigestAlgorithm) ([]string, error) {
+	var hashAlg string
+	switch algorithm {
+	case DigestGOST2012256:
+		hashAlg = gostHashAlgorithms[256]
+	case DigestGOST2012512:
+		hashAlg = gostHashAlgorithms[512]
+	default:
+		return nil, fmt.Errorf("%w: %q is not a signature digest algorithm", ErrDigestIncompatible, algorithm)
+	}
+
+	providerType := c.detectProviderType(ctx, thumbprint)
+	if providerType == 0 {
+		return nil, fmt.Errorf("%w: key algorithm of certificate %s is unknown", ErrDigestIncompatible, thumbprint)
+	}
+	if !slices.Contains(signDigestAlgorithms[providerType], algorithm) {
+		return nil, fmt.Errorf("%w: %s with key of provider type %d (certificate %s)",
+			ErrDigestIncompatible, algorithm, providerType, thumbprint)
+	}
+
+	return []string{"-hashAlg", hashAlg}, nil
+}
@@ -0,0 +1,48 @@
+package cprovlib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestHashFileSHA256(t *testing.T) {
+	data := make([]byte, 3*defaultWriteBufferSize+17)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	sum := sha256.Sum256(data)
+	want := hex.EncodeToString(sum[:])
+
+	path := filepath.Join(t.TempDir(), "doc.bin")
+	err := os.WriteFile(path, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		fsys FileSystem
+		path string
+	}{
+		{name: "streaming", fsys: osFileSystem{}, path: path},
+		{name: "ReadFile fallback", fsys: &memFileSystem{files: fstest.MapFS{"work/doc.bin": {Data: data}}}, path: "work/doc.bin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New("uMy", nil, 0, &DefaultLogger{}, false, WithFileSystem(tt.fsys))
+
+			got, err := c.hashFileSHA256(tt.path)
+			if err != nil {
+				t.Fatalf("hashFileSHA256: %v", err)
+			}
+			if got != want {
+				t.Fatalf("hashFileSHA256() = %s, want %s", got, want)
+			}
+		})
+	}
+}
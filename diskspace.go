@@ -0,0 +1,37 @@
+package cprovlib
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInsufficientDiskSpace во временной директории недостаточно места для операции
+var ErrInsufficientDiskSpace = errors.New("недостаточно места во временной директории")
+
+// defaultDiskSpaceHeadroom запас свободного места относительно размера документа по умолчанию:
+// документ, подпись (для attached включает документ) и служебные файлы cryptcp
+const defaultDiskSpaceHeadroom = 3.0
+
+// checkDiskSpace проверяет, что во временной директории dir достаточно свободного места
+// для документа размером size байт с учетом запаса WithDiskSpaceHeadroom
+func (c *CryptoCLI) checkDiskSpace(dir string, size int64) error {
+	if c.diskSpaceHeadroom <= 0 {
+		return nil
+	}
+
+	free, err := freeDiskSpace(dir)
+	if err != nil {
+		// Не мешаем операции, если свободное место определить не удалось
+		c.logger.Debug("free disk space check skipped",
+			"tmpDir", dir,
+			"error", err)
+		return nil
+	}
+
+	required := uint64(float64(size) * c.diskSpaceHeadroom)
+	if free < required {
+		return fmt.Errorf("%w: %s: %d bytes free, %d bytes required", ErrInsufficientDiskSpace, dir, free, required)
+	}
+
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !(linux || darwin || freebsd)
+
+package cprovlib
+
+import (
+	"errors"
+)
+
+// freeDiskSpace на остальных платформах не поддерживается, проверка места пропускается
+func freeDiskSpace(dir string) (uint64, error) {
+	return 0, errors.New("free disk space is not supported on this platform")
+}
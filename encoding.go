@@ -0,0 +1,36 @@
+package cprovlib
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// cp1251High символы Windows-1251 в диапазоне 0x80-0xBF (0xC0-0xFF соответствуют А-я)
+var cp1251High = [64]rune{
+	'Ђ', 'Ѓ', '‚', 'ѓ', '„', '…', '†', '‡', '€', '‰', 'Љ', '‹', 'Њ', 'Ќ', 'Ћ', 'Џ',
+	'ђ', '‘', '’', '“', '”', '•', '–', '—', utf8.RuneError, '™', 'љ', '›', 'њ', 'ќ', 'ћ', 'џ',
+	' ', 'Ў', 'ў', 'Ј', '¤', 'Ґ', '¦', '§', 'Ё', '©', 'Є', '«', '¬', '­', '®', 'Ї',
+	'°', '±', 'І', 'і', 'ґ', 'µ', '¶', '·', 'ё', '№', 'є', '»', 'ј', 'Ѕ', 'ѕ', 'ї',
+}
+
+// decodeCP1251 преобразует текст в кодировке Windows-1251 в UTF-8.
+// Если текст уже является корректным UTF-8, он возвращается без изменений
+func decodeCP1251(b []byte) string {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(b) * 2)
+	for _, ch := range b {
+		switch {
+		case ch < 0x80:
+			sb.WriteByte(ch)
+		case ch < 0xC0:
+			sb.WriteRune(cp1251High[ch-0x80])
+		default:
+			sb.WriteRune(rune(ch) - 0xC0 + 'А')
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package cprovlib
+
+// decodeOutput преобразует вывод утилит КриптоПро в UTF-8.
+// На Linux и macOS утилиты выводят UTF-8, преобразование не требуется
+func decodeOutput(b []byte) string {
+	return string(b)
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package cprovlib
+
+// decodeOutput преобразует вывод утилит КриптоПро в UTF-8.
+// КриптоПро CSP для Windows выводит сообщения в кодировке cp1251
+func decodeOutput(b []byte) string {
+	return decodeCP1251(b)
+}
@@ -0,0 +1,143 @@
+package cprovlib
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrTSACertificate сертификат службы временных меток просрочен или не проходит проверку цепочки.
+	// Повтор с тем же сервером не поможет, сервер следует убрать из списка
+	ErrTSACertificate = errors.New("недействительный сертификат службы временных меток")
+
+	// ErrLicenseExpired лицензия КриптоПро CSP истекла или не установлена: все операции
+	// завершаются ошибкой до установки действующей лицензии, повтор бесполезен
+	ErrLicenseExpired = errors.New("лицензия КриптоПро истекла или отсутствует")
+
+	// ErrClockSkew TSP сервер отклонил запрос из-за расхождения системных часов с его временем.
+	// Повтор и другой TSP сервер не помогут, нужно синхронизировать часы (NTP)
+	ErrClockSkew = errors.New("системные часы расходятся со временем TSP сервера")
+)
+
+// signFailure класс ошибки попытки подписи
+type signFailure int
+
+const (
+	failureOther          signFailure = iota // Ошибка, не связанная с TSP сервером
+	failureTSPHTTP                           // HTTP ошибка TSP сервера, повтор может помочь
+	failureTSACertificate                    // Сертификат TSA недействителен, повтор бесполезен
+	failureClockSkew                         // Часы клиента расходятся со временем TSA, повтор бесполезен
+)
+
+// certChainErrorCodes коды ошибок проверки сертификата и цепочки (CERT_E_*, TRUST_E_*, CRYPT_E_*)
+var certChainErrorCodes = []string{
+	"0x800b0101", // CERT_E_EXPIRED
+	"0x800b0102", // CERT_E_VALIDITYPERIODNESTING
+	"0x800b0109", // CERT_E_UNTRUSTEDROOT
+	"0x800b010a", // CERT_E_CHAINING
+	"0x800b010c", // CERT_E_REVOKED
+	"0x800b0110", // CERT_E_WRONG_USAGE
+	"0x80096004", // TRUST_E_CERT_SIGNATURE
+	"0x80092010", // CRYPT_E_REVOKED
+}
+
+// tspMarkers признаки того, что ошибка относится к получению штампа времени.
+// Просто "tsp" не подходит: эта подстрока есть в адресах большинства TSP серверов
+var tspMarkers = []string{"timestamp", "time-stamp", "time stamp", "tsa certificate", "tsp server", "tsp response", "штамп"}
+
+// clockSkewMarkers признаки отказа TSP сервера из-за расхождения времени клиента (в нижнем регистре).
+// RFC 3161 не определяет отдельный код такой ошибки, поэтому серверы сообщают о ней текстом
+var clockSkewMarkers = []string{
+	"clock skew",
+	"time skew",
+	"clock is not synchronized",
+	"time is not synchronized",
+	"time out of sync",
+	"time is out of sync",
+	"request time is too far",
+	"расхождение времени",
+	"время не синхронизировано",
+	"неверное время клиента",
+}
+
+// licenseMarkers признаки ошибки лицензии в выводе утилит КриптоПро (в нижнем регистре)
+var licenseMarkers = []string{
+	"license expired",
+	"license has expired",
+	"license is expired",
+	"license is invalid",
+	"invalid license",
+	"no license",
+	"unlicensed",
+	"лицензия истекла",
+	"истек срок действия лицензии",
+	"срок действия лицензии истек",
+	"лицензия недействительна",
+	"лицензия отсутствует",
+}
+
+// certNotFoundErrorCodes коды ошибок cryptcp, с которыми он сообщает, что сертификат
+// с заданным отпечатком не найден в хранилище. CRYPT_E_NOT_FOUND (0x80092004) сюда не входит:
+// тот же код CSP возвращает при отсутствии CRL, звена цепочки или объекта TSA
+var certNotFoundErrorCodes = []string{
+	"0x2000012d", // Сертификаты не найдены (cryptcp)
+}
+
+// certNotFoundMarkers признаки отсутствия сертификата подписанта в выводе cryptcp (в нижнем регистре).
+// Общее "cannot find object or property" (CRYPT_E_NOT_FOUND) не учитывается по той же причине
+var certNotFoundMarkers = []string{
+	"certificate not found",
+	"certificates not found",
+	"cannot find certificate",
+	"can't find certificate",
+	"no certificate found",
+	"no certificates found",
+	"сертификат не найден",
+	"сертификаты не найдены",
+	"не найден сертификат",
+}
+
+// isCertNotFoundError проверяет, что вывод cryptcp в нижнем регистре сообщает об отсутствии
+// сертификата подписанта в хранилище
+func isCertNotFoundError(output string) bool {
+	return containsAny(output, certNotFoundErrorCodes) || containsAny(output, certNotFoundMarkers)
+}
+
+// isLicenseError проверяет, что вывод утилиты в нижнем регистре сообщает об ошибке лицензии
+func isLicenseError(output string) bool {
+	return containsAny(output, licenseMarkers)
+}
+
+// classifySignFailure определяет класс ошибки по выводу cryptcp в нижнем регистре.
+// Ошибка цепочки считается ошибкой сертификата TSA, только если в выводе упоминается
+// штамп времени: такая же ошибка для сертификата подписанта - отдельный случай
+func classifySignFailure(errorText string, useTSP bool) signFailure {
+	if !useTSP {
+		return failureOther
+	}
+
+	if containsAny(errorText, clockSkewMarkers) {
+		return failureClockSkew
+	}
+
+	if containsAny(errorText, tspMarkers) &&
+		(containsAny(errorText, certChainErrorCodes) || strings.Contains(errorText, "expired")) {
+		return failureTSACertificate
+	}
+
+	if strings.Contains(errorText, "http error") {
+		return failureTSPHTTP
+	}
+
+	return failureOther
+}
+
+// containsAny проверяет, содержит ли s хотя бы одну из подстрок
+func containsAny(s string, substrings []string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+package cprovlib
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// fakeSignatureHeader начало подписи, созданной WithFakeBackend. Подпись не является CMS
+// и не принимается ни одной настоящей системой проверки
+const fakeSignatureHeader = "CPROVLIB FAKE SIGNATURE - NOT FOR PRODUCTION\n"
+
+// fakeBackendEnv переменная окружения, без которой WithFakeBackend не включает фиктивный бэкенд
+const fakeBackendEnv = "CPROVLIB_FAKE_BACKEND"
+
+// fakeBackendAllowed проверяет, что фиктивный бэкенд разрешен окружением процесса
+func fakeBackendAllowed() bool {
+	return os.Getenv(fakeBackendEnv) == "1"
+}
+
+// fakeSigner имя подписанта в результатах проверки фиктивной подписи
+const fakeSigner = "CN=cprovlib fake backend"
+
+// fakeSignature фиктивная подпись WithFakeBackend
+type fakeSignature struct {
+	thumbprint string
+	signType   uint
+	digest     string // SHA-256 подписанных данных (hex)
+	content    []byte // Данные присоединенной подписи
+	attached   bool
+}
+
+// encode возвращает подпись в виде текстового заголовка; данные присоединенной подписи
+// следуют после заголовка. Подпись одних данных одним сертификатом всегда одинакова
+func (s *fakeSignature) encode() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(fakeSignatureHeader)
+	fmt.Fprintf(&buf, "thumbprint: %s\nsignType: %d\nsha256: %s\n", s.thumbprint, s.signType, s.digest)
+	if s.attached {
+		buf.WriteString("content:\n")
+		buf.Write(s.content)
+	}
+	return buf.Bytes()
+}
+
+// isFakeSignature проверяет, что подпись создана WithFakeBackend
+func isFakeSignature(signData []byte) bool {
+	return bytes.HasPrefix(signData, []byte(fakeSignatureHeader))
+}
+
+// parseFakeSignature разбирает подпись, созданную WithFakeBackend
+func parseFakeSignature(signData []byte) (*fakeSignature, error) {
+	if !isFakeSignature(signData) {
+		return nil, errors.New("not a fake backend signature")
+	}
+
+	rest := signData[len(fakeSignatureHeader):]
+	s := &fakeSignature{}
+	for len(rest) > 0 {
+		line, tail, found := bytes.Cut(rest, []byte("\n"))
+		if !found {
+			return nil, errors.New("malformed fake signature")
+		}
+		rest = tail
+
+		key, value, _ := bytes.Cut(line, []byte(": "))
+		switch string(key) {
+		case "thumbprint":
+			s.thumbprint = string(value)
+		case "signType":
+			signType, err := strconv.ParseUint(string(value), 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("malformed fake signature type: %v", err)
+			}
+			s.signType = uint(signType)
+		case "sha256":
+			s.digest = string(value)
+		case "content:":
+			s.attached = true
+			s.content = rest
+			rest = nil
+		}
+	}
+
+	if s.thumbprint == "" || s.digest == "" {
+		return nil, errors.New("malformed fake signature")
+	}
+	return s, nil
+}
+
+// fakeDigest возвращает SHA-256 данных в hex
+func fakeDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// fakeSign создает фиктивную подпись документа input.dataFile без вызова cryptcp (WithFakeBackend)
+func (c *CryptoCLI) fakeSign(ctx context.Context, input *signInput) (*SignResult, error) {
+	data, err := c.fileSystem.ReadFile(input.filePath())
+	if err != nil {
+		return nil, fmt.Errorf("%w: read data file: %v", ErrSignature, err)
+	}
+
+	signType := c.settings().SignType
+	if input.signType != nil {
+		signType = *input.signType
+	}
+
+	signature := &fakeSignature{
+		thumbprint: input.thumbprint,
+		signType:   signType,
+		digest:     fakeDigest(data),
+		content:    data,
+		attached:   input.isAttached,
+	}
+
+	c.log(ctx).Warn("FAKE BACKEND: signature is not real and must not be used in production",
+		"thumbprint", input.thumbprint,
+		"signType", signType)
+
+	signingTime, _ := c.trustedNow()
+	result := &SignResult{
+		Thumbprint:   input.thumbprint,
+		SignType:     signType,
+		Attached:     input.isAttached,
+		Mode:         SignModeDetached,
+		SigningTime:  signingTime,
+		Timings:      SignTimings{WriteFile: input.writeDuration},
+		SignatureDER: signature.encode(),
+		OperationID:  contextCorrelationID(ctx),
+	}
+	if input.isAttached {
+		result.Mode = SignModeEnveloping
+	}
+	result.Duration = time.Since(input.startTime)
+
+	return result, nil
+}
+
+// fakeVerify проверяет фиктивную подпись WithFakeBackend: подпись действительна, если она
+// создана фиктивным бэкендом для этих данных. Настоящие подписи CMS считаются недействительными
+func (c *CryptoCLI) fakeVerify(ctx context.Context, workDir string, dataFile string, signData []byte) (*VerifyResult, error) {
+	startTime := time.Now()
+	result := &VerifyResult{}
+
+	c.log(ctx).Warn("FAKE BACKEND: signature verification is not real and must not be used in production")
+
+	signature, err := parseFakeSignature(signData)
+	if err != nil {
+		result.Error = fmt.Sprintf("fake backend cannot verify this signature: %v", err)
+		result.Failure = FailureMalformed
+		result.Duration = time.Since(startTime)
+		return result, nil
+	}
+
+	var data []byte
+	switch {
+	case signature.attached:
+		data = signature.content
+	case dataFile != "":
+		path := dataFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(workDir, dataFile)
+		}
+		data, err = c.fileSystem.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: read data file: %v", ErrVerification, err)
+		}
+	default:
+		result.Error = "detached fake signature requires the signed data"
+		result.Duration = time.Since(startTime)
+		return result, nil
+	}
+
+	if fakeDigest(data) != signature.digest {
+		result.Error = "fake signature does not match the data"
+		result.Failure = FailureDataMismatch
+		result.Duration = time.Since(startTime)
+		return result, nil
+	}
+
+	result.Valid = true
+	if signature.attached {
+		result.Content = signature.content
+	}
+	result.Signers = []SignerInfo{{
+		Thumbprint: signature.thumbprint,
+		Subject:    fakeSigner,
+		Issuer:     fakeSigner,
+		CommonName: "cprovlib fake backend",
+	}}
+	result.SignerResults = []SignerResult{{
+		Thumbprint: signature.thumbprint,
+		Subject:    fakeSigner,
+		Valid:      true,
+	}}
+	result.Duration = time.Since(startTime)
+	return result, nil
+}
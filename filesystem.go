@@ -0,0 +1,86 @@
+package cprovlib
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// ErrPersistentTmpDir временная директория находится не в памяти (tmpfs), хотя это требуется
+// WithRequireTmpfs
+var ErrPersistentTmpDir = errors.New("временная директория не находится в памяти")
+
+// FileSystem файловые операции с рабочими директориями и временными файлами клиента.
+// cryptcp и certmgr работают с файлами по путям, поэтому реализация должна хранить файлы
+// по настоящим путям в tmpDir: например, перехватывать операции для аудита или шифрования
+// имен, но не подменять файлы только в памяти процесса
+type FileSystem interface {
+	MkdirTemp(dir string, pattern string) (string, error)
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	ReadFile(name string) ([]byte, error)
+	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	RemoveAll(path string) error
+}
+
+// osFileSystem FileSystem поверх пакета os
+type osFileSystem struct{}
+
+func (osFileSystem) MkdirTemp(dir string, pattern string) (string, error) {
+	return os.MkdirTemp(dir, pattern)
+}
+
+func (osFileSystem) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+
+func (osFileSystem) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (osFileSystem) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (osFileSystem) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+// checkTmpfs проверяет, что временная директория dir находится в памяти (tmpfs или ramfs),
+// если это требуется WithRequireTmpfs
+func (c *CryptoCLI) checkTmpfs(dir string) error {
+	if !c.requireTmpfs {
+		return nil
+	}
+
+	inMemory, err := isMemoryFileSystem(dir)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrPersistentTmpDir, dir, err)
+	}
+	if !inMemory {
+		return fmt.Errorf("%w: %s", ErrPersistentTmpDir, dir)
+	}
+	return nil
+}
+
+// signTmpBase возвращает временную директорию операций подписи (WithSignTmpDir или tmpDir)
+func (c *CryptoCLI) signTmpBase() string {
+	if c.signTmpDir != "" {
+		return c.signTmpDir
+	}
+	return c.tmpDir
+}
+
+// installTmpBase возвращает временную директорию установки сертификатов
+// (WithInstallTmpDir или tmpDir)
+func (c *CryptoCLI) installTmpBase() string {
+	if c.installTmpDir != "" {
+		return c.installTmpDir
+	}
+	return c.tmpDir
+}
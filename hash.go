@@ -0,0 +1,116 @@
+package cprovlib
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+)
+
+// ErrHash ошибка вычисления хэша документа
+var ErrHash = errors.New("ошибка вычисления хэша")
+
+// OID алгоритмов хэширования ГОСТ Р 34.11-2012 для cryptcp -hashAlg
+var gostHashAlgorithms = map[int]string{
+	256: "1.2.643.7.1.1.2.2",
+	512: "1.2.643.7.1.1.2.3",
+}
+
+// HashGOST вычисляет хэш документа по ГОСТ Р 34.11-2012 (bits - 256 или 512) через cryptcp -hash,
+// тем же CSP, что и при подписи, и возвращает его в hex в нижнем регистре.
+// Используется для отпечатков документов в логах и поиска дубликатов без подписи
+func (c *CryptoCLI) HashGOST(ctx context.Context, dataBase64 string, bits int) (string, error) {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "HashGOST")
+	defer span.End()
+
+	hashAlg, ok := gostHashAlgorithms[bits]
+	if !ok {
+		return "", fmt.Errorf("%w: unsupported digest size %d, expected 256 or 512", ErrHash, bits)
+	}
+
+	err := c.checkDocumentSize(dataBase64)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrHash, err)
+	}
+
+	doc, err := c.base64Document(dataBase64)
+	if err != nil {
+		return "", fmt.Errorf("%w: base64 decode: %v", ErrHash, err)
+	}
+
+	workDir, err := c.newWorkDir()
+	if err != nil {
+		return "", fmt.Errorf("%w: create work directory: %v", ErrHash, err)
+	}
+	defer c.removeWorkDir(workDir)
+
+	dataFile, err := c.writeDocument(workDir, "data_*.txt", doc)
+	if err != nil {
+		return "", fmt.Errorf("%w: write data file: %v", ErrHash, err)
+	}
+
+	digest, err := c.hashFileGOST(ctx, workDir, dataFile, hashAlg, bits/8)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrHash, err)
+	}
+
+	c.log(ctx).Debug("document hash computed",
+		"bits", bits,
+		"size", doc.size)
+
+	return digest, nil
+}
+
+// hashFileGOST вычисляет хэш файла dataFile (имя в workDir или абсолютный путь) через
+// cryptcp -hash алгоритмом hashAlg. Файл хэша удаляется, чтобы не остаться в рабочей директории
+func (c *CryptoCLI) hashFileGOST(ctx context.Context, workDir string, dataFile string, hashAlg string, size int) (string, error) {
+	stdout, stderr, err := c.runCryptcp(ctx, workDir,
+		"-hash",
+		"-hashAlg", hashAlg,
+		"-hex",
+		"-dir", workDir,
+		dataFile,
+	)
+	if err == nil && strings.Contains(strings.ToLower(stdout+stderr), "error:") {
+		err = errors.New("cryptcp reported error in output")
+	}
+	if err != nil {
+		return "", fmt.Errorf("cryptcp: %v, stdout: %s, stderr: %s", err, c.logOutput(stdout), c.logOutput(stderr))
+	}
+
+	// cryptcp записывает хэш в файл <документ>.hsh в директории -dir
+	hashFile := filepath.Join(workDir, filepath.Base(dataFile)+".hsh")
+	output, err := c.fileSystem.ReadFile(hashFile)
+	if err != nil {
+		return "", fmt.Errorf("read hash file: %v", err)
+	}
+	_ = c.fileSystem.RemoveAll(hashFile)
+
+	return parseHashOutput(output, size)
+}
+
+// parseHashOutput извлекает хэш размером size байт из файла cryptcp -hash:
+// hex (с -hex), base64 или двоичный вид, если флаг не поддерживается версией cryptcp
+func parseHashOutput(output []byte, size int) (string, error) {
+	if len(output) == size {
+		return hex.EncodeToString(output), nil
+	}
+
+	text := strings.Join(strings.Fields(string(output)), "")
+	if len(text) == 2*size {
+		if raw, err := hex.DecodeString(text); err == nil {
+			return hex.EncodeToString(raw), nil
+		}
+	}
+	if raw, err := base64.StdEncoding.DecodeString(text); err == nil && len(raw) == size {
+		return hex.EncodeToString(raw), nil
+	}
+
+	return "", fmt.Errorf("unexpected hash file content (%d bytes), expected %d byte digest", len(output), size)
+}
@@ -0,0 +1,106 @@
+package cprovlib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+)
+
+// HealthCheck проверяет готовность КриптоПро к операциям: действующую лицензию CSP
+// (cpconfig -license -view), доступность хранилища сертификатов (ValidateStore) и адреса
+// TSP серверов клиента (отброшенные New некорректные адреса возвращаются как ErrInvalidConfig,
+// см. ConfigError).
+// Истекшая или отсутствующая лицензия возвращается как ErrLicenseExpired, чтобы мониторинг
+// обнаружил ее до того, как начнут завершаться ошибкой подписи
+func (c *CryptoCLI) HealthCheck(ctx context.Context) error {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "HealthCheck")
+	defer span.End()
+
+	if c.fakeBackend {
+		c.log(ctx).Warn("FAKE BACKEND: health check skipped, CryptoPro is not used")
+		return nil
+	}
+
+	err := c.ConfigError()
+	if err != nil {
+		return err
+	}
+
+	err = c.checkLicense(ctx)
+	if err != nil {
+		return err
+	}
+
+	return c.ValidateStore(ctx)
+}
+
+// Warmup заранее инициализирует CSP, чтобы первая подпись после старта процесса не была
+// медленнее остальных: перечисляет ключевые контейнеры (загрузка CSP и считывателей),
+// читает хранилище сертификатов и создает рабочую директорию (пул WithWorkDirPool).
+// Вызывается при старте после HealthCheck. Прогрев выполняется по возможности: все шаги
+// выполняются даже после ошибки, ошибки объединяются и не означают, что подпись невозможна
+func (c *CryptoCLI) Warmup(ctx context.Context) error {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "Warmup")
+	defer span.End()
+
+	var errs []error
+
+	workDir, err := c.newWorkDir()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("create work directory: %v", err))
+	} else {
+		c.removeWorkDir(workDir)
+	}
+
+	_, err = c.ListContainers(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	_, err = c.listStore(ctx, c.store)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	err = errors.Join(errs...)
+	if err != nil {
+		c.log(ctx).Warn("CSP warmup incomplete",
+			"error", c.logOutput(err.Error()))
+		return err
+	}
+
+	c.log(ctx).Debug("CSP warmed up")
+	return nil
+}
+
+// checkLicense проверяет лицензию CSP по выводу cpconfig
+func (c *CryptoCLI) checkLicense(ctx context.Context) error {
+	cmd := c.command(ctx, c.cpconfigPath, "-license", "-view")
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := c.run(ctx, cmd)
+	stdoutStr := decodeOutput(stdout.Bytes())
+	stderrStr := decodeOutput(stderr.Bytes())
+	output := strings.ToLower(stdoutStr + "\n" + stderrStr)
+
+	// cpconfig выводит "Expired" вместо срока действия для истекшей лицензии
+	if isLicenseError(output) || strings.Contains(output, "expired") {
+		c.log(ctx).Error("CryptoPro license expired or missing",
+			"output", c.logOutput(stdoutStr+"\n"+stderrStr))
+		return fmt.Errorf("%w: %s", ErrLicenseExpired, strings.TrimSpace(stdoutStr+" "+stderrStr))
+	}
+	if err != nil {
+		return fmt.Errorf("cpconfig license view: %v, stdout: %s, stderr: %s", err, stdoutStr, stderrStr)
+	}
+
+	return nil
+}
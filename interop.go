@@ -0,0 +1,56 @@
+package cprovlib
+
+import (
+	"fmt"
+	"strings"
+)
+
+// normalizeSignatureEncoding перекодирует подпись из BER в DER, если она не в DER:
+// так подписи создают OpenSSL и другие реализации с потоковой обработкой (неопределенная
+// длина, составные OCTET STRING). cryptcp и разбор CMS в библиотеке принимают только DER.
+// Возвращает исходную подпись, если перекодировать нечего или ее не удалось разобрать
+func normalizeSignatureEncoding(signData []byte) ([]byte, bool) {
+	der, changed, err := berToDER(signData)
+	if err != nil || !changed {
+		return signData, false
+	}
+	return der, true
+}
+
+// cmsFormatErrorCodes коды ошибок КриптоПро о структуре сообщения или алгоритме,
+// а не о недействительной подписи: cryptcp не смог разобрать или обработать CMS
+var cmsFormatErrorCodes = map[string]bool{
+	"0x80090008": true, // NTE_BAD_ALGID
+	"0x80091002": true, // CRYPT_E_UNKNOWN_ALGO
+	"0x80091003": true, // CRYPT_E_OID_FORMAT
+	"0x80091004": true, // CRYPT_E_INVALID_MSG_TYPE
+	"0x80091005": true, // CRYPT_E_UNEXPECTED_ENCODING
+	"0x80091006": true, // CRYPT_E_AUTH_ATTR_MISSING
+	"0x80092002": true, // CRYPT_E_BAD_ENCODE
+}
+
+// isCMSFormatErrorCode проверяет, что код ошибки относится к структуре или алгоритму сообщения.
+// Ошибки ASN.1 (CRYPT_E_ASN1_*) занимают диапазон 0x80093100-0x800932ff
+func isCMSFormatErrorCode(code string) bool {
+	return cmsFormatErrorCodes[code] || strings.HasPrefix(code, "0x800931") || strings.HasPrefix(code, "0x800932")
+}
+
+// markUnsupportedCMS отмечает недействительную по cryptcp подпись, которая является корректной
+// CMS (разбирается, сертификаты подписантов найдены), но отклонена из-за структуры или
+// алгоритма: такие подписи создают другие реализации (например, OpenSSL с GOST engine),
+// и причина отличается от неверной подписи
+func (c *CryptoCLI) markUnsupportedCMS(result *VerifyResult, signData []byte) {
+	if result.Valid || !isCMSFormatErrorCode(result.ErrorCode) {
+		return
+	}
+	if _, err := signerThumbprints(signData); err != nil {
+		return
+	}
+
+	result.Unsupported = true
+	result.Failure = FailureMalformed
+	result.Error = fmt.Sprintf("signature is well-formed CMS but uses a structure or algorithm cryptcp does not support (error code %s): %s",
+		result.ErrorCode, result.Error)
+	c.logger.Warn("well-formed CMS signature rejected by cryptcp",
+		"errorCode", result.ErrorCode)
+}
@@ -0,0 +1,308 @@
+package cprovlib
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel"
+)
+
+// ErrInvalidJSON документ не является корректным JSON (I-JSON, RFC 7493)
+var ErrInvalidJSON = errors.New("некорректный JSON")
+
+// SignJSON подписывает JSON документ после канонизации по RFC 8785 (JCS): ключи объектов
+// сортируются, пробелы удаляются, строки и числа приводятся к единому виду. Подпись не зависит
+// от порядка ключей и форматирования, поэтому проверяющая сторона должна канонизировать
+// документ тем же способом (CanonicalizeJSON) перед проверкой отсоединенной подписи.
+// Некорректный JSON возвращает ErrInvalidJSON (обернутую в ErrSignature).
+// Форма и тип подписи определяются так же, как в SignDocument с attachSignature и signType nil
+func (c *CryptoCLI) SignJSON(ctx context.Context, thumbprint string, pin string, jsonBytes []byte, opts ...SignOption) (string, error) {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "SignJSON")
+	defer span.End()
+
+	canonical, err := CanonicalizeJSON(jsonBytes)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrSignature, err)
+	}
+
+	c.stats.signsAttempted.Add(1)
+	result, err := c.recordSign(c.signDocument(ctx, thumbprint, pin, bytesDocument(canonical), nil, nil, opts))
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(result.SignatureDER), nil
+}
+
+// CanonicalizeJSON возвращает каноническое представление JSON документа по RFC 8785 (JCS).
+// Документ должен быть корректным I-JSON: UTF-8, без повторяющихся ключей и непарных
+// суррогатов UTF-16 в строках, числа в пределах float64; иначе возвращается ErrInvalidJSON
+func CanonicalizeJSON(data []byte) ([]byte, error) {
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("%w: invalid UTF-8", ErrInvalidJSON)
+	}
+	if err := checkJSONSurrogates(data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var buf bytes.Buffer
+	err := canonicalizeValue(&buf, decoder)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+	}
+
+	// После значения допускаются только пробельные символы
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("%w: unexpected data after top-level value", ErrInvalidJSON)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// checkJSONSurrogates ищет в строках JSON экранированные суррогаты UTF-16 без пары: encoding/json
+// заменяет их на U+FFFD, и подпись покрыла бы не тот текст, что был передан. Прочие ошибки
+// синтаксиса оставлены декодеру
+func checkJSONSurrogates(data []byte) error {
+	inString := false
+	for i := 0; i < len(data); i++ {
+		switch b := data[i]; {
+		case !inString:
+			inString = b == '"'
+		case b == '"':
+			inString = false
+		case b == '\\':
+			r, ok := jsonEscapeRune(data[i:])
+			if !ok {
+				i++ // Короткое экранирование: пропускаем следующий символ
+				continue
+			}
+			i += 5
+			if !utf16.IsSurrogate(r) {
+				continue
+			}
+			if r >= 0xdc00 {
+				return fmt.Errorf("lone low surrogate \\u%04x", r)
+			}
+			low, ok := jsonEscapeRune(data[i+1:])
+			if !ok || low < 0xdc00 || low > 0xdfff {
+				return fmt.Errorf("lone high surrogate \\u%04x", r)
+			}
+			i += 6
+		}
+	}
+	return nil
+}
+
+// jsonEscapeRune разбирает экранирование \uXXXX в начале s
+func jsonEscapeRune(s []byte) (rune, bool) {
+	if len(s) < 6 || s[0] != '\\' || s[1] != 'u' {
+		return 0, false
+	}
+	value, err := strconv.ParseUint(string(s[2:6]), 16, 16)
+	if err != nil {
+		return 0, false
+	}
+	return rune(value), true
+}
+
+// canonicalizeValue читает из decoder одно значение JSON и записывает его в buf в форме JCS
+func canonicalizeValue(buf *bytes.Buffer, decoder *json.Decoder) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	switch value := token.(type) {
+	case json.Delim:
+		switch value {
+		case '{':
+			return canonicalizeObject(buf, decoder)
+		case '[':
+			return canonicalizeArray(buf, decoder)
+		}
+		return fmt.Errorf("unexpected delimiter %q", value)
+	case string:
+		writeJCSString(buf, value)
+	case json.Number:
+		number, err := formatJCSNumber(value)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(number)
+	case bool:
+		buf.WriteString(strconv.FormatBool(value))
+	case nil:
+		buf.WriteString("null")
+	}
+	return nil
+}
+
+// canonicalizeObject записывает объект с ключами, отсортированными по кодовым единицам UTF-16
+func canonicalizeObject(buf *bytes.Buffer, decoder *json.Decoder) error {
+	type member struct {
+		key   string
+		value []byte
+	}
+
+	var members []member
+	seen := make(map[string]bool)
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return fmt.Errorf("object key is not a string")
+		}
+		if seen[key] {
+			return fmt.Errorf("duplicate object key %q", key)
+		}
+		seen[key] = true
+
+		var value bytes.Buffer
+		if err := canonicalizeValue(&value, decoder); err != nil {
+			return err
+		}
+		members = append(members, member{key: key, value: value.Bytes()})
+	}
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+
+	slices.SortFunc(members, func(a, b member) int {
+		return slices.Compare(utf16.Encode([]rune(a.key)), utf16.Encode([]rune(b.key)))
+	})
+
+	buf.WriteByte('{')
+	for i, m := range members {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeJCSString(buf, m.key)
+		buf.WriteByte(':')
+		buf.Write(m.value)
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// canonicalizeArray записывает массив, сохраняя порядок элементов
+func canonicalizeArray(buf *bytes.Buffer, decoder *json.Decoder) error {
+	buf.WriteByte('[')
+	for i := 0; decoder.More(); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := canonicalizeValue(buf, decoder); err != nil {
+			return err
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+// writeJCSString записывает строку по правилам JSON.stringify: экранируются только кавычка,
+// обратная косая черта и управляющие символы, остальные символы записываются как есть
+func writeJCSString(buf *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[r>>4])
+				buf.WriteByte(hex[r&0xf])
+				continue
+			}
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// formatJCSNumber форматирует число как Number.prototype.toString в ECMAScript:
+// кратчайшее представление float64, экспоненциальная запись вне диапазона [1e-6, 1e21)
+func formatJCSNumber(number json.Number) (string, error) {
+	f, err := strconv.ParseFloat(string(number), 64)
+	if err != nil || math.IsInf(f, 0) {
+		return "", fmt.Errorf("number %s is out of IEEE 754 double range", number)
+	}
+	if f == 0 {
+		return "0", nil
+	}
+
+	sign := ""
+	if f < 0 {
+		sign = "-"
+		f = -f
+	}
+
+	// Кратчайшие цифры и порядок: "d.ddde±XX"
+	mantissa, exponent, _ := strings.Cut(strconv.FormatFloat(f, 'e', -1, 64), "e")
+	digits := strings.Replace(mantissa, ".", "", 1)
+	exp, _ := strconv.Atoi(exponent)
+	k := len(digits)
+	n := exp + 1 // Позиция десятичной точки относительно цифр
+
+	switch {
+	case k <= n && n <= 21:
+		return sign + digits + strings.Repeat("0", n-k), nil
+	case 0 < n && n <= 21:
+		return sign + digits[:n] + "." + digits[n:], nil
+	case -6 < n && n <= 0:
+		return sign + "0." + strings.Repeat("0", -n) + digits, nil
+	}
+
+	expSign := "+"
+	if n-1 < 0 {
+		expSign = "-"
+	}
+	expValue := strconv.Itoa(abs(n - 1))
+	if k == 1 {
+		return sign + digits + "e" + expSign + expValue, nil
+	}
+	return sign + digits[:1] + "." + digits[1:] + "e" + expSign + expValue, nil
+}
+
+// abs возвращает модуль целого числа
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
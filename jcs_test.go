@@ -0,0 +1,125 @@
+package cprovlib
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestCanonicalizeJSONNumbers(t *testing.T) {
+	// RFC 8785, Appendix B: битовое представление IEEE 754 и ожидаемая запись
+	tests := []struct {
+		bits uint64
+		want string
+	}{
+		{0x0000000000000000, "0"},
+		{0x8000000000000000, "0"},
+		{0x0000000000000001, "5e-324"},
+		{0x8000000000000001, "-5e-324"},
+		{0x7fefffffffffffff, "1.7976931348623157e+308"},
+		{0xffefffffffffffff, "-1.7976931348623157e+308"},
+		{0x4340000000000000, "9007199254740992"},
+		{0xc340000000000000, "-9007199254740992"},
+		{0x4430000000000000, "295147905179352830000"},
+		{0x44b52d02c7e14af5, "9.999999999999997e+22"},
+		{0x44b52d02c7e14af6, "1e+23"},
+		{0x44b52d02c7e14af7, "1.0000000000000001e+23"},
+		{0x444b1ae4d6e2ef4e, "999999999999999700000"},
+		{0x444b1ae4d6e2ef4f, "999999999999999900000"},
+		{0x444b1ae4d6e2ef50, "1e+21"},
+		{0x3eb0c6f7a0b5ed8c, "9.999999999999997e-7"},
+		{0x3eb0c6f7a0b5ed8d, "0.000001"},
+		{0x41b3de4355555553, "333333333.3333332"},
+		{0x41b3de4355555554, "333333333.33333325"},
+		{0x41b3de4355555555, "333333333.3333333"},
+		{0x41b3de4355555556, "333333333.3333334"},
+		{0x41b3de4355555557, "333333333.33333343"},
+		{0xbecbf647612f3696, "-0.0000033333333333333333"},
+		{0x43143ff3c1cb0959, "1424953923781206.2"},
+	}
+
+	for _, tt := range tests {
+		// Вход - точная десятичная запись числа, отличная от канонической
+		input := strconv.FormatFloat(math.Float64frombits(tt.bits), 'e', 20, 64)
+		t.Run(tt.want, func(t *testing.T) {
+			got, err := CanonicalizeJSON([]byte(input))
+			if err != nil {
+				t.Fatalf("CanonicalizeJSON(%s): %v", input, err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("CanonicalizeJSON(%s) = %s, want %s", input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			// RFC 8785, 3.2.2
+			name:  "sample",
+			input: `{"numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001], "string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/", "literals": [null, true, false]}`,
+			want:  `{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`,
+		},
+		{
+			// RFC 8785, 3.2.3: сортировка по кодовым единицам UTF-16, эмодзи раньше U+FB33
+			name:  "key ordering",
+			input: `{"\u20ac": "Euro Sign", "\r": "Carriage Return", "\ufb33": "Hebrew Letter Dalet With Dagesh", "1": "One", "\ud83d\ude00": "Emoji: Grinning Face", "\u0080": "Control", "\u00f6": "Latin Small Letter O With Diaeresis"}`,
+			want:  "{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\",\"ö\":\"Latin Small Letter O With Diaeresis\",\"€\":\"Euro Sign\",\"😀\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}",
+		},
+		{
+			name:  "nested",
+			input: " { \"b\" : [ {\"d\":1, \"c\":2} ], \"a\" : {} } ",
+			want:  `{"a":{},"b":[{"c":2,"d":1}]}`,
+		},
+		{
+			// Экранированная обратная косая черта: это текст \ud800, а не суррогат
+			name:  "escaped backslash before u",
+			input: `"\\ud800"`,
+			want:  `"\\ud800"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CanonicalizeJSON([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("CanonicalizeJSON: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("CanonicalizeJSON = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeJSONInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "lone high surrogate", input: `"\ud800"`},
+		{name: "lone low surrogate", input: `"\udc00"`},
+		{name: "high surrogate before text", input: `"\ud800x"`},
+		{name: "high surrogate before BMP escape", input: `"\ud800\u0041"`},
+		{name: "lone surrogate in key", input: `{"\udfff": 1}`},
+		{name: "duplicate key", input: `{"a": 1, "a": 2}`},
+		{name: "number out of range", input: `[1e400]`},
+		{name: "trailing data", input: `{} {}`},
+		{name: "invalid UTF-8", input: "\"\xff\""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CanonicalizeJSON([]byte(tt.input))
+			if !errors.Is(err, ErrInvalidJSON) {
+				t.Fatalf("CanonicalizeJSON(%s) error %v, want ErrInvalidJSON", tt.input, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package cprovlib
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// keyLocks взаимоисключение операций с одним закрытым ключом: аппаратные токены
+// (Рутокен, JaCarta) не поддерживают одновременный доступ к контейнеру
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+// keyLock блокировка одного ключа; refs - количество владельцев и ожидающих
+type keyLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+func newKeyLocks() *keyLocks {
+	return &keyLocks{locks: make(map[string]*keyLock)}
+}
+
+// lock ожидает освобождения ключа key с учетом контекста и возвращает функцию освобождения.
+// Запись удаляется из map, когда ключ никто не удерживает и не ожидает
+func (k *keyLocks) lock(ctx context.Context, key string) (func(), error) {
+	k.mu.Lock()
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyLock{ch: make(chan struct{}, 1)}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	unref := func() {
+		k.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+
+	select {
+	case l.ch <- struct{}{}:
+		return func() {
+			<-l.ch
+			unref()
+		}, nil
+	case <-ctx.Done():
+		unref()
+		return nil, ctx.Err()
+	}
+}
+
+// acquireKeyLock ожидает завершения других операций с тем же ключом: контейнером
+// из SignWithContainer, а без него - сертификатом с отпечатком thumbprint.
+// При отключенной блокировке (WithKeyLocking(false)) возвращается сразу
+func (c *CryptoCLI) acquireKeyLock(ctx context.Context, thumbprint string, container string) (func(), error) {
+	if c.keyLocks == nil {
+		return func() {}, nil
+	}
+
+	key := "thumbprint:" + strings.ToLower(thumbprint)
+	if container != "" {
+		key = "container:" + container
+	}
+	return c.keyLocks.lock(ctx, key)
+}
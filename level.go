@@ -0,0 +1,96 @@
+package cprovlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+)
+
+// ErrSignatureFormat подпись не является корректной структурой CMS SignedData
+var ErrSignatureFormat = errors.New("некорректная структура подписи")
+
+// SignatureLevel уровень подписи по составу атрибутов CAdES
+type SignatureLevel string
+
+const (
+	// SignatureLevelCMS подпись CMS без обязательного для CAdES атрибута signingCertificate
+	SignatureLevelCMS SignatureLevel = "CMS"
+	// SignatureLevelBES CAdES-BES: подписанные атрибуты signingCertificate(V2), обычно и signingTime
+	SignatureLevelBES SignatureLevel = "CAdES-BES"
+	// SignatureLevelT CAdES-T: дополнительно штамп времени на значение подписи
+	SignatureLevelT SignatureLevel = "CAdES-T"
+	// SignatureLevelXLongType1 CAdES-X Long Type 1: дополнительно ссылки и значения сертификатов
+	// и CRL/OCSP, заверенные штампом времени
+	SignatureLevelXLongType1 SignatureLevel = "CAdES-X Long Type 1"
+)
+
+// levelRank порядок уровней от базового к расширенному
+var levelRank = map[SignatureLevel]int{
+	SignatureLevelCMS:        0,
+	SignatureLevelBES:        1,
+	SignatureLevelT:          2,
+	SignatureLevelXLongType1: 3,
+}
+
+// SignatureLevel определяет уровень подписи по структуре PKCS#7 без обращения к cryptcp:
+// наличию signingCertificate, штампа времени и значений CRL/OCSP. Для подписи с несколькими
+// подписантами возвращается наименьший уровень. Действительность подписи не проверяется
+func (c *CryptoCLI) SignatureLevel(ctx context.Context, sigBase64 string) (SignatureLevel, error) {
+
+	_, span := otel.Tracer("internal/cprovlib").Start(ctx, "SignatureLevel")
+	defer span.End()
+
+	signData, err := c.decodeBase64(sigBase64)
+	if err != nil {
+		return "", fmt.Errorf("%w: base64 decode: %v", ErrSignatureFormat, err)
+	}
+
+	sd, err := parseSignedData(signData)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrSignatureFormat, err)
+	}
+
+	signers, err := sd.signers()
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrSignatureFormat, err)
+	}
+	if len(signers) == 0 {
+		return "", fmt.Errorf("%w: signature has no signer infos", ErrSignatureFormat)
+	}
+
+	level := SignatureLevelXLongType1
+	for i := range signers {
+		signerLevel := signers[i].level()
+		if levelRank[signerLevel] < levelRank[level] {
+			level = signerLevel
+		}
+	}
+
+	return level, nil
+}
+
+// level определяет уровень CAdES одного подписанта
+func (si *cmsSignerInfo) level() SignatureLevel {
+	if findAttribute(si.signedAttrs, oidAttrSigningCertificate) == nil &&
+		findAttribute(si.signedAttrs, oidAttrSigningCertificateV2) == nil {
+		return SignatureLevelCMS
+	}
+
+	if findAttribute(si.unsignedAttrs, oidAttrTimeStampToken) == nil {
+		return SignatureLevelBES
+	}
+
+	// X Long Type 1: полные ссылки (C), их значения (X Long) и штамп времени на них (Type 1)
+	xLong := findAttribute(si.unsignedAttrs, oidAttrCompleteCertRefs) != nil &&
+		findAttribute(si.unsignedAttrs, oidAttrCompleteRevocationRefs) != nil &&
+		findAttribute(si.unsignedAttrs, oidAttrCertificateValues) != nil &&
+		si.hasRevocationValues() &&
+		findAttribute(si.unsignedAttrs, oidAttrEscTimeStamp) != nil
+	if xLong {
+		return SignatureLevelXLongType1
+	}
+
+	return SignatureLevelT
+}
@@ -1,7 +1,13 @@
 package cprovlib
 
 import (
+	"context"
+	"encoding/base64"
+	"fmt"
 	"log/slog"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Logger минималистичный интерфейс для логирования.
@@ -36,3 +42,108 @@ func (l *DefaultLogger) Warn(msg string, keysAndValues ...interface{}) {
 func (l *DefaultLogger) Error(msg string, keysAndValues ...interface{}) {
 	slog.Error(msg, keysAndValues...)
 }
+
+// operationLogger добавляет идентификатор операции в начало полей каждой записи
+type operationLogger struct {
+	logger      Logger
+	operationID string
+}
+
+func (l operationLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.logger.Debug(msg, l.fields(keysAndValues)...)
+}
+
+func (l operationLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.logger.Info(msg, l.fields(keysAndValues)...)
+}
+
+func (l operationLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.logger.Warn(msg, l.fields(keysAndValues)...)
+}
+
+func (l operationLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.logger.Error(msg, l.fields(keysAndValues)...)
+}
+
+func (l operationLogger) fields(keysAndValues []interface{}) []interface{} {
+	return append([]interface{}{"operationId", l.operationID}, keysAndValues...)
+}
+
+// log возвращает логгер операции: если в контексте задан идентификатор операции
+// (SignWithOperationID или ContextWithCorrelationID), он добавляется в каждую запись
+func (c *CryptoCLI) log(ctx context.Context) Logger {
+	id := contextCorrelationID(ctx)
+	if id == "" {
+		return c.logger
+	}
+	return operationLogger{logger: c.logger, operationID: id}
+}
+
+// defaultLogOutputLimit ограничение длины вывода утилит в логах по умолчанию
+const defaultLogOutputLimit = 4096
+
+// binaryOutputRatio доля непечатаемых символов, начиная с которой вывод считается двоичным
+const binaryOutputRatio = 0.1
+
+// logOutput подготавливает вывод утилиты или текст ошибки для лога: заменяет непечатаемые
+// символы (sanitizeOutput) и усекает до предела WithLogOutputLimit, чтобы большой вывод
+// cryptcp не переполнял логи. Исходный вывод остается в CommandError
+func (c *CryptoCLI) logOutput(s string) string {
+	s = sanitizeOutput(s)
+	if c.logOutputLimit <= 0 || len(s) <= c.logOutputLimit {
+		return s
+	}
+
+	// Не разрезаем многобайтовый символ UTF-8
+	cut := c.logOutputLimit
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+
+	return fmt.Sprintf("%s... [truncated, %d of %d bytes]", s[:cut], cut, len(s))
+}
+
+// sanitizeOutput заменяет управляющие символы (кроме перевода строки и табуляции) и байты,
+// не являющиеся UTF-8, на экранированные последовательности \xNN. Двоичный вывод (например,
+// подпись DER, попавшая в stdout) целиком кодируется в base64, чтобы не портить JSON логи
+func sanitizeOutput(s string) string {
+	total, bad := 0, 0
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if isUnprintable(r, size) {
+			bad++
+		}
+		total++
+		i += size
+	}
+	if bad == 0 {
+		return s
+	}
+
+	if float64(bad) >= float64(total)*binaryOutputRatio {
+		return fmt.Sprintf("[binary output, %d bytes, base64] %s", len(s), base64.StdEncoding.EncodeToString([]byte(s)))
+	}
+
+	var b strings.Builder
+	b.Grow(len(s) + bad*3)
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if isUnprintable(r, size) {
+			for _, by := range []byte(s[i : i+size]) {
+				fmt.Fprintf(&b, "\\x%02x", by)
+			}
+		} else {
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// isUnprintable проверяет, что символ r длиной size байт нельзя выводить в лог как есть
+func isUnprintable(r rune, size int) bool {
+	if r == utf8.RuneError && size == 1 {
+		return true
+	}
+	return unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t'
+}
@@ -0,0 +1,100 @@
+package cprovlib
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrUnknownTenant для арендатора не зарегистрирована конфигурация
+var ErrUnknownTenant = errors.New("неизвестный арендатор")
+
+// TenantConfig параметры клиента одного арендатора, аналогичные аргументам New
+type TenantConfig struct {
+	Store               string   // Хранилище сертификатов арендатора
+	TSPServers          []string // TSP серверы, пустой список - DefaultTSPServers
+	SignType            uint     // Тип подписи по умолчанию
+	SkipChainValidation bool
+	Options             []Option // Дополнительные настройки клиента
+}
+
+// Manager хранит именованные конфигурации арендаторов и лениво создает для каждого
+// отдельный CryptoCLI. Безопасен для использования из нескольких горутин
+type Manager struct {
+	logger  Logger
+	mu      sync.Mutex
+	configs map[string]TenantConfig
+	clients map[string]*CryptoCLI
+	retired []*CryptoCLI // Клиенты замененных конфигураций, закрываются в Close
+}
+
+// NewManager создает менеджер клиентов. logger передается всем создаваемым клиентам
+func NewManager(logger Logger) *Manager {
+	return &Manager{
+		logger:  logger,
+		configs: make(map[string]TenantConfig),
+		clients: make(map[string]*CryptoCLI),
+	}
+}
+
+// Register задает конфигурацию арендатора. Если клиент арендатора уже создан, следующий
+// вызов For создаст новый клиент с новой конфигурацией, а прежний будет закрыт в Close
+func (m *Manager) Register(tenant string, config TenantConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if client, ok := m.clients[tenant]; ok {
+		m.retired = append(m.retired, client)
+		delete(m.clients, tenant)
+	}
+	m.configs[tenant] = config
+}
+
+// For возвращает клиент арендатора, создавая его при первом обращении.
+// Для незарегистрированного арендатора возвращает nil (см. Lookup)
+func (m *Manager) For(tenant string) *CryptoCLI {
+	client, err := m.Lookup(tenant)
+	if err != nil {
+		return nil
+	}
+	return client
+}
+
+// Lookup возвращает клиент арендатора так же, как For, или ErrUnknownTenant
+func (m *Manager) Lookup(tenant string) (*CryptoCLI, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if client, ok := m.clients[tenant]; ok {
+		return client, nil
+	}
+
+	config, ok := m.configs[tenant]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTenant, tenant)
+	}
+
+	client := New(config.Store, config.TSPServers, config.SignType, m.logger, config.SkipChainValidation, config.Options...)
+	m.clients[tenant] = client
+
+	return client, nil
+}
+
+// Close закрывает все созданные клиенты, в том числе замененные в Register, дожидаясь
+// операций, которые еще выполняют полученные из For клиенты. После Close менеджер не следует использовать
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	clients := append([]*CryptoCLI(nil), m.retired...)
+	for _, client := range m.clients {
+		clients = append(clients, client)
+	}
+	m.clients = make(map[string]*CryptoCLI)
+	m.retired = nil
+	m.mu.Unlock()
+
+	var errs []error
+	for _, client := range clients {
+		errs = append(errs, client.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,55 @@
+package cprovlib
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestManagerCloseWaitsForOperations(t *testing.T) {
+	tmpDir := t.TempDir()
+	config := TenantConfig{Store: "uMy", Options: []Option{WithTmpDir(tmpDir), WithWorkDirPool(1)}}
+
+	m := NewManager(&DefaultLogger{})
+	m.Register("tenant", config)
+	client := m.For("tenant")
+
+	// Операция, начатая до замены конфигурации, держит директорию из пула
+	workDir, err := client.newWorkDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Register("tenant", config)
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- m.Close()
+	}()
+
+	select {
+	case err := <-closed:
+		t.Fatalf("Close returned while an operation was running: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if _, err := os.Stat(workDir); err != nil {
+		t.Fatalf("work directory of running operation removed: %v", err)
+	}
+
+	client.removeWorkDir(workDir)
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return after the operation finished")
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("work directory pool not removed: %v", entries)
+	}
+}
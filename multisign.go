@@ -0,0 +1,158 @@
+package cprovlib
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+)
+
+// Signer подписант для SignMultiSigner
+type Signer struct {
+	Thumbprint string       // SHA1 отпечаток сертификата подписанта
+	PIN        string       // PIN контейнера закрытого ключа
+	SignType   *uint        // Тип подписи, nil - тип из конфига
+	Options    []SignOption // Опции вызова для этого подписанта (TSP серверы, контейнер)
+}
+
+// SignMultiSigner создает независимые отсоединенные подписи одного документа сертификатами
+// signers (не соподпись). Документ записывается один раз, подписи создаются параллельно
+// с учетом WithMaxConcurrency. Результаты возвращаются в порядке signers; для подписанта
+// с ошибкой SignResult содержит только Thumbprint и Error. Если хотя бы одна подпись
+// не создана, возвращаются результаты и ошибка ErrSignature со списком неудачных подписантов
+func (c *CryptoCLI) SignMultiSigner(ctx context.Context, dataBase64 string, signers []Signer) ([]SignResult, error) {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "SignMultiSigner")
+	defer span.End()
+
+	startTime := time.Now()
+
+	err := c.checkDocumentSize(dataBase64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSignature, err)
+	}
+
+	doc, err := c.base64Document(dataBase64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: base64 decode: %v", ErrSignature, err)
+	}
+
+	err = c.checkDiskSpace(c.signTmpBase(), doc.size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSignature, err)
+	}
+
+	// Общая директория с документом; подпись каждого подписанта записывается в свою директорию
+	dataDir, err := c.newWorkDirIn(c.signTmpBase())
+	if err != nil {
+		return nil, fmt.Errorf("%w: create work directory: %v", ErrSignature, err)
+	}
+	defer c.removeWorkDir(dataDir)
+
+	writeStart := time.Now()
+	dataFile, err := c.writeDocument(dataDir, "data_*.txt", doc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: write data file: %v", ErrSignature, err)
+	}
+	writeDuration := time.Since(writeStart)
+
+	dataPath, err := filepath.Abs(filepath.Join(dataDir, dataFile))
+	if err != nil {
+		return nil, fmt.Errorf("%w: data file path: %v", ErrSignature, err)
+	}
+
+	results := make([]SignResult, len(signers))
+	errs := make([]error, len(signers))
+
+	var wg sync.WaitGroup
+	for i, signer := range signers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			c.stats.signsAttempted.Add(1)
+			result, err := c.recordSign(c.signSharedFile(ctx, dataPath, signer, startTime, writeDuration))
+			if err != nil {
+				errs[i] = err
+				results[i] = SignResult{Thumbprint: strings.ToLower(signer.Thumbprint), Error: err.Error()}
+				return
+			}
+			result.SignatureBase64 = base64.StdEncoding.EncodeToString(result.SignatureDER)
+			results[i] = *result
+		}()
+	}
+	wg.Wait()
+
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, results[i].Thumbprint)
+		}
+	}
+	if len(failed) > 0 {
+		c.log(ctx).Error("multi-signer signing partially failed",
+			"signers", len(signers),
+			"failed", failed)
+		return results, fmt.Errorf("%w: %d of %d signers failed (%s): %w",
+			ErrSignature, len(failed), len(signers), strings.Join(failed, ", "), errors.Join(errs...))
+	}
+
+	c.log(ctx).Info("multi-signer signing completed",
+		"signers", len(signers),
+		"duration", time.Since(startTime).Seconds())
+
+	return results, nil
+}
+
+// signSharedFile подписывает общий файл документа dataPath одним подписантом
+// в собственной рабочей директории
+func (c *CryptoCLI) signSharedFile(ctx context.Context, dataPath string, signer Signer, startTime time.Time, writeDuration time.Duration) (*SignResult, error) {
+	options := newSignOptions(signer.Options)
+
+	thumbprint, err := NormalizeThumbprint(signer.Thumbprint)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSignature, err)
+	}
+
+	if options.textNormalization != nil {
+		return nil, fmt.Errorf("%w: text normalization is not supported for multi-signer signing, normalize the document before SignMultiSigner", ErrSignature)
+	}
+
+	attached := false
+	isAttached, err := options.resolveAttached(&attached, c.defaultAttached)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSignature, err)
+	}
+
+	workDir, err := c.newWorkDirIn(c.signTmpBase())
+	if err != nil {
+		return nil, fmt.Errorf("%w: create work directory: %v", ErrSignature, err)
+	}
+	var result *SignResult
+	defer func() {
+		cleanupStart := time.Now()
+		c.removeWorkDir(workDir)
+		if result != nil {
+			result.Timings.Cleanup = time.Since(cleanupStart)
+		}
+	}()
+
+	result, err = c.signInputFile(ctx, &signInput{
+		workDir:       workDir,
+		dataFile:      dataPath,
+		thumbprint:    thumbprint,
+		pin:           signer.PIN,
+		isAttached:    isAttached,
+		signType:      signer.SignType,
+		options:       options,
+		startTime:     startTime,
+		writeDuration: writeDuration,
+	})
+	return result, err
+}
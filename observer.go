@@ -0,0 +1,75 @@
+package cprovlib
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CommandRecord сведения о запуске внешней утилиты для журнала аудита (WithCommandObserver)
+type CommandRecord struct {
+	Tool          string        `json:"tool"`                    // Имя утилиты (cryptcp, certmgr, csptest, cpconfig)
+	Path          string        `json:"path"`                    // Полный путь к утилите
+	Args          []string      `json:"args"`                    // Аргументы со скрытыми PIN и учетными данными TSP
+	StartedAt     time.Time     `json:"startedAt"`               // Время запуска
+	Duration      time.Duration `json:"duration"`                // Время выполнения
+	ExitCode      int           `json:"exitCode"`                // Код завершения, -1 если процесс не запустился или был остановлен сигналом
+	Error         string        `json:"error,omitempty"`         // Ошибка запуска или выполнения
+	CorrelationID string        `json:"correlationId,omitempty"` // Идентификатор операции из ContextWithCorrelationID или trace ID
+}
+
+// correlationIDKey ключ идентификатора операции в контексте
+type correlationIDKey struct{}
+
+// ContextWithCorrelationID добавляет в контекст идентификатор операции вызывающей стороны
+// (например, ID запроса), который передается в CommandRecord.CorrelationID, добавляется
+// полем operationId в логи операций клиента и возвращается в SignResult.OperationID
+func ContextWithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// contextCorrelationID возвращает идентификатор операции, явно заданный в контексте
+func contextCorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// operationContext добавляет в контекст идентификатор операции SignWithOperationID и записывает
+// идентификатор операции в атрибут cprovlib.operation_id текущего span
+func operationContext(ctx context.Context, options *signOptions) context.Context {
+	if options.operationID != "" {
+		ctx = ContextWithCorrelationID(ctx, options.operationID)
+	}
+	if id := contextCorrelationID(ctx); id != "" {
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("cprovlib.operation_id", id))
+	}
+	return ctx
+}
+
+// correlationID возвращает идентификатор операции из контекста, а если он не задан -
+// trace ID текущего span
+func correlationID(ctx context.Context) string {
+	if id := contextCorrelationID(ctx); id != "" {
+		return id
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	return ""
+}
+
+// maskCommandArgs возвращает копию аргументов утилиты со скрытыми PIN и учетными данными TSP
+func maskCommandArgs(args []string) []string {
+	masked := append([]string(nil), args...)
+	for i := 1; i < len(masked); i++ {
+		switch masked[i-1] {
+		case "-pin", "-newpin", "-password", "-pinsrc", "-pindest":
+			masked[i] = "***"
+		case "-cadestsa":
+			masked[i] = maskTSPURL(masked[i])
+		}
+	}
+	return masked
+}
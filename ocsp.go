@@ -0,0 +1,89 @@
+package cprovlib
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// embeddedOCSPResponder возвращает отправителя первого ответа OCSP, встроенного в атрибут
+// revocationValues первого подписанта. Отправитель - имя (byName) или SHA1 ключа ("keyHash:...")
+// из ResponderID. Ошибка возвращается, если в подписи нет ни одного ответа OCSP
+func embeddedOCSPResponder(signData []byte) (string, error) {
+	sd, err := parseSignedData(signData)
+	if err != nil {
+		return "", fmt.Errorf("parse signature: %v", err)
+	}
+	signers, err := sd.signers()
+	if err != nil {
+		return "", fmt.Errorf("parse signature: %v", err)
+	}
+	if len(signers) == 0 {
+		return "", errors.New("signature has no signer infos")
+	}
+
+	attr := findAttribute(signers[0].unsignedAttrs, oidAttrRevocationValues)
+	if attr == nil || len(attr.values) == 0 {
+		return "", errors.New("signature has no revocation values")
+	}
+
+	// RevocationValues ::= SEQUENCE { crlVals [0], ocspVals [1] SEQUENCE OF BasicOCSPResponse, ... }
+	fields, err := asn1Elements(attr.values[0])
+	if err != nil {
+		return "", fmt.Errorf("parse revocation values: %v", err)
+	}
+	for _, field := range fields {
+		if !isContextTag(field, 1) {
+			continue
+		}
+		wrapped, err := asn1Elements(field)
+		if err != nil || len(wrapped) == 0 {
+			break
+		}
+		responses, err := asn1Elements(wrapped[0])
+		if err != nil || len(responses) == 0 {
+			break
+		}
+		return ocspResponderID(responses[0])
+	}
+
+	return "", errors.New("signature revocation values contain no OCSP response")
+}
+
+// ocspResponderID разбирает ResponderID из BasicOCSPResponse (RFC 6960):
+// BasicOCSPResponse ::= SEQUENCE { tbsResponseData ResponseData, ... }
+// ResponseData ::= SEQUENCE { version [0] EXPLICIT DEFAULT v1, responderID ResponderID, ... }
+// ResponderID ::= CHOICE { byName [1] Name, byKey [2] KeyHash }
+func ocspResponderID(basicResponse asn1.RawValue) (string, error) {
+	fields, err := asn1Elements(basicResponse)
+	if err != nil || len(fields) == 0 {
+		return "", errors.New("parse OCSP response: malformed BasicOCSPResponse")
+	}
+	responseData, err := asn1Elements(fields[0])
+	if err != nil {
+		return "", errors.New("parse OCSP response: malformed ResponseData")
+	}
+
+	for _, field := range responseData {
+		switch {
+		case isContextTag(field, 1):
+			var rdn pkix.RDNSequence
+			if _, err := asn1.Unmarshal(field.Bytes, &rdn); err != nil {
+				return "", fmt.Errorf("parse OCSP responder name: %v", err)
+			}
+			var name pkix.Name
+			name.FillFromRDNSequence(&rdn)
+			return name.String(), nil
+		case isContextTag(field, 2):
+			var keyHash []byte
+			if _, err := asn1.Unmarshal(field.Bytes, &keyHash); err != nil {
+				return "", fmt.Errorf("parse OCSP responder key hash: %v", err)
+			}
+			return "keyHash:" + hex.EncodeToString(keyHash), nil
+		}
+	}
+
+	return "", errors.New("parse OCSP response: no responder ID")
+}
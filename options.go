@@ -0,0 +1,495 @@
+package cprovlib
+
+import (
+	"time"
+)
+
+// Option дополнительная настройка CryptoCLI, передается в New
+type Option func(*CryptoCLI)
+
+// WithTraceContextEnv включает передачу контекста трассировки OpenTelemetry
+// в переменные окружения TRACEPARENT/TRACESTATE запускаемых утилит (cryptcp, certmgr, csptest).
+// Остальное окружение наследуется от текущего процесса; унаследованные TRACEPARENT/TRACESTATE
+// не передаются, даже если в контексте нет span
+func WithTraceContextEnv(enabled bool) Option {
+	return func(c *CryptoCLI) {
+		c.traceContextEnv = enabled
+	}
+}
+
+// WithTSPRateLimit ограничивает частоту подписей с обращением к TSP серверу (CAdES-T и выше):
+// не более rps запросов в секунду с накоплением до burst запросов.
+// Ожидание учитывает отмену контекста. rps <= 0 отключает ограничение
+func WithTSPRateLimit(rps float64, burst int) Option {
+	return func(c *CryptoCLI) {
+		if rps <= 0 {
+			c.tspLimiter = nil
+			return
+		}
+		c.tspLimiter = newTokenBucket(rps, burst)
+	}
+}
+
+// WithSignAndVerify включает контрольную проверку каждой созданной подписи через cryptcp.
+// Если проверка не прошла, SignDocument возвращает ошибку. Подпись выполняется медленнее
+func WithSignAndVerify(enabled bool) Option {
+	return func(c *CryptoCLI) {
+		c.signAndVerify = enabled
+	}
+}
+
+// WithTSPFallbackToBES разрешает создавать подпись CAdES-BES, если для CAdES-T
+// исчерпаны попытки из-за ошибок TSP сервера. Факт замены отражается в SignResult.FallbackToBES.
+// По умолчанию выключено: подпись CAdES-T без штампа времени завершается ошибкой
+func WithTSPFallbackToBES(enabled bool) Option {
+	return func(c *CryptoCLI) {
+		c.tspFallbackToBES = enabled
+	}
+}
+
+// WithMaxDocumentSize ограничивает размер подписываемого или проверяемого документа в байтах.
+// Размер base64 строки проверяется до декодирования, при превышении возвращается ErrDocumentTooLarge.
+// 0 отключает ограничение
+func WithMaxDocumentSize(bytes int64) Option {
+	return func(c *CryptoCLI) {
+		c.maxDocumentSize = bytes
+	}
+}
+
+// WithAsyncCleanup включает фоновое удаление рабочих директорий: операция возвращает
+// результат сразу после чтения подписи. timeout ограничивает время, в течение которого
+// Close ожидает каждое удаление. timeout <= 0 возвращает синхронное удаление
+func WithAsyncCleanup(timeout time.Duration) Option {
+	return func(c *CryptoCLI) {
+		c.cleanupTimeout = timeout
+	}
+}
+
+// WithLogOutputLimit ограничивает длину вывода cryptcp и текста ошибок в логах n байтами
+// (по умолчанию 4 КБ). Усеченный текст заканчивается пометкой с исходной длиной;
+// возвращаемые ошибки (CommandError, VerifyResult.Error) содержат полный вывод.
+// n <= 0 отключает ограничение
+func WithLogOutputLimit(n int) Option {
+	return func(c *CryptoCLI) {
+		c.logOutputLimit = n
+	}
+}
+
+// WithSignatureFileGlob задает шаблон (filepath.Match) для поиска файла подписи в рабочей
+// директории вместо ожидаемого имени <документ>.sgn/<документ>.sig, например "*.p7s".
+// Нужен, если версия cryptcp по-другому называет выходной файл. Исходный документ не учитывается,
+// при нескольких совпадениях берется первое по алфавиту
+func WithSignatureFileGlob(pattern string) Option {
+	return func(c *CryptoCLI) {
+		c.signatureFileGlob = pattern
+	}
+}
+
+// WithDiskSpaceHeadroom задает запас свободного места во временной директории: перед записью
+// документа проверяется, что свободно не меньше multiplier × размер документа, иначе
+// возвращается ErrInsufficientDiskSpace. По умолчанию 3, multiplier <= 0 отключает проверку
+func WithDiskSpaceHeadroom(multiplier float64) Option {
+	return func(c *CryptoCLI) {
+		c.diskSpaceHeadroom = multiplier
+	}
+}
+
+// WithTSPServers заменяет список TSP серверов, переданный в New, серверами с учетными данными
+// и приоритетами. Учетные данные передаются cryptcp в адресе сервера и скрываются в логах,
+// CommandRecord и SignResult.TSPServer, но на время подписи видны в аргументах командной строки
+// cryptcp (ps, /proc) любому пользователю хоста без hidepid. Серверы из New имеют одинаковый
+// приоритет 0
+func WithTSPServers(servers ...TSPServer) Option {
+	return func(c *CryptoCLI) {
+		if len(servers) > 0 {
+			c.settings().TSPServers = servers
+		}
+	}
+}
+
+// WithTSPURL задает одну службу временных меток, как устаревшее поле tspURL.
+// Адрес добавляется в список TSP серверов основным сервером (используется первым,
+// остальные серверы становятся резервными), при создании клиента логируется предупреждение.
+//
+// Deprecated: используйте список tspServers в New или WithTSPServers
+func WithTSPURL(url string) Option {
+	return func(c *CryptoCLI) {
+		c.legacyTSPURL = url
+	}
+}
+
+// WithVerifyCache включает LRU кэш результатов VerifySignature на size записей.
+// Ключ - хэш данных, подписи и параметров проверки (доверенные корни, skipChainValidation).
+// Кэшируются только действительные подписи, чтобы временная ошибка (например, недоступность
+// CRL) не закреплялась. ttl ограничивает время жизни записи, 0 - без ограничения.
+// size <= 0 отключает кэш
+func WithVerifyCache(size int, ttl time.Duration) Option {
+	return func(c *CryptoCLI) {
+		if size <= 0 {
+			c.verifyCache = nil
+			return
+		}
+		c.verifyCache = newVerifyCache(size, ttl)
+	}
+}
+
+// WithNiceness задает приоритет планировщика (nice, от -20 до 19) процессов cryptcp и certmgr,
+// чтобы пакетная подпись не отнимала CPU у обработки запросов. Приоритет устанавливается сразу
+// после запуска процесса; без CAP_SYS_NICE его можно только понизить (положительные значения).
+// На платформах без nice опция игнорируется с предупреждением в логе
+func WithNiceness(niceness int) Option {
+	return func(c *CryptoCLI) {
+		c.niceness = niceness
+	}
+}
+
+// WithCgroup помещает процессы утилит в cgroup с директорией dir (например,
+// "/sys/fs/cgroup/cprov"), где заданы ограничения памяти и CPU. Группу создает и настраивает
+// вызывающая сторона; процесс переносится записью PID в cgroup.procs сразу после запуска
+func WithCgroup(dir string) Option {
+	return func(c *CryptoCLI) {
+		c.cgroup = dir
+	}
+}
+
+// WithWorkDirPool включает пул из size заранее созданных рабочих директорий: после операции
+// директория очищается и переиспользуется вместо os.MkdirTemp/os.RemoveAll. Если директорию
+// не удалось очистить полностью, она заменяется новой. Когда все директории заняты, операция
+// создает временную директорию как обычно, поэтому пул не ограничивает параллельность.
+// Пул удаляется в Close; size <= 0 отключает пул
+func WithWorkDirPool(size int) Option {
+	return func(c *CryptoCLI) {
+		if size <= 0 {
+			c.workDirPool = nil
+			return
+		}
+		c.workDirPool = newWorkDirPool(size)
+	}
+}
+
+// WithStrictStderr включает строгий режим: подпись считается неудачной, если cryptcp
+// написал что-либо в stderr, даже предупреждение без "Error:". Повтор в этом случае
+// не выполняется. По умолчанию stderr только логируется
+func WithStrictStderr(strict bool) Option {
+	return func(c *CryptoCLI) {
+		c.strictStderr = strict
+	}
+}
+
+// WithTSPValidator задает проверку сертификата TSA (DER), выдавшего штамп времени созданной
+// подписи CAdES-T или CAdES-X Long. Если validate возвращает ошибку, подпись не возвращается,
+// а ошибка оборачивается в ErrTSPRejected. Позволяет принимать штампы только от разрешенных
+// TSA, даже если по одному адресу работают несколько служб
+func WithTSPValidator(validate func(tsaCertDER []byte) error) Option {
+	return func(c *CryptoCLI) {
+		c.tspValidator = validate
+	}
+}
+
+// WithRetryPolicy задает число попыток подписи при HTTP ошибках TSP сервера (по умолчанию 3)
+// и паузу перед второй попыткой (по умолчанию 1 секунда, перед n-й попыткой - (n-1) × backoff).
+// maxAttempts <= 1 отключает повторы
+func WithRetryPolicy(maxAttempts int, backoff time.Duration) Option {
+	return func(c *CryptoCLI) {
+		config := c.settings()
+		config.RetryMaxAttempts = max(maxAttempts, 1)
+		config.RetryBackoff = max(backoff, 0)
+	}
+}
+
+// WithAttemptTimeout ограничивает время каждой попытки cryptcp в пределах общего времени подписи.
+// Попытка, не уложившаяся в timeout (например, из-за медленного TSP сервера), останавливается
+// и повторяется на следующем TSP сервере, не расходуя время, нужное для переключения.
+// По умолчанию (0) попытка ограничена только общим временем подписи
+func WithAttemptTimeout(timeout time.Duration) Option {
+	return func(c *CryptoCLI) {
+		c.settings().AttemptTimeout = max(timeout, 0)
+	}
+}
+
+// WithRetryBudget разделяет повторы при HTTP ошибках TSP сервера на переключения серверов
+// и повторы на том же сервере вместо общего числа попыток WithRetryPolicy.
+// tspFailoverAttempts - сколько TSP серверов использовать для одной подписи, включая первый
+// (по кругу, если серверов в списке меньше), transientAttempts - сколько попыток выполнить
+// на одном сервере перед переключением (1 - переключаться сразу). Всего выполняется не больше
+// tspFailoverAttempts × transientAttempts попыток. Ошибки, не связанные с TSP, по-прежнему
+// не повторяются; повторы зависшего токена (WithStartupTimeout) выполняются на том же сервере
+// в пределах transientAttempts. Пауза между попытками задается WithRetryPolicy
+func WithRetryBudget(tspFailoverAttempts int, transientAttempts int) Option {
+	return func(c *CryptoCLI) {
+		config := c.settings()
+		config.TSPFailoverAttempts = max(tspFailoverAttempts, 1)
+		config.TransientAttempts = max(transientAttempts, 1)
+	}
+}
+
+// WithNoRetry отключает повторы: выполняется одна попытка, ее ошибка возвращается сразу
+func WithNoRetry() Option {
+	return func(c *CryptoCLI) {
+		WithRetryPolicy(1, 0)(c)
+		c.settings().TSPFailoverAttempts = 0
+	}
+}
+
+// WithLenientBase64 включает удаление пробелов, переводов строк и заголовков PEM
+// ("-----BEGIN ...-----") из входных base64 строк перед декодированием. Это позволяет
+// передавать base64 с переносом по 64/76 символов и PEM файлы целиком
+func WithLenientBase64(lenient bool) Option {
+	return func(c *CryptoCLI) {
+		c.lenientBase64 = lenient
+	}
+}
+
+// WithIncludeCertChain включает в подпись все сертификаты цепочки подписанта до корневого
+// (cryptcp -addchain), чтобы подпись можно было проверить без доступа к сертификатам УЦ.
+// После подписи проверяется, что цепочка действительно включена, иначе возвращается ErrSignature
+func WithIncludeCertChain(include bool) Option {
+	return func(c *CryptoCLI) {
+		c.includeCertChain = include
+	}
+}
+
+// WithStartupTimeout задает время, за которое утилита КриптоПро должна начать выводить
+// результат или завершиться. Процесс, молчащий дольше, завершается с ErrTokenUnresponsive:
+// так быстрее обнаруживается зависший токен, чем по общему таймауту операции.
+// retry разрешает повторять подпись после такой ошибки в пределах WithRetryPolicy.
+// 0 - без ограничения (по умолчанию)
+func WithStartupTimeout(timeout time.Duration, retry bool) Option {
+	return func(c *CryptoCLI) {
+		c.startupTimeout = timeout
+		c.retryUnresponsive = retry
+	}
+}
+
+// WithTmpDir задает директорию для рабочих директорий операций и временных файлов
+// (по умолчанию /tmp). Чтобы документы и ключи не попадали на постоянный диск, укажите
+// точку монтирования tmpfs и включите WithRequireTmpfs
+func WithTmpDir(dir string) Option {
+	return func(c *CryptoCLI) {
+		c.tmpDir = dir
+	}
+}
+
+// WithSignTmpDir задает отдельную директорию для рабочих директорий подписи (документ и файл
+// подписи), например tmpfs для быстрой записи. По умолчанию используется WithTmpDir
+func WithSignTmpDir(dir string) Option {
+	return func(c *CryptoCLI) {
+		c.signTmpDir = dir
+	}
+}
+
+// WithInstallTmpDir задает отдельную директорию для временных файлов установки сертификатов
+// (PKCS#12 с закрытым ключом), например зашифрованный том. По умолчанию используется WithTmpDir
+func WithInstallTmpDir(dir string) Option {
+	return func(c *CryptoCLI) {
+		c.installTmpDir = dir
+	}
+}
+
+// WithFileSystem задает реализацию файловых операций с рабочими директориями.
+// cryptcp и certmgr читают и пишут файлы по путям внутри tmpDir, поэтому реализация
+// должна сохранять файлы по этим путям
+func WithFileSystem(fsys FileSystem) Option {
+	return func(c *CryptoCLI) {
+		c.fileSystem = fsys
+	}
+}
+
+// WithWriteBufferSize задает размер буфера, которым документ из base64 записывается
+// во временный файл (по умолчанию 64 КБ). Документ декодируется при записи, поэтому
+// в памяти не хранится его декодированная копия. n <= 0 - размер по умолчанию
+func WithWriteBufferSize(n int) Option {
+	return func(c *CryptoCLI) {
+		c.writeBufferSize = n
+	}
+}
+
+// WithRequireTmpfs запрещает операции, если tmpDir находится не на tmpfs или ramfs:
+// создание рабочей директории завершается ошибкой ErrPersistentTmpDir.
+// Проверка поддерживается только в Linux, на остальных платформах операции завершаются ошибкой
+func WithRequireTmpfs(require bool) Option {
+	return func(c *CryptoCLI) {
+		c.requireTmpfs = require
+	}
+}
+
+// WithDefaultAttached задает форму подписи, если attachSignature == nil и SignWithMode не задан:
+// true - присоединенная, false - отсоединенная (по умолчанию).
+// Явный attachSignature и SignWithMode вызова имеют приоритет
+func WithDefaultAttached(attached bool) Option {
+	return func(c *CryptoCLI) {
+		c.defaultAttached = attached
+	}
+}
+
+// WithMaxConcurrency ограничивает количество одновременно выполняемых подписей клиента
+// (включая подписи SignMultiSigner): остальные ожидают свободный слот с учетом контекста.
+// n <= 0 отключает ограничение (по умолчанию)
+func WithMaxConcurrency(n int) Option {
+	return func(c *CryptoCLI) {
+		if n <= 0 {
+			c.signSlots = nil
+			return
+		}
+		c.signSlots = make(chan struct{}, n)
+	}
+}
+
+// WithCertmgrTimeout задает таймаут операций certmgr (список, установка, удаление и экспорт
+// сертификатов), по истечении которого процесс завершается с ошибкой, оборачивающей
+// context.DeadlineExceeded. Применяется, даже если контекст вызова не ограничен; более ранний
+// срок контекста сохраняется.
+// По умолчанию 2 минуты, 0 отключает таймаут
+func WithCertmgrTimeout(timeout time.Duration) Option {
+	return func(c *CryptoCLI) {
+		c.settings().CertmgrTimeout = timeout
+	}
+}
+
+// WithProviderType задает тип криптопровайдера для подписи (cryptcp -provtype):
+// ProviderTypeGOST2001 (75), ProviderTypeGOST2012256 (80) или ProviderTypeGOST2012512 (81).
+// По умолчанию (0) тип определяется по алгоритму ключа сертификата подписанта
+func WithProviderType(providerType int) Option {
+	return func(c *CryptoCLI) {
+		c.providerType = providerType
+	}
+}
+
+// WithCommandObserver задает получателя сведений о каждом запуске утилит КриптоПро
+// (cryptcp, certmgr, csptest, cpconfig) для журнала аудита: утилита, аргументы со скрытыми PIN
+// и учетными данными TSP, время выполнения, код завершения и идентификатор операции
+// (ContextWithCorrelationID или trace ID). Вызывается синхронно после завершения процесса
+// и может вызываться из нескольких горутин одновременно
+func WithCommandObserver(observe func(record CommandRecord)) Option {
+	return func(c *CryptoCLI) {
+		c.commandObserver = observe
+	}
+}
+
+// WithSuccessMarker задает строку, которая должна присутствовать в выводе cryptcp
+// при успешной подписи (без учета регистра), например "Signed message is created".
+// Без нее попытка считается неудачной, даже если файл подписи создан и ошибок в выводе нет.
+// Пустая строка отключает проверку (по умолчанию)
+func WithSuccessMarker(marker string) Option {
+	return func(c *CryptoCLI) {
+		c.successMarker = marker
+	}
+}
+
+// WithKeyLocking включает последовательное выполнение подписей одним ключом (контейнером
+// из SignWithContainer или сертификатом с тем же отпечатком); подписи разными ключами
+// выполняются параллельно. Включено по умолчанию: одновременный доступ к контейнеру на
+// аппаратных токенах приводит к ошибкам и блокировке PIN. Отключается для CSP,
+// корректно обрабатывающих параллельный доступ
+func WithKeyLocking(enabled bool) Option {
+	return func(c *CryptoCLI) {
+		if !enabled {
+			c.keyLocks = nil
+			return
+		}
+		c.keyLocks = newKeyLocks()
+	}
+}
+
+// WithEmbedOCSP встраивает в подпись ответ OCSP о статусе сертификата подписанта, полученный
+// в момент подписи, чтобы проверка не зависела от доступности OCSP позже. cryptcp встраивает
+// значения отзыва только в CAdES-X Long Type 1, поэтому подписи CAdES-T создаются этого уровня
+// (требуется проверка цепочки, skipChainValidation должен быть выключен); CAdES-BES не меняется.
+// Подпись без ответа OCSP считается ошибкой, отправитель ответа возвращается в SignResult.OCSPResponder
+func WithEmbedOCSP(enabled bool) Option {
+	return func(c *CryptoCLI) {
+		c.embedOCSP = enabled
+	}
+}
+
+// WithSubprocessEnv задает переменные окружения утилит КриптоПро в виде "KEY=VALUE", которые
+// заменяют одноименные переменные окружения процесса; остальные переменные наследуются.
+// По умолчанию задается локаль LANG=C.UTF-8 и LC_ALL=C.UTF-8, чтобы вывод утилит был
+// на английском независимо от локали контейнера. Вызов без аргументов оставляет окружение
+// процесса без изменений
+func WithSubprocessEnv(env ...string) Option {
+	return func(c *CryptoCLI) {
+		c.subprocessEnv = env
+	}
+}
+
+// WithPreSignCertCheck включает проверку сертификата подписанта перед каждой подписью:
+// сертификат должен быть в хранилище клиента (иначе ErrCertNotFound) и действовать в момент
+// подписи по WithTimeSource или системным часам (иначе ErrCertExpired или ErrCertNotYetValid).
+// Ошибки возвращаются обернутыми в ErrSignature до запуска cryptcp. Проверка читает
+// хранилище через certmgr при каждой подписи
+func WithPreSignCertCheck(enabled bool) Option {
+	return func(c *CryptoCLI) {
+		c.preSignCertCheck = enabled
+	}
+}
+
+// WithDocumentDigest включает вычисление хэша подписываемого документа алгоритмами
+// DigestSHA256, DigestGOST2012256 и DigestGOST2012512 для разбора споров: хэши записываются
+// в лог вместе с отпечатком подписанта и возвращаются в SignResult.DocumentDigests.
+// Подпись от них не меняется. Хэш ГОСТ вычисляется дополнительным запуском cryptcp -hash,
+// для SHA-256 документ читается в память. Ошибка вычисления хэша прерывает подпись с ErrHash
+func WithDocumentDigest(algorithms ...DigestAlgorithm) Option {
+	return func(c *CryptoCLI) {
+		c.documentDigest = algorithms
+	}
+}
+
+// WithStdoutSignatureFallback разрешает читать подпись из stdout cryptcp, если файл подписи
+// не создан, а cryptcp завершился без ошибки: некоторые версии и настройки cryptcp выводят
+// подпись в stdout в DER, PEM или base64. Подпись принимается, только если разбирается как CMS.
+// Включено по умолчанию
+func WithStdoutSignatureFallback(enabled bool) Option {
+	return func(c *CryptoCLI) {
+		c.stdoutSignature = enabled
+	}
+}
+
+// WithRequireCachedPin включает подпись без аргумента cryptcp -pin: PIN берется из кэша CSP,
+// куда его заранее сохраняет CachePin. Нужен для токенов, которые игнорируют -pin и запрашивают
+// PIN интерактивно. Если ключ все же запросил PIN, подпись сразу завершается ошибкой
+// ErrCachedPinRequired без повторов; ожидания ввода не происходит. PIN вызова подписи игнорируется
+func WithRequireCachedPin(enabled bool) Option {
+	return func(c *CryptoCLI) {
+		c.requireCachedPin = enabled
+	}
+}
+
+// WithQualifiedPolicies задает OID политик сертификата, одну из которых должен содержать
+// сертификат подписанта в VerifyQualified. Без опции или с пустым списком используются
+// DefaultQualifiedPolicies
+func WithQualifiedPolicies(oids ...string) Option {
+	return func(c *CryptoCLI) {
+		c.qualifiedPolicies = oids
+	}
+}
+
+// WithFakeBackend включает фиктивный бэкенд для локальной разработки и интеграционных тестов
+// без установленного КриптоПро. ТОЛЬКО ДЛЯ РАЗРАБОТКИ: подписи не являются CMS и не имеют
+// юридической силы. Подпись и проверка (SignDocument, SignMultiSigner, SignDirectory,
+// VerifySignature и т.п.) выполняются без cryptcp: подпись детерминированно зависит от данных
+// и отпечатка, а проверка принимает только фиктивные подписи тех же данных. HealthCheck
+// не проверяет CSP; остальные операции (сертификаты, контейнеры) по-прежнему вызывают утилиты.
+// Фиктивную подпись может создать любой, кто знает формат, поэтому бэкенд включается, только
+// если в окружении процесса задано CPROVLIB_FAKE_BACKEND=1. Без переменной опция отклоняется:
+// клиент работает с КриптоПро, а New логирует ошибку. Включение бэкенда и каждая операция
+// с ним логируются
+func WithFakeBackend() Option {
+	return func(c *CryptoCLI) {
+		if !fakeBackendAllowed() {
+			c.fakeRefused = true
+			return
+		}
+		c.fakeBackend = true
+	}
+}
+
+// WithTimeSource задает доверенный источник времени (например, синхронизированный по NTP).
+// Время из него записывается в SignResult.SigningTime, а расхождение с системными часами
+// логируется при каждой подписи. Атрибут signingTime внутри подписи cryptcp формирует
+// по системным часам и изменить его нельзя, поэтому лог позволяет оценить его точность
+func WithTimeSource(now func() time.Time) Option {
+	return func(c *CryptoCLI) {
+		c.timeSource = now
+	}
+}
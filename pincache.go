@@ -0,0 +1,87 @@
+package cprovlib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+)
+
+var (
+	// ErrPinCache ошибка сохранения PIN контейнера в кэше CSP
+	ErrPinCache = errors.New("ошибка сохранения PIN в кэше CSP")
+
+	// ErrCachedPinRequired ключ не принимает PIN из аргумента -pin и запрашивает его
+	// интерактивно: PIN нужно заранее сохранить в кэше CSP через CachePin
+	ErrCachedPinRequired = errors.New("ключ требует PIN из кэша CSP")
+)
+
+// pinPromptMarkers признаки интерактивного запроса PIN в выводе cryptcp (в нижнем регистре).
+// stdin утилит пуст, поэтому запрос сразу завершается ошибкой вместо зависания
+var pinPromptMarkers = []string{
+	"enter password",
+	"enter pin",
+	"password is required",
+	"pin is required",
+	"введите пароль",
+	"введите pin",
+	"требуется пароль",
+	"требуется pin",
+}
+
+// isPinPromptError проверяет, что вывод cryptcp в нижнем регистре содержит запрос PIN
+func isPinPromptError(output string) bool {
+	return containsAny(output, pinPromptMarkers)
+}
+
+// CachePin сохраняет PIN контейнера ключа сертификата thumbprint в кэше CSP
+// (csptest -passwd -save), чтобы подпись не запрашивала его интерактивно. Нужен для токенов,
+// которые не принимают PIN из аргумента cryptcp -pin; вместе с WithRequireCachedPin подпись
+// выполняется без -pin. Кэш принадлежит пользователю, от имени которого работает процесс
+func (c *CryptoCLI) CachePin(ctx context.Context, thumbprint string, pin string) error {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "CachePin")
+	defer span.End()
+
+	thumbprint, err := NormalizeThumbprint(thumbprint)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrPinCache, err)
+	}
+
+	info, err := c.certificateInfo(ctx, thumbprint)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrPinCache, err)
+	}
+	if !info.HasPrivateKey || info.Container == "" {
+		return fmt.Errorf("%w: certificate %s is not linked to a private key container", ErrPinCache, thumbprint)
+	}
+
+	cmd := c.command(ctx, c.csptestPath,
+		"-passwd",
+		"-container", info.Container,
+		"-password", pin,
+		"-save",
+	)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = c.run(ctx, cmd)
+	output := decodeOutput(stdout.Bytes()) + "\n" + decodeOutput(stderr.Bytes())
+	if err == nil && strings.Contains(strings.ToLower(output), "error:") {
+		err = errors.New("csptest reported error in output")
+	}
+	if err != nil {
+		return fmt.Errorf("%w: csptest: %v, output: %s", ErrPinCache, err, c.logOutput(output))
+	}
+
+	c.log(ctx).Info("container PIN cached",
+		"thumbprint", thumbprint,
+		"container", info.Container)
+
+	return nil
+}
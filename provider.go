@@ -0,0 +1,89 @@
+package cprovlib
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Типы криптопровайдеров КриптоПро CSP для ключей ГОСТ
+const (
+	ProviderTypeGOST2001    = 75 // ГОСТ Р 34.10-2001
+	ProviderTypeGOST2012256 = 80 // ГОСТ Р 34.10-2012 (256 бит)
+	ProviderTypeGOST2012512 = 81 // ГОСТ Р 34.10-2012 (512 бит)
+)
+
+// OID алгоритмов открытого ключа ГОСТ
+var (
+	oidPublicKeyGOST2001    = asn1.ObjectIdentifier{1, 2, 643, 2, 2, 19}
+	oidPublicKeyGOST2012256 = asn1.ObjectIdentifier{1, 2, 643, 7, 1, 1, 1, 1}
+	oidPublicKeyGOST2012512 = asn1.ObjectIdentifier{1, 2, 643, 7, 1, 1, 1, 2}
+)
+
+// providerTypeArgs возвращает аргументы cryptcp -provtype для подписи сертификатом thumbprint:
+// тип из WithProviderType или определенный по алгоритму ключа сертификата. Если тип определить
+// не удалось, аргументы не передаются и cryptcp использует провайдер по умолчанию
+func (c *CryptoCLI) providerTypeArgs(ctx context.Context, thumbprint string) []string {
+	providerType := c.providerType
+	if providerType == 0 {
+		providerType = c.detectProviderType(ctx, thumbprint)
+	}
+	if providerType == 0 {
+		return nil
+	}
+	return []string{"-provtype", strconv.Itoa(providerType)}
+}
+
+// detectProviderType определяет тип провайдера по алгоритму открытого ключа сертификата
+// из хранилища. Результат кэшируется по отпечатку, ошибка возвращает 0
+func (c *CryptoCLI) detectProviderType(ctx context.Context, thumbprint string) int {
+	key := strings.ToLower(thumbprint)
+	if cached, ok := c.providerTypes.Load(key); ok {
+		return cached.(int)
+	}
+
+	der, err := c.ExportCertificate(ctx, thumbprint)
+	if err == nil {
+		var providerType int
+		providerType, err = providerTypeFromCertificate(der)
+		if err == nil {
+			c.providerTypes.Store(key, providerType)
+			return providerType
+		}
+	}
+
+	c.log(ctx).Debug("provider type autodetection failed, using cryptcp default",
+		"thumbprint", thumbprint,
+		"error", err)
+	return 0
+}
+
+// providerTypeFromCertificate возвращает тип провайдера для алгоритма открытого ключа сертификата
+func providerTypeFromCertificate(der []byte) (int, error) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return 0, err
+	}
+
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(cert.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return 0, fmt.Errorf("parse public key info: %v", err)
+	}
+
+	switch {
+	case spki.Algorithm.Algorithm.Equal(oidPublicKeyGOST2012256):
+		return ProviderTypeGOST2012256, nil
+	case spki.Algorithm.Algorithm.Equal(oidPublicKeyGOST2012512):
+		return ProviderTypeGOST2012512, nil
+	case spki.Algorithm.Algorithm.Equal(oidPublicKeyGOST2001):
+		return ProviderTypeGOST2001, nil
+	}
+	return 0, fmt.Errorf("no provider type for public key algorithm %s", spki.Algorithm.Algorithm)
+}
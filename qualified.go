@@ -0,0 +1,102 @@
+package cprovlib
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+)
+
+// ErrNotQualified подпись действительна, но сертификат подписанта не содержит
+// требуемой политики квалифицированного сертификата
+var ErrNotQualified = errors.New("сертификат подписанта не является квалифицированным")
+
+// DefaultQualifiedPolicies OID политик классов средств электронной подписи КС1-КА1
+// (приказ ФСБ № 795): квалифицированный сертификат содержит хотя бы одну из них
+var DefaultQualifiedPolicies = []string{
+	"1.2.643.100.113.1", // КС1
+	"1.2.643.100.113.2", // КС2
+	"1.2.643.100.113.3", // КС3
+	"1.2.643.100.113.4", // КВ1
+	"1.2.643.100.113.5", // КВ2
+	"1.2.643.100.113.6", // КА1
+}
+
+// certPolicies возвращает OID политик из расширения certificatePolicies сертификата
+func certPolicies(cert *x509.Certificate) []string {
+	var policies []string
+	for _, oid := range cert.Policies {
+		policies = append(policies, oid.String())
+	}
+	return policies
+}
+
+// VerifyQualified проверяет подпись так же, как VerifySignature, и что сертификат каждого
+// подписанта содержит хотя бы одну политику из WithQualifiedPolicies (по умолчанию
+// DefaultQualifiedPolicies). Возвращает true без ошибки для квалифицированной подписи,
+// ErrInvalidSignature для недействительной подписи и ErrNotQualified для действительной
+// подписи сертификатом без требуемой политики
+func (c *CryptoCLI) VerifyQualified(ctx context.Context, dataBase64 string, sigBase64 string, opts ...VerifyOption) (bool, error) {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "VerifyQualified")
+	defer span.End()
+
+	result, err := c.VerifySignature(ctx, dataBase64, sigBase64, opts...)
+	if err != nil {
+		return false, err
+	}
+	if !result.Valid {
+		return false, fmt.Errorf("%w: %s", ErrInvalidSignature, result.Error)
+	}
+
+	// Подпись уже декодирована VerifySignature без ошибки
+	signData, _ := c.decodeBase64(sigBase64)
+	signData, _ = normalizeSignatureEncoding(signData)
+
+	// В фиктивной подписи нет сертификата: квалифицированной она не бывает
+	if isFakeSignature(signData) {
+		return false, fmt.Errorf("%w: fake backend signature has no certificate", ErrNotQualified)
+	}
+
+	required := c.qualifiedPolicies
+	if len(required) == 0 {
+		required = DefaultQualifiedPolicies
+	}
+
+	sd, err := parseSignedData(signData)
+	if err != nil {
+		return false, fmt.Errorf("%w: parse signature: %v", ErrVerification, err)
+	}
+	signers, err := sd.signers()
+	if err != nil {
+		return false, fmt.Errorf("%w: parse signature: %v", ErrVerification, err)
+	}
+
+	for i := range signers {
+		cert, err := sd.signerCertificate(&signers[i])
+		if err != nil {
+			return false, fmt.Errorf("%w: signer %d: %v", ErrNotQualified, i, err)
+		}
+
+		policies := certPolicies(cert)
+		if slices.ContainsFunc(required, func(oid string) bool { return slices.Contains(policies, oid) }) {
+			continue
+		}
+
+		thumbprint := certThumbprint(cert)
+		c.log(ctx).Warn("signer certificate has no qualified certificate policy",
+			"signer", i,
+			"thumbprint", thumbprint,
+			"policies", policies,
+			"required", required)
+
+		return false, fmt.Errorf("%w: certificate %s has policies [%s], required one of [%s]",
+			ErrNotQualified, thumbprint, strings.Join(policies, ", "), strings.Join(required, ", "))
+	}
+
+	return true, nil
+}
@@ -0,0 +1,70 @@
+package cprovlib
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tokenBucket ограничитель частоты запросов по алгоритму token bucket
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64   // Пополнение токенов в секунду
+	burst  float64   // Максимальное количество накопленных токенов
+	tokens float64   // Текущее количество токенов
+	last   time.Time // Время последнего пополнения
+}
+
+func newTokenBucket(rps float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rps,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait ожидает свободный токен. Возвращает ошибку контекста, если он отменен раньше
+func (b *tokenBucket) wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+
+		delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// acquireSignSlot ожидает свободный слот подписи (WithMaxConcurrency) и возвращает функцию
+// его освобождения. Без ограничения возвращается сразу
+func (c *CryptoCLI) acquireSignSlot(ctx context.Context) (func(), error) {
+	if c.signSlots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case c.signSlots <- struct{}{}:
+		return func() { <-c.signSlots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,94 @@
+package cprovlib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketBurst(t *testing.T) {
+	tests := []struct {
+		name      string
+		rps       float64
+		burst     int
+		immediate int // Запросы без ожидания
+	}{
+		{name: "burst of one", rps: 10, burst: 1, immediate: 1},
+		{name: "burst of three", rps: 10, burst: 3, immediate: 3},
+		{name: "zero burst treated as one", rps: 10, burst: 0, immediate: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTokenBucket(tt.rps, tt.burst)
+			ctx := context.Background()
+
+			start := time.Now()
+			for i := range tt.immediate {
+				if err := b.wait(ctx); err != nil {
+					t.Fatalf("wait %d: %v", i, err)
+				}
+			}
+			if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+				t.Fatalf("burst of %d took %s", tt.immediate, elapsed)
+			}
+
+			// Следующий запрос ждет пополнения одного токена: 1/rps
+			start = time.Now()
+			if err := b.wait(ctx); err != nil {
+				t.Fatal(err)
+			}
+			interval := time.Duration(float64(time.Second) / tt.rps)
+			if elapsed := time.Since(start); elapsed < interval*8/10 {
+				t.Fatalf("request after burst waited %s, want about %s", elapsed, interval)
+			}
+		})
+	}
+}
+
+func TestTokenBucketContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctx     func() (context.Context, context.CancelFunc)
+		wantErr error
+	}{
+		{
+			name: "deadline",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 20*time.Millisecond)
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name: "canceled",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx, cancel
+			},
+			wantErr: context.Canceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Один токен в час: второй запрос дождется только отмены контекста
+			b := newTokenBucket(1.0/3600, 1)
+			if err := b.wait(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			start := time.Now()
+			err := b.wait(ctx)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("wait error %v, want %v", err, tt.wantErr)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Fatalf("wait returned after %s", elapsed)
+			}
+		})
+	}
+}
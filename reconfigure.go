@@ -0,0 +1,119 @@
+package cprovlib
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ErrInvalidConfig недопустимые настройки клиента
+var ErrInvalidConfig = errors.New("некорректная конфигурация")
+
+// defaultSignTimeout ограничение времени одной подписи со всеми повторами по умолчанию.
+// Для CAdES-T (с TSP) операция может занять много времени
+const defaultSignTimeout = 5 * time.Minute
+
+// RuntimeConfig настройки клиента, которые можно менять во время работы через Reconfigure.
+// Начальные значения задаются аргументами New и опциями
+type RuntimeConfig struct {
+	TSPServers          []TSPServer   // Службы временных меток (TSP), пустой список - DefaultTSPServers
+	SignType            uint          // Тип подписи по умолчанию: 0 = CAdES-BES, 1 = CAdES-T, 2 = CAdES-X Long Type 1
+	SkipChainValidation bool          // Отключить проверку цепочки и отзыва сертификатов (флаги -nochain -norev)
+	SignTimeout         time.Duration // Время одной подписи со всеми повторами
+	AttemptTimeout      time.Duration // Время одной попытки cryptcp в пределах SignTimeout, 0 - без отдельного ограничения (WithAttemptTimeout)
+	CertmgrTimeout      time.Duration // Таймаут операций certmgr, 0 - только контекст вызова (WithCertmgrTimeout)
+	RetryMaxAttempts    int           // Попытки при HTTP ошибках TSP (WithRetryPolicy)
+	RetryBackoff        time.Duration // Пауза перед второй попыткой, растет линейно (WithRetryPolicy)
+	TSPFailoverAttempts int           // TSP серверы одной подписи (WithRetryBudget), 0 - по RetryMaxAttempts
+	TransientAttempts   int           // Попытки на одном TSP сервере перед переключением (WithRetryBudget)
+
+	invalidTSP error // Некорректные адреса TSP, отброшенные New (ConfigError)
+}
+
+// settings возвращает текущие настройки клиента. Возвращенное значение не изменяется:
+// Reconfigure заменяет его новым, поэтому операция, получившая настройки, работает с ними до конца
+func (c *CryptoCLI) settings() *RuntimeConfig {
+	return c.config.Load()
+}
+
+// RuntimeConfig возвращает копию текущих настроек клиента для изменения и передачи в Reconfigure
+func (c *CryptoCLI) RuntimeConfig() RuntimeConfig {
+	config := *c.settings()
+	config.TSPServers = slices.Clone(config.TSPServers)
+	return config
+}
+
+// Reconfigure атомарно заменяет настройки клиента для последующих операций, не пересоздавая
+// клиент. Начатые подписи и проверки завершаются с прежними настройками. Безопасен для вызова
+// одновременно с операциями клиента. Изменяемые поля берутся из RuntimeConfig:
+//
+//	config := client.RuntimeConfig()
+//	config.TSPServers = newServers
+//	config.SkipChainValidation = false
+//	err := client.Reconfigure(config)
+//
+// Недопустимые настройки возвращают ErrInvalidConfig, текущие настройки при этом не меняются
+func (c *CryptoCLI) Reconfigure(config RuntimeConfig) error {
+	err := config.validate()
+	if err != nil {
+		return err
+	}
+
+	if len(config.TSPServers) == 0 {
+		config.TSPServers = tspServersFromURLs(DefaultTSPServers)
+	} else {
+		config.TSPServers, err = normalizeTSPServers(config.TSPServers)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+		}
+	}
+	if config.TSPFailoverAttempts > 0 {
+		config.TransientAttempts = max(config.TransientAttempts, 1)
+	}
+	config.invalidTSP = nil
+
+	previous := c.config.Swap(&config)
+
+	c.logger.Info("client reconfigured",
+		"tspServersCount", len(config.TSPServers),
+		"signType", config.SignType,
+		"skipChainValidation", config.SkipChainValidation,
+		"previousSkipChainValidation", previous.SkipChainValidation,
+		"signTimeout", config.SignTimeout.Seconds(),
+		"certmgrTimeout", config.CertmgrTimeout.Seconds(),
+		"retryMaxAttempts", config.RetryMaxAttempts)
+
+	return nil
+}
+
+// ConfigError возвращает ошибку настроек, найденную New, обернутую в ErrInvalidConfig:
+// некорректные адреса TSP серверов (ErrInvalidTSPURL), отброшенные из списка. Без ошибок
+// и после успешного Reconfigure возвращает nil. NewFromConfig возвращает такие ошибки сразу
+func (c *CryptoCLI) ConfigError() error {
+	err := c.settings().invalidTSP
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+}
+
+// validate проверяет настройки, которые нельзя исправить значением по умолчанию
+func (config *RuntimeConfig) validate() error {
+	if config.SignType > SignTypeXLongType1 {
+		return fmt.Errorf("%w: unknown sign type %d", ErrInvalidConfig, config.SignType)
+	}
+	if config.SignTimeout <= 0 {
+		return fmt.Errorf("%w: sign timeout must be positive, got %s", ErrInvalidConfig, config.SignTimeout)
+	}
+	if config.RetryMaxAttempts < 1 {
+		return fmt.Errorf("%w: retry attempts must be at least 1, got %d", ErrInvalidConfig, config.RetryMaxAttempts)
+	}
+	if config.RetryBackoff < 0 || config.CertmgrTimeout < 0 || config.AttemptTimeout < 0 {
+		return fmt.Errorf("%w: negative duration", ErrInvalidConfig)
+	}
+	if config.TSPFailoverAttempts < 0 || config.TransientAttempts < 0 {
+		return fmt.Errorf("%w: negative retry budget", ErrInvalidConfig)
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package cprovlib
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+)
+
+// ErrCertificateRenewal ошибка продления сертификата
+var ErrCertificateRenewal = errors.New("ошибка продления сертификата")
+
+// RenewalRequestHandler передает запрос на сертификат (PKCS#10 в DER) в УЦ и возвращает
+// выданный сертификат (DER или PEM)
+type RenewalRequestHandler func(ctx context.Context, request []byte) ([]byte, error)
+
+// dnAttributeNames имена атрибутов DN, которые принимает cryptcp -dn.
+// Остальные атрибуты (ИНН, ОГРН, СНИЛС) передаются по OID
+var dnAttributeNames = map[string]string{
+	"2.5.4.3":              "CN",
+	"2.5.4.4":              "SN",
+	"2.5.4.5":              "SERIALNUMBER",
+	"2.5.4.6":              "C",
+	"2.5.4.7":              "L",
+	"2.5.4.8":              "S",
+	"2.5.4.9":              "STREET",
+	"2.5.4.10":             "O",
+	"2.5.4.11":             "OU",
+	"2.5.4.12":             "T",
+	"2.5.4.42":             "G",
+	"1.2.840.113549.1.9.1": "E",
+}
+
+// RenewCertificate продлевает сертификат с отпечатком thumbprint без смены ключа: создает через
+// cryptcp -creatrqst запрос на сертификат с тем же владельцем по ключу из контейнера сертификата,
+// передает его в УЦ через handler и устанавливает выданный сертификат в хранилище клиента,
+// связывая его с тем же контейнером. Выданный сертификат должен содержать тот же открытый ключ.
+// Возвращает отпечаток нового сертификата; старый сертификат из хранилища не удаляется
+func (c *CryptoCLI) RenewCertificate(ctx context.Context, thumbprint string, pin string, handler RenewalRequestHandler) (string, error) {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "RenewCertificate")
+	defer span.End()
+
+	if handler == nil {
+		return "", fmt.Errorf("%w: renewal request handler is required", ErrCertificateRenewal)
+	}
+
+	thumbprint, err := NormalizeThumbprint(thumbprint)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrCertificateRenewal, err)
+	}
+
+	info, err := c.certificateInfo(ctx, thumbprint)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrCertificateRenewal, err)
+	}
+	if !info.HasPrivateKey || info.Container == "" {
+		return "", fmt.Errorf("%w: certificate %s is not linked to a private key container", ErrCertificateRenewal, thumbprint)
+	}
+
+	der, err := c.ExportCertificate(ctx, thumbprint)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrCertificateRenewal, err)
+	}
+	current, err := x509.ParseCertificate(der)
+	if err != nil {
+		return "", fmt.Errorf("%w: parse certificate: %v", ErrCertificateRenewal, err)
+	}
+
+	providerType := info.ProviderType
+	if providerType == 0 {
+		providerType, _ = providerTypeFromCertificate(der)
+	}
+
+	workDir, err := c.newWorkDirIn(c.installTmpBase())
+	if err != nil {
+		return "", fmt.Errorf("%w: create work directory: %v", ErrCertificateRenewal, err)
+	}
+	defer c.removeWorkDir(workDir)
+
+	request, err := c.createRenewalRequest(ctx, workDir, current, info.Container, providerType, pin)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrCertificateRenewal, err)
+	}
+
+	c.log(ctx).Info("certificate renewal request created",
+		"thumbprint", thumbprint,
+		"container", info.Container,
+		"subject", current.Subject.String())
+
+	response, err := handler(ctx, request)
+	if err != nil {
+		return "", fmt.Errorf("%w: renewal request handler: %w", ErrCertificateRenewal, err)
+	}
+	if block, _ := pem.Decode(response); block != nil {
+		response = block.Bytes
+	}
+
+	renewed, err := x509.ParseCertificate(response)
+	if err != nil {
+		return "", fmt.Errorf("%w: parse issued certificate: %v", ErrCertificateRenewal, err)
+	}
+	if !bytes.Equal(renewed.RawSubjectPublicKeyInfo, current.RawSubjectPublicKeyInfo) {
+		return "", fmt.Errorf("%w: issued certificate %s has a different public key than the container %s",
+			ErrCertificateRenewal, renewed.Subject, info.Container)
+	}
+
+	certFilePath := filepath.Join(workDir, "renewed.cer")
+	err = c.fileSystem.WriteFile(certFilePath, renewed.Raw, 0600)
+	if err != nil {
+		return "", fmt.Errorf("%w: write issued certificate: %v", ErrCertificateRenewal, err)
+	}
+
+	_, stderr, err := c.runCertmgr(ctx,
+		"-install",
+		"-store", c.store,
+		"-file", certFilePath,
+		"-cont", info.Container,
+	)
+	if err != nil {
+		return "", fmt.Errorf("%w: certmgr install: %v, stderr: %s", ErrCertificateRenewal, err, stderr)
+	}
+
+	newThumbprint := certThumbprint(renewed)
+	c.stats.certsInstalled.Add(1)
+	c.log(ctx).Info("renewed certificate installed",
+		"thumbprint", thumbprint,
+		"newThumbprint", newThumbprint,
+		"container", info.Container,
+		"notAfter", renewed.NotAfter)
+
+	return newThumbprint, nil
+}
+
+// certificateInfo возвращает сведения certmgr о сертификате хранилища клиента
+func (c *CryptoCLI) certificateInfo(ctx context.Context, thumbprint string) (*CertificateInfo, error) {
+	output, err := c.listStore(ctx, c.store)
+	if err != nil {
+		return nil, err
+	}
+	for _, cert := range parseCertmgrList(output) {
+		if cert.Thumbprint == thumbprint {
+			return &cert, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: thumbprint %s in store %s", ErrCertNotFound, thumbprint, c.store)
+}
+
+// createRenewalRequest создает запрос на сертификат (DER) с владельцем current по существующему
+// ключу контейнера container (cryptcp -creatrqst -nokeygen)
+func (c *CryptoCLI) createRenewalRequest(ctx context.Context, workDir string, current *x509.Certificate, container string, providerType int, pin string) ([]byte, error) {
+	dn, err := cryptcpDN(current.RawSubject)
+	if err != nil {
+		return nil, fmt.Errorf("certificate subject: %v", err)
+	}
+
+	args := []string{
+		"-creatrqst",
+		"-cont", container,
+		"-nokeygen",
+		"-dn", dn,
+		"-der",
+	}
+	if providerType != 0 {
+		args = append(args, "-provtype", strconv.Itoa(providerType))
+	}
+	if pin != "" {
+		args = append(args, "-pin", pin)
+	}
+	args = append(args, "request.req")
+
+	stdout, stderr, err := c.runCryptcp(ctx, workDir, args...)
+	if err == nil && strings.Contains(strings.ToLower(stdout+stderr), "error:") {
+		err = errors.New("cryptcp reported error in output")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cryptcp create request: %v, stdout: %s, stderr: %s", err, c.logOutput(stdout), c.logOutput(stderr))
+	}
+
+	request, err := c.fileSystem.ReadFile(filepath.Join(workDir, "request.req"))
+	if err != nil {
+		return nil, fmt.Errorf("read request file: %v", err)
+	}
+
+	// Без поддержки -der cryptcp записывает запрос в base64 или PEM
+	if block, _ := pem.Decode(request); block != nil {
+		request = block.Bytes
+	} else if decoded, err := c.decodeBase64(normalizeBase64(string(request))); err == nil {
+		request = decoded
+	}
+
+	return request, nil
+}
+
+// cryptcpDN формирует DN для cryptcp -dn из DER имени сертификата в исходном порядке атрибутов.
+// Значения с разделителями и кавычками заключаются в кавычки, как в CertStrToName
+func cryptcpDN(rawSubject []byte) (string, error) {
+	var rdns pkix.RDNSequence
+	if _, err := asn1.Unmarshal(rawSubject, &rdns); err != nil {
+		return "", err
+	}
+
+	var parts []string
+	for _, rdn := range rdns {
+		for _, attr := range rdn {
+			name, ok := dnAttributeNames[attr.Type.String()]
+			if !ok {
+				name = attr.Type.String()
+			}
+			value := fmt.Sprint(attr.Value)
+			if strings.ContainsAny(value, `,;+=<>#"`) || strings.TrimSpace(value) != value {
+				value = `"` + strings.ReplaceAll(value, `"`, `""`) + `"`
+			}
+			parts = append(parts, name+"="+value)
+		}
+	}
+	if len(parts) == 0 {
+		return "", errors.New("empty subject")
+	}
+
+	return strings.Join(parts, ", "), nil
+}
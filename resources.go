@@ -0,0 +1,138 @@
+package cprovlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrTokenUnresponsive утилита не вывела ничего и не завершилась за время WithStartupTimeout:
+// обычно это зависший токен или считыватель
+var ErrTokenUnresponsive = errors.New("токен не отвечает")
+
+// run запускает команду и применяет к процессу ограничения ресурсов (WithNiceness, WithCgroup).
+// С WithStartupTimeout процесс, не выведший ничего за отведенное время, завершается.
+// О каждом запуске сообщается WithCommandObserver
+func (c *CryptoCLI) run(ctx context.Context, cmd *exec.Cmd) error {
+	if c.commandObserver == nil {
+		return c.runProcess(cmd)
+	}
+
+	startedAt := time.Now()
+	err := c.runProcess(cmd)
+
+	record := CommandRecord{
+		Tool:          filepath.Base(cmd.Path),
+		Path:          cmd.Path,
+		Args:          maskCommandArgs(cmd.Args[1:]),
+		StartedAt:     startedAt,
+		Duration:      time.Since(startedAt),
+		ExitCode:      exitCode(err),
+		CorrelationID: correlationID(ctx),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	c.commandObserver(record)
+
+	return err
+}
+
+// runProcess запускает процесс и дожидается его завершения
+func (c *CryptoCLI) runProcess(cmd *exec.Cmd) error {
+	var firstOutput chan struct{}
+	if c.startupTimeout > 0 {
+		firstOutput = make(chan struct{})
+		notify := sync.OnceFunc(func() { close(firstOutput) })
+		cmd.Stdout = &activityWriter{w: cmd.Stdout, notify: notify}
+		cmd.Stderr = &activityWriter{w: cmd.Stderr, notify: notify}
+	}
+
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	c.applyResourceLimits(cmd)
+
+	if firstOutput == nil {
+		return cmd.Wait()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	timer := time.NewTimer(c.startupTimeout)
+	defer timer.Stop()
+
+	select {
+	case err = <-done:
+		return err
+	case <-firstOutput:
+		return <-done
+	case <-timer.C:
+		_ = cmd.Process.Kill()
+		<-done
+		c.logger.Error("subprocess produced no output within startup timeout, killed",
+			"path", cmd.Path,
+			"pid", cmd.Process.Pid,
+			"startupTimeout", c.startupTimeout.Seconds())
+		return fmt.Errorf("%w: %s produced no output within %s", ErrTokenUnresponsive, filepath.Base(cmd.Path), c.startupTimeout)
+	}
+}
+
+// activityWriter сообщает о первой записи в вывод процесса
+type activityWriter struct {
+	w      io.Writer
+	notify func()
+}
+
+func (a *activityWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		a.notify()
+	}
+	if a.w == nil {
+		return len(p), nil
+	}
+	return a.w.Write(p)
+}
+
+// applyResourceLimits понижает приоритет запущенного процесса и помещает его в cgroup.
+// Ограничения применяются сразу после запуска, поэтому первые мгновения процесс работает
+// с обычным приоритетом. Ошибки не прерывают операцию и только логируются
+func (c *CryptoCLI) applyResourceLimits(cmd *exec.Cmd) {
+	pid := cmd.Process.Pid
+
+	if c.niceness != 0 {
+		err := setNiceness(pid, c.niceness)
+		if err != nil {
+			c.logger.Warn("failed to set subprocess niceness",
+				"path", cmd.Path,
+				"pid", pid,
+				"niceness", c.niceness,
+				"error", err)
+		}
+	}
+
+	if c.cgroup != "" {
+		// Запись PID в cgroup.procs переносит процесс в группу (cgroup v1 и v2)
+		procs := filepath.Join(c.cgroup, "cgroup.procs")
+		err := os.WriteFile(procs, []byte(strconv.Itoa(pid)), 0)
+		if err != nil {
+			c.logger.Warn("failed to move subprocess to cgroup",
+				"path", cmd.Path,
+				"pid", pid,
+				"cgroup", c.cgroup,
+				"error", err)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package cprovlib
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// RevocationStatus результат проверки отзыва сертификата подписанта
+type RevocationStatus string
+
+const (
+	RevocationGood       RevocationStatus = "good"        // Сертификат не отозван
+	RevocationRevoked    RevocationStatus = "revoked"     // Сертификат отозван
+	RevocationUnknown    RevocationStatus = "unknown"     // Статус не удалось получить (CRL/OCSP недоступны)
+	RevocationNotChecked RevocationStatus = "not_checked" // Проверка отзыва отключена (skipChainValidation)
+)
+
+// RevocationInfo сведения о проверке отзыва при проверке подписи
+type RevocationInfo struct {
+	Status RevocationStatus `json:"status"`
+	Method string           `json:"method,omitempty"` // "ocsp" или "crl"
+	Source string           `json:"source,omitempty"` // Адрес OCSP или точки распространения CRL
+	// SourceFromCertificate источник взят из сертификата подписанта, т.к. cryptcp не вывел
+	// адрес, по которому обращался
+	SourceFromCertificate bool `json:"sourceFromCertificate,omitempty"`
+	// OfflineCRL статус определен по списку отзыва из VerifyWithCRLs
+	OfflineCRL bool `json:"offlineCrl,omitempty"`
+}
+
+// Коды ошибок КриптоПро, относящиеся к отзыву сертификата
+var (
+	revokedErrorCodes = []string{
+		"0x80092010", // CRYPT_E_REVOKED
+		"0x800b010c", // CERT_E_REVOKED
+	}
+	revocationUnknownErrorCodes = []string{
+		"0x80092012", // CRYPT_E_NO_REVOCATION_CHECK
+		"0x80092013", // CRYPT_E_REVOCATION_OFFLINE
+		"0x800b010e", // CERT_E_REVOCATION_FAILURE
+	}
+)
+
+// revokedMarkers текст сообщения об отозванном сертификате. Отдельные слова "revoked"
+// и "отозван" не подходят: они встречаются и в отрицательной форме
+var revokedMarkers = []string{"certificate is revoked", "certificate was revoked", "сертификат отозван"}
+
+// urlPattern адрес в выводе cryptcp
+var urlPattern = regexp.MustCompile(`https?://[^\s"'<>]+`)
+
+// parseRevocation определяет статус отзыва по коду завершения и выводу cryptcp -verify.
+// cryptcp не выводит статус отзыва при успешной проверке отдельной строкой, поэтому
+// успешная проверка с включенной проверкой отзыва считается статусом good
+func parseRevocation(output string, verified bool, checked bool) *RevocationInfo {
+	info := &RevocationInfo{Status: RevocationUnknown}
+	lower := strings.ToLower(output)
+
+	switch {
+	case !checked:
+		info.Status = RevocationNotChecked
+	case containsAny(lower, revokedErrorCodes) || containsAny(lower, revokedMarkers):
+		info.Status = RevocationRevoked
+	case containsAny(lower, revocationUnknownErrorCodes):
+		info.Status = RevocationUnknown
+	case verified:
+		info.Status = RevocationGood
+	}
+
+	// Адрес OCSP или CRL, если cryptcp упомянул его в выводе
+	for _, u := range urlPattern.FindAllString(output, -1) {
+		method := revocationMethod(u)
+		if method != "" {
+			info.Method = method
+			info.Source = u
+			break
+		}
+	}
+
+	return info
+}
+
+// revocationMethod определяет по адресу, относится ли он к OCSP или CRL
+func revocationMethod(address string) string {
+	lower := strings.ToLower(address)
+	switch {
+	case strings.Contains(lower, "ocsp"):
+		return "ocsp"
+	case strings.HasSuffix(lower, ".crl") || strings.Contains(lower, "crl"):
+		return "crl"
+	}
+	return ""
+}
+
+// revocationSourceFromCertificate заполняет источник проверки отзыва по расширениям
+// сертификата подписанта: адрес OCSP имеет приоритет над точкой распространения CRL
+func revocationSourceFromCertificate(info *RevocationInfo, cert *x509.Certificate) {
+	switch {
+	case len(cert.OCSPServer) > 0:
+		info.Method = "ocsp"
+		info.Source = cert.OCSPServer[0]
+	case len(cert.CRLDistributionPoints) > 0:
+		info.Method = "crl"
+		info.Source = cert.CRLDistributionPoints[0]
+	default:
+		return
+	}
+	info.SourceFromCertificate = true
+}
+
+// signerCertificateFromFile возвращает сертификат первого подписанта из файла подписи
+func (c *CryptoCLI) signerCertificateFromFile(workDir string, signFile string) (*x509.Certificate, error) {
+	path := signFile
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workDir, signFile)
+	}
+
+	signData, err := c.fileSystem.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sd, err := parseSignedData(signData)
+	if err != nil {
+		return nil, err
+	}
+	signers, err := sd.signers()
+	if err != nil {
+		return nil, err
+	}
+	if len(signers) == 0 {
+		return nil, os.ErrNotExist
+	}
+
+	return sd.signerCertificate(&signers[0])
+}
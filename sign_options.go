@@ -0,0 +1,133 @@
+package cprovlib
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnsupportedSignMode форма подписи не поддерживается cryptcp
+var ErrUnsupportedSignMode = errors.New("неподдерживаемая форма подписи")
+
+// SignMode форма подписи относительно подписываемых данных
+type SignMode string
+
+const (
+	// SignModeDetached отделенная подпись: CMS без данных, документ передается отдельно (.sgn)
+	SignModeDetached SignMode = "detached"
+	// SignModeEnveloping обертывающая подпись: данные вложены в CMS SignedData (.sig, attached)
+	SignModeEnveloping SignMode = "enveloping"
+	// SignModeEnveloped подпись внутри подписываемого документа (XMLDSig enveloped).
+	// cryptcp создает только CMS, поэтому эта форма не поддерживается
+	SignModeEnveloped SignMode = "enveloped"
+)
+
+// SignOption дополнительный параметр отдельного вызова SignDocument
+type SignOption func(*signOptions)
+
+// signOptions параметры, переопределяющие настройки клиента для одного вызова
+type signOptions struct {
+	tspServers        []TSPServer        // Список TSP серверов для этого вызова
+	tspServersSet     bool               // Список TSP серверов передан явно
+	container         string             // Полное имя контейнера ключа (FQCN) с указанием считывателя
+	mode              SignMode           // Явно заданная форма подписи
+	textNormalization *textNormalization // Нормализация текста перед подписью (SignWithTextNormalization)
+	operationID       string             // Идентификатор операции вызывающей стороны (SignWithOperationID)
+	digestAlgorithm   DigestAlgorithm    // Алгоритм хэша подписи (SignWithDigestAlgorithm)
+}
+
+// SignWithTSPServers задает список TSP серверов для одного вызова SignDocument
+// вместо списка, переданного в New. Для CAdES-T список не должен быть пустым
+func SignWithTSPServers(servers ...string) SignOption {
+	return func(o *signOptions) {
+		o.tspServers = tspServersFromURLs(servers)
+		o.tspServersSet = true
+	}
+}
+
+// SignWithOperationID задает идентификатор операции вызывающей стороны (например, ID бизнес
+// транзакции) для одного вызова подписи. Идентификатор добавляется полем operationId во все
+// записи лога подписи, в атрибут span cprovlib.operation_id, в CommandRecord.CorrelationID
+// и возвращается в SignResult.OperationID. Заменяет идентификатор ContextWithCorrelationID
+func SignWithOperationID(id string) SignOption {
+	return func(o *signOptions) {
+		o.operationID = id
+	}
+}
+
+// SignWithDigestAlgorithm задает алгоритм хэша подписи для одного вызова (cryptcp -hashAlg)
+// независимо от размера ключа: DigestGOST2012256 или DigestGOST2012512. С ключом ГОСТ Р 34.10-2012
+// 256 бит допустимы оба, с ключом 512 бит - только DigestGOST2012512. Несовместимый с ключом
+// алгоритм возвращает ErrDigestIncompatible до запуска подписи. По умолчанию хэш
+// соответствует ключу
+func SignWithDigestAlgorithm(algorithm DigestAlgorithm) SignOption {
+	return func(o *signOptions) {
+		o.digestAlgorithm = algorithm
+	}
+}
+
+// SignWithTSP задает TSP серверы с учетными данными для одного вызова SignDocument
+// вместо списка клиента (см. WithTSPServers)
+func SignWithTSP(servers ...TSPServer) SignOption {
+	return func(o *signOptions) {
+		o.tspServers = servers
+		o.tspServersSet = true
+	}
+}
+
+// SignWithContainer указывает контейнер закрытого ключа для одного вызова SignDocument
+// (флаг cryptcp -cont). Используется, когда подключено несколько токенов (Рутокен, JaCarta):
+// полное имя вида "\\.\Aktiv Rutoken ECP 00 00\container" однозначно задает считыватель.
+// Полные имена доступных контейнеров возвращает ListContainers
+func SignWithContainer(container string) SignOption {
+	return func(o *signOptions) {
+		o.container = container
+	}
+}
+
+// SignWithMode явно задает форму подписи для одного вызова SignDocument вместо
+// параметра attachSignature. SignModeDetached соответствует attachSignature=false,
+// SignModeEnveloping — attachSignature=true. Для SignModeEnveloped и неизвестных значений
+// возвращается ErrUnsupportedSignMode, как и при противоречии с явно переданным attachSignature
+func SignWithMode(mode SignMode) SignOption {
+	return func(o *signOptions) {
+		o.mode = mode
+	}
+}
+
+// resolveAttached определяет, создавать ли присоединенную подпись: явный attachSignature,
+// затем SignWithMode, затем defaultAttached клиента (WithDefaultAttached)
+func (o *signOptions) resolveAttached(attachSignature *bool, defaultAttached bool) (bool, error) {
+	var attached bool
+	switch o.mode {
+	case "":
+		if attachSignature != nil {
+			return *attachSignature, nil
+		}
+		return defaultAttached, nil
+	case SignModeDetached:
+		attached = false
+	case SignModeEnveloping:
+		attached = true
+	case SignModeEnveloped:
+		return false, fmt.Errorf("%w: %s: cryptcp creates CMS signatures only, use %s or %s",
+			ErrUnsupportedSignMode, o.mode, SignModeEnveloping, SignModeDetached)
+	default:
+		return false, fmt.Errorf("%w: %q", ErrUnsupportedSignMode, o.mode)
+	}
+
+	if attachSignature != nil && *attachSignature != attached {
+		return false, fmt.Errorf("%w: mode %s conflicts with attachSignature=%t",
+			ErrUnsupportedSignMode, o.mode, *attachSignature)
+	}
+
+	return attached, nil
+}
+
+// newSignOptions применяет опции вызова
+func newSignOptions(opts []SignOption) *signOptions {
+	o := &signOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
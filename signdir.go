@@ -0,0 +1,240 @@
+package cprovlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+)
+
+// Параметры SignDirectory по умолчанию
+const (
+	defaultDirectoryPattern = "*"
+	defaultSignatureSuffix  = ".sig"
+	defaultDirectoryWorkers = 4
+)
+
+// DirectoryOption дополнительный параметр вызова SignDirectory
+type DirectoryOption func(*directoryOptions)
+
+// directoryOptions параметры одного вызова SignDirectory
+type directoryOptions struct {
+	pattern     string       // Шаблон имени подписываемых файлов (filepath.Match)
+	suffix      string       // Суффикс файла подписи, добавляемый к имени документа
+	workers     int          // Количество файлов, подписываемых одновременно
+	signOptions []SignOption // Опции подписи каждого файла
+	signType    *uint        // Тип подписи, nil - тип из конфига
+}
+
+// DirectoryPattern задает шаблон имени подписываемых файлов в синтаксисе filepath.Match,
+// например "*.pdf". По умолчанию подписываются все файлы директории
+func DirectoryPattern(pattern string) DirectoryOption {
+	return func(o *directoryOptions) {
+		o.pattern = pattern
+	}
+}
+
+// DirectorySignatureSuffix задает суффикс файла подписи (по умолчанию ".sig": file.pdf -> file.pdf.sig).
+// Файлы с этим суффиксом не подписываются
+func DirectorySignatureSuffix(suffix string) DirectoryOption {
+	return func(o *directoryOptions) {
+		o.suffix = suffix
+	}
+}
+
+// DirectoryWorkers задает количество файлов, подписываемых одновременно (по умолчанию 4).
+// Общее число запусков cryptcp дополнительно ограничивает WithMaxConcurrency
+func DirectoryWorkers(n int) DirectoryOption {
+	return func(o *directoryOptions) {
+		o.workers = n
+	}
+}
+
+// DirectorySignType задает тип подписи CAdES для всех файлов вместо типа из конфига
+func DirectorySignType(signType uint) DirectoryOption {
+	return func(o *directoryOptions) {
+		o.signType = &signType
+	}
+}
+
+// DirectorySignOptions передает опции подписи каждого файла (TSP серверы, контейнер).
+// Подпись по умолчанию отсоединенная; присоединенную задает SignWithMode(SignModeEnveloping)
+func DirectorySignOptions(opts ...SignOption) DirectoryOption {
+	return func(o *directoryOptions) {
+		o.signOptions = append(o.signOptions, opts...)
+	}
+}
+
+// FileSignResult результат подписи одного файла SignDirectory
+type FileSignResult struct {
+	Path          string        `json:"path"`                    // Подписываемый файл
+	SignaturePath string        `json:"signaturePath,omitempty"` // Записанный файл подписи
+	Size          int64         `json:"size"`                    // Размер файла
+	SignType      uint          `json:"signType,omitempty"`      // Фактический тип подписи CAdES
+	TSPServer     string        `json:"tspServer,omitempty"`     // TSP сервер, выдавший штамп времени
+	Attempts      int           `json:"attempts,omitempty"`      // Количество запусков cryptcp
+	Duration      time.Duration `json:"duration"`                // Время подписи файла
+	Error         string        `json:"error,omitempty"`         // Ошибка подписи этого файла
+}
+
+// SignDirectory подписывает сертификатом thumbprint файлы директории dir (без вложенных
+// директорий), подходящие под DirectoryPattern, и записывает подпись рядом с каждым файлом
+// с суффиксом DirectorySignatureSuffix. Существующие файлы подписи перезаписываются.
+// Файлы подписываются параллельно, без копирования во временную директорию. Результаты
+// возвращаются в порядке имен файлов; если хотя бы один файл не подписан, возвращаются
+// результаты и ошибка ErrSignature со списком неудачных файлов
+func (c *CryptoCLI) SignDirectory(ctx context.Context, dir string, thumbprint string, pin string, opts ...DirectoryOption) ([]FileSignResult, error) {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "SignDirectory")
+	defer span.End()
+
+	options := &directoryOptions{
+		pattern: defaultDirectoryPattern,
+		suffix:  defaultSignatureSuffix,
+		workers: defaultDirectoryWorkers,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	thumbprint, err := NormalizeThumbprint(thumbprint)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSignature, err)
+	}
+	if _, err := filepath.Match(options.pattern, ""); err != nil {
+		return nil, fmt.Errorf("%w: invalid file pattern %q: %v", ErrSignature, options.pattern, err)
+	}
+	if options.suffix == "" {
+		return nil, fmt.Errorf("%w: signature suffix must not be empty", ErrSignature)
+	}
+	if options.workers < 1 {
+		options.workers = 1
+	}
+
+	files, err := c.directoryFiles(dir, options)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSignature, err)
+	}
+
+	startTime := time.Now()
+	results := make([]FileSignResult, len(files))
+	errs := make([]error, len(files))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(options.workers, len(files)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i], errs[i] = c.signDirectoryFile(ctx, files[i], thumbprint, pin, options)
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var failed []string
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, filepath.Base(files[i]))
+		}
+	}
+	if len(failed) > 0 {
+		c.log(ctx).Error("directory signing partially failed",
+			"dir", dir,
+			"files", len(files),
+			"failed", len(failed))
+		return results, fmt.Errorf("%w: %d of %d files failed (%s): %w",
+			ErrSignature, len(failed), len(files), strings.Join(failed, ", "), errors.Join(errs...))
+	}
+
+	c.log(ctx).Info("directory signing completed",
+		"dir", dir,
+		"files", len(files),
+		"duration", time.Since(startTime).Seconds())
+
+	return results, nil
+}
+
+// directoryFiles возвращает отсортированные по имени абсолютные пути подписываемых файлов dir
+func (c *CryptoCLI) directoryFiles(dir string, options *directoryOptions) ([]string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("directory path: %v", err)
+	}
+
+	// ReadDir возвращает записи, отсортированные по имени
+	entries, err := c.fileSystem.ReadDir(absDir)
+	if err != nil {
+		return nil, fmt.Errorf("read directory: %v", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasSuffix(name, options.suffix) {
+			continue
+		}
+		if matched, _ := filepath.Match(options.pattern, name); !matched {
+			continue
+		}
+		files = append(files, filepath.Join(absDir, name))
+	}
+
+	return files, nil
+}
+
+// signDirectoryFile подписывает файл path в собственной рабочей директории
+// и записывает подпись рядом с ним
+func (c *CryptoCLI) signDirectoryFile(ctx context.Context, path string, thumbprint string, pin string, options *directoryOptions) (FileSignResult, error) {
+	startTime := time.Now()
+	fileResult := FileSignResult{Path: path}
+
+	fail := func(err error) (FileSignResult, error) {
+		err = fmt.Errorf("%s: %w", filepath.Base(path), err)
+		fileResult.Duration = time.Since(startTime)
+		fileResult.Error = err.Error()
+		return fileResult, err
+	}
+
+	info, err := c.fileSystem.Stat(path)
+	if err != nil {
+		return fail(fmt.Errorf("%w: stat file: %v", ErrSignature, err))
+	}
+	fileResult.Size = info.Size()
+
+	if err := c.checkDataSize(info.Size()); err != nil {
+		return fail(fmt.Errorf("%w: %w", ErrSignature, err))
+	}
+
+	c.stats.signsAttempted.Add(1)
+	result, err := c.recordSign(c.signSharedFile(ctx, path, Signer{
+		Thumbprint: thumbprint,
+		PIN:        pin,
+		SignType:   options.signType,
+		Options:    options.signOptions,
+	}, startTime, 0))
+	if err != nil {
+		return fail(err)
+	}
+
+	signaturePath := path + options.suffix
+	if err := c.fileSystem.WriteFile(signaturePath, result.SignatureDER, 0644); err != nil {
+		return fail(fmt.Errorf("%w: write signature file: %v", ErrSignature, err))
+	}
+
+	fileResult.SignaturePath = signaturePath
+	fileResult.SignType = result.SignType
+	fileResult.TSPServer = result.TSPServer
+	fileResult.Attempts = result.Attempts
+	fileResult.Duration = time.Since(startTime)
+	return fileResult, nil
+}
@@ -0,0 +1,196 @@
+package cprovlib
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"time"
+)
+
+// OID атрибутов имени, используемых в квалифицированных сертификатах (приказ ФСБ № 795)
+var (
+	oidAttrINN    = asn1.ObjectIdentifier{1, 2, 643, 3, 131, 1, 1} // ИНН физического лица
+	oidAttrINNLE  = asn1.ObjectIdentifier{1, 2, 643, 100, 4}       // ИНН юридического лица
+	oidAttrOGRN   = asn1.ObjectIdentifier{1, 2, 643, 100, 1}       // ОГРН
+	oidAttrOGRNIP = asn1.ObjectIdentifier{1, 2, 643, 100, 5}       // ОГРНИП
+	oidAttrSNILS  = asn1.ObjectIdentifier{1, 2, 643, 100, 3}       // СНИЛС
+	oidAttrEmail  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}
+)
+
+// Состояние сертификата цепочки на время подписи
+const (
+	ChainCertValid       = "valid"         // Срок действия включает время подписи
+	ChainCertExpired     = "expired"       // Срок действия истек до времени подписи
+	ChainCertNotYetValid = "not_yet_valid" // Срок действия начался после времени подписи
+)
+
+// SignerInfo сведения о подписанте из подписи
+type SignerInfo struct {
+	Thumbprint   string           `json:"thumbprint"`             // SHA1 отпечаток сертификата
+	Subject      string           `json:"subject"`                // Владелец сертификата
+	Issuer       string           `json:"issuer"`                 // Издатель сертификата
+	SerialNumber string           `json:"serialNumber"`           // Серийный номер сертификата (hex)
+	CommonName   string           `json:"commonName,omitempty"`   // CN
+	Organization string           `json:"organization,omitempty"` // O
+	INN          string           `json:"inn,omitempty"`          // ИНН физического лица
+	INNLE        string           `json:"innLe,omitempty"`        // ИНН юридического лица
+	OGRN         string           `json:"ogrn,omitempty"`         // ОГРН организации
+	OGRNIP       string           `json:"ogrnip,omitempty"`       // ОГРНИП индивидуального предпринимателя
+	SNILS        string           `json:"snils,omitempty"`        // СНИЛС
+	Email        string           `json:"email,omitempty"`        // Адрес электронной почты
+	NotBefore    time.Time        `json:"notBefore"`              // Начало срока действия сертификата
+	NotAfter     time.Time        `json:"notAfter"`               // Окончание срока действия сертификата
+	SigningTime  *time.Time       `json:"signingTime,omitempty"`  // Атрибут signingTime этого подписанта
+	Chain        []ChainCertState `json:"chain"`                  // Цепочка из сертификатов подписи, от подписанта к корню
+	ChainEnd     string           `json:"chainEnd,omitempty"`     // Издатель, сертификата которого нет в подписи
+}
+
+// ChainCertState сертификат цепочки подписанта и его состояние на время подписи
+// (или на момент проверки, если время подписи неизвестно)
+type ChainCertState struct {
+	Thumbprint string    `json:"thumbprint"`
+	Subject    string    `json:"subject"`
+	NotBefore  time.Time `json:"notBefore"`
+	NotAfter   time.Time `json:"notAfter"`
+	Status     string    `json:"status"` // ChainCertValid, ChainCertExpired или ChainCertNotYetValid
+}
+
+// fillSignatureDetails заполняет время подписи и сведения о подписантах по структуре подписи.
+// Действительность подписи и цепочки при этом определяет cryptcp (VerifyResult.Valid)
+func fillSignatureDetails(result *VerifyResult, signData []byte) {
+	result.SigningTime, result.TimestampTime = signatureTimes(signData)
+	result.Signers = signerDetails(signData)
+}
+
+// signerDetails возвращает сведения обо всех подписантах; при ошибке разбора - nil
+func signerDetails(signData []byte) []SignerInfo {
+	sd, err := parseSignedData(signData)
+	if err != nil {
+		return nil
+	}
+	signers, err := sd.signers()
+	if err != nil {
+		return nil
+	}
+
+	var pool []*x509.Certificate
+	for _, der := range sd.certificatesDER() {
+		cert, err := x509.ParseCertificate(der)
+		if err == nil {
+			pool = append(pool, cert)
+		}
+	}
+
+	details := make([]SignerInfo, 0, len(signers))
+	for i := range signers {
+		cert, err := sd.signerCertificate(&signers[i])
+		if err != nil {
+			continue
+		}
+
+		info := SignerInfo{
+			Thumbprint:   certThumbprint(cert),
+			Subject:      cert.Subject.String(),
+			Issuer:       cert.Issuer.String(),
+			SerialNumber: fmt.Sprintf("%x", cert.SerialNumber),
+			NotBefore:    cert.NotBefore,
+			NotAfter:     cert.NotAfter,
+			SigningTime:  signerSigningTime(&signers[i]),
+		}
+		fillSubjectAttributes(&info, cert.Subject)
+
+		at := time.Now()
+		if info.SigningTime != nil {
+			at = *info.SigningTime
+		}
+		info.Chain, info.ChainEnd = chainStates(cert, pool, at)
+
+		details = append(details, info)
+	}
+
+	return details
+}
+
+// fillSubjectAttributes извлекает из имени владельца CN, O и реквизиты (ИНН, ОГРН, СНИЛС)
+func fillSubjectAttributes(info *SignerInfo, subject pkix.Name) {
+	info.CommonName = subject.CommonName
+	if len(subject.Organization) > 0 {
+		info.Organization = subject.Organization[0]
+	}
+
+	for _, attr := range subject.Names {
+		value, ok := attr.Value.(string)
+		if !ok {
+			continue
+		}
+		switch {
+		case attr.Type.Equal(oidAttrINN):
+			info.INN = value
+		case attr.Type.Equal(oidAttrINNLE):
+			info.INNLE = value
+		case attr.Type.Equal(oidAttrOGRN):
+			info.OGRN = value
+		case attr.Type.Equal(oidAttrOGRNIP):
+			info.OGRNIP = value
+		case attr.Type.Equal(oidAttrSNILS):
+			info.SNILS = value
+		case attr.Type.Equal(oidAttrEmail):
+			info.Email = value
+		}
+	}
+}
+
+// chainStates строит цепочку cert из сертификатов подписи pool и определяет состояние каждого
+// сертификата на время at. Если издателя нет в подписи, возвращает его имя вторым значением
+func chainStates(cert *x509.Certificate, pool []*x509.Certificate, at time.Time) ([]ChainCertState, string) {
+	var chain []ChainCertState
+	current := cert
+	for range maxChainLength {
+		state := ChainCertState{
+			Thumbprint: certThumbprint(current),
+			Subject:    current.Subject.String(),
+			NotBefore:  current.NotBefore,
+			NotAfter:   current.NotAfter,
+			Status:     ChainCertValid,
+		}
+		switch {
+		case at.Before(current.NotBefore):
+			state.Status = ChainCertNotYetValid
+		case at.After(current.NotAfter):
+			state.Status = ChainCertExpired
+		}
+		chain = append(chain, state)
+
+		if bytes.Equal(current.RawSubject, current.RawIssuer) {
+			return chain, ""
+		}
+
+		var issuer *x509.Certificate
+		for _, candidate := range pool {
+			if !candidate.Equal(current) && isIssuerCandidate(current, candidate) {
+				issuer = candidate
+				break
+			}
+		}
+		if issuer == nil {
+			return chain, current.Issuer.String()
+		}
+		current = issuer
+	}
+	return chain, ""
+}
+
+// signerSigningTime возвращает время из атрибута signingTime подписанта или nil
+func signerSigningTime(si *cmsSignerInfo) *time.Time {
+	attr := findAttribute(si.signedAttrs, oidAttrSigningTime)
+	if attr == nil || len(attr.values) == 0 {
+		return nil
+	}
+	var t time.Time
+	if _, err := asn1.Unmarshal(attr.values[0].FullBytes, &t); err != nil {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,116 @@
+package cprovlib
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SignerResult результат проверки подписи одного подписанта (SignerInfo) документа
+type SignerResult struct {
+	Index       int           `json:"index"`                 // Номер SignerInfo в подписи, с нуля
+	Thumbprint  string        `json:"thumbprint,omitempty"`  // SHA1 отпечаток сертификата подписанта, пустой, если сертификата нет в подписи
+	Subject     string        `json:"subject,omitempty"`     // Владелец сертификата подписанта
+	SigningTime *time.Time    `json:"signingTime,omitempty"` // Атрибут signingTime этого подписанта
+	Valid       bool          `json:"valid"`                 // Подпись этого подписанта действительна
+	Error       string        `json:"error,omitempty"`       // Причина недействительности
+	Failure     VerifyFailure `json:"failure,omitempty"`     // Класс причины недействительности
+}
+
+// AllValid сообщает, что подпись действительна и действительны подписи всех подписантов
+// из SignerResults. Для документов с несколькими подписантами проверяйте по SignerResults,
+// что присутствуют все обязательные подписанты
+func (r *VerifyResult) AllValid() bool {
+	if !r.Valid {
+		return false
+	}
+	for _, signer := range r.SignerResults {
+		if !signer.Valid {
+			return false
+		}
+	}
+	return true
+}
+
+// verifySigners заполняет result.SignerResults. Подпись с одним подписантом описывается
+// общим результатом cryptcp, а подпись каждого из нескольких подписантов проверяется отдельно:
+// cryptcp сообщает об ошибке подписи без указания подписанта. Если недействительна подпись
+// хотя бы одного подписанта, недействительна и подпись в целом
+func (c *CryptoCLI) verifySigners(ctx context.Context, config *RuntimeConfig, workDir string, dataFile string, signData []byte, result *VerifyResult) {
+	sd, err := parseSignedData(signData)
+	if err != nil {
+		return
+	}
+	signers, err := sd.signers()
+	if err != nil || len(signers) == 0 {
+		return
+	}
+
+	results := make([]SignerResult, len(signers))
+	for i := range signers {
+		results[i] = SignerResult{Index: i, SigningTime: signerSigningTime(&signers[i])}
+		if cert, err := sd.signerCertificate(&signers[i]); err == nil {
+			results[i].Thumbprint = certThumbprint(cert)
+			results[i].Subject = cert.Subject.String()
+		}
+	}
+
+	if len(signers) == 1 {
+		results[0].Valid = result.Valid
+		results[0].Error = result.Error
+		results[0].Failure = result.Failure
+		result.SignerResults = results
+		return
+	}
+
+	validCount := 0
+	for i := range results {
+		c.verifySigner(ctx, config, workDir, dataFile, sd, &results[i])
+		if results[i].Valid {
+			validCount++
+		}
+	}
+	result.SignerResults = results
+
+	c.log(ctx).Info("signers verified",
+		"signers", len(results),
+		"valid", validCount)
+
+	if !result.Valid || validCount == len(results) {
+		return
+	}
+
+	// cryptcp принял подпись, но подпись одного из подписантов недействительна
+	for _, signer := range results {
+		if !signer.Valid {
+			result.Valid = false
+			result.Content = nil
+			result.Failure = signer.Failure
+			result.Error = fmt.Sprintf("signer %d (%s) is invalid: %s", signer.Index, signer.Thumbprint, signer.Error)
+			break
+		}
+	}
+}
+
+// verifySigner проверяет подпись одного подписанта из sd через cryptcp с настройками config
+func (c *CryptoCLI) verifySigner(ctx context.Context, config *RuntimeConfig, workDir string, dataFile string, sd *cmsSignedData, signer *SignerResult) {
+	der, err := sd.singleSignerDER(signer.Index)
+	if err != nil {
+		signer.Error = fmt.Sprintf("extract signer: %v", err)
+		signer.Failure = FailureMalformed
+		return
+	}
+
+	signFile := fmt.Sprintf("signer_%d.p7s", signer.Index)
+	err = c.fileSystem.WriteFile(workDir+"/"+signFile, der, 0600)
+	if err != nil {
+		signer.Error = fmt.Sprintf("write signer signature: %v", err)
+		signer.Failure = FailureUnknown
+		return
+	}
+
+	verified := c.verifyFilesWith(ctx, config, workDir, dataFile, signFile)
+	signer.Valid = verified.Valid
+	signer.Error = verified.Error
+	signer.Failure = verified.Failure
+}
@@ -0,0 +1,80 @@
+package cprovlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+)
+
+// ErrSigningTimeOutOfRange время подписи не попадает в ожидаемый интервал или неизвестно
+var ErrSigningTimeOutOfRange = errors.New("время подписи вне допустимого интервала")
+
+// VerifySignedWithin проверяет подпись так же, как VerifySignature, и что время подписи
+// попадает в интервал [notBefore, notAfter]. Используется время штампа CAdES-T, а для подписи
+// без штампа - атрибут signingTime. Нулевая граница не ограничивает интервал.
+// Возвращает true без ошибки, если время в интервале, ErrInvalidSignature для недействительной
+// подписи и ErrSigningTimeOutOfRange, если время вне интервала или отсутствует в подписи
+func (c *CryptoCLI) VerifySignedWithin(ctx context.Context, dataBase64 string, sigBase64 string, notBefore time.Time, notAfter time.Time, opts ...VerifyOption) (bool, error) {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "VerifySignedWithin")
+	defer span.End()
+
+	result, err := c.VerifySignature(ctx, dataBase64, sigBase64, opts...)
+	if err != nil {
+		return false, err
+	}
+	if !result.Valid {
+		return false, fmt.Errorf("%w: %s", ErrInvalidSignature, result.Error)
+	}
+
+	signedAt, source := result.TimestampTime, "timestamp"
+	if signedAt == nil {
+		signedAt, source = result.SigningTime, "signingTime"
+	}
+	if signedAt == nil {
+		return false, fmt.Errorf("%w: signature has neither timestamp nor signingTime attribute", ErrSigningTimeOutOfRange)
+	}
+
+	if (!notBefore.IsZero() && signedAt.Before(notBefore)) || (!notAfter.IsZero() && signedAt.After(notAfter)) {
+		c.log(ctx).Warn("signing time outside expected window",
+			"signedAt", *signedAt,
+			"source", source,
+			"notBefore", notBefore,
+			"notAfter", notAfter)
+		return false, fmt.Errorf("%w: signed at %s (%s), expected between %s and %s",
+			ErrSigningTimeOutOfRange, signedAt.Format(time.RFC3339), source,
+			notBefore.Format(time.RFC3339), notAfter.Format(time.RFC3339))
+	}
+
+	return true, nil
+}
+
+// signatureTimes возвращает время из атрибута signingTime и из штампа времени первого
+// подписанта. Отсутствующее или не разобранное время возвращается как nil
+func signatureTimes(signData []byte) (signingTime *time.Time, timestampTime *time.Time) {
+	if len(signData) == 0 {
+		return nil, nil
+	}
+
+	sd, err := parseSignedData(signData)
+	if err != nil {
+		return nil, nil
+	}
+	signers, err := sd.signers()
+	if err != nil || len(signers) == 0 {
+		return nil, nil
+	}
+
+	signingTime = signerSigningTime(&signers[0])
+
+	if token, err := extractTimestampToken(signData); err == nil {
+		if info, err := parseTimestampToken(token); err == nil {
+			timestampTime = &info.Time
+		}
+	}
+
+	return signingTime, timestampTime
+}
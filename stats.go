@@ -0,0 +1,41 @@
+package cprovlib
+
+import (
+	"sync/atomic"
+)
+
+// StatsSnapshot снимок счетчиков операций клиента с момента создания
+type StatsSnapshot struct {
+	SignsAttempted uint64 `json:"signsAttempted"` // Вызовы подписи
+	SignsSucceeded uint64 `json:"signsSucceeded"` // Успешные подписи
+	SignsFailed    uint64 `json:"signsFailed"`    // Подписи, завершившиеся ошибкой
+	Retries        uint64 `json:"retries"`        // Повторные запуски cryptcp
+	TSPFailovers   uint64 `json:"tspFailovers"`   // Переключения на другой TSP сервер
+	CertsInstalled uint64 `json:"certsInstalled"` // Установленные сертификаты
+	CertsDeleted   uint64 `json:"certsDeleted"`   // Удаленные сертификаты
+}
+
+// stats атомарные счетчики операций
+type stats struct {
+	signsAttempted atomic.Uint64
+	signsSucceeded atomic.Uint64
+	signsFailed    atomic.Uint64
+	retries        atomic.Uint64
+	tspFailovers   atomic.Uint64
+	certsInstalled atomic.Uint64
+	certsDeleted   atomic.Uint64
+}
+
+// Stats возвращает копию счетчиков операций клиента.
+// Безопасен для вызова из нескольких горутин одновременно
+func (c *CryptoCLI) Stats() StatsSnapshot {
+	return StatsSnapshot{
+		SignsAttempted: c.stats.signsAttempted.Load(),
+		SignsSucceeded: c.stats.signsSucceeded.Load(),
+		SignsFailed:    c.stats.signsFailed.Load(),
+		Retries:        c.stats.retries.Load(),
+		TSPFailovers:   c.stats.tspFailovers.Load(),
+		CertsInstalled: c.stats.certsInstalled.Load(),
+		CertsDeleted:   c.stats.certsDeleted.Load(),
+	}
+}
@@ -0,0 +1,89 @@
+package cprovlib
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+)
+
+// stdoutSignaturePEMTypes типы блоков PEM, в которых cryptcp выводит подпись
+var stdoutSignaturePEMTypes = []string{"PKCS7", "CMS", "SIGNED MESSAGE"}
+
+// minStdoutBase64Length минимальная длина base64 в выводе, которую имеет смысл разбирать как подпись:
+// короче не бывает даже подписи без сертификатов
+const minStdoutBase64Length = 128
+
+// signatureFromStdout извлекает подпись из stdout cryptcp, если файл подписи не создан:
+// двоичный DER, блок PEM или base64, в том числе разбитый на строки и окруженный служебным
+// выводом. Найденные данные принимаются, только если разбираются как CMS SignedData
+func signatureFromStdout(output []byte) ([]byte, bool) {
+	trimmed := bytes.TrimSpace(output)
+	if len(trimmed) == 0 {
+		return nil, false
+	}
+
+	if isSignedData(trimmed) {
+		return trimmed, true
+	}
+
+	rest := trimmed
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		for _, blockType := range stdoutSignaturePEMTypes {
+			if block.Type == blockType && isSignedData(block.Bytes) {
+				return block.Bytes, true
+			}
+		}
+	}
+
+	// base64 - самый длинный непрерывный фрагмент строк только из символов base64
+	var best, current strings.Builder
+	flush := func() {
+		if current.Len() > best.Len() {
+			best.Reset()
+			best.WriteString(current.String())
+		}
+		current.Reset()
+	}
+	for _, line := range strings.Split(string(trimmed), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && isBase64Line(line) {
+			current.WriteString(line)
+			continue
+		}
+		flush()
+	}
+	flush()
+
+	if best.Len() < minStdoutBase64Length {
+		return nil, false
+	}
+	der, err := base64.StdEncoding.DecodeString(best.String())
+	if err != nil || !isSignedData(der) {
+		return nil, false
+	}
+	return der, true
+}
+
+// isBase64Line проверяет, что строка состоит только из символов base64
+func isBase64Line(line string) bool {
+	for _, r := range line {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '+', r == '/', r == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isSignedData проверяет, что data - ContentInfo с CMS SignedData
+func isSignedData(data []byte) bool {
+	_, err := parseSignedData(data)
+	return err == nil
+}
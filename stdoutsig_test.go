@@ -0,0 +1,57 @@
+package cprovlib
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+func TestSignatureFromStdout(t *testing.T) {
+	der := testDetachedCMS(t, newTestCA(t, "Test CA"))
+	b64 := base64.StdEncoding.EncodeToString(der)
+
+	// Base64, разбитый на строки по 64 символа, как в выводе cryptcp
+	var wrapped strings.Builder
+	for i := 0; i < len(b64); i += 64 {
+		wrapped.WriteString(b64[i:min(i+64, len(b64))])
+		wrapped.WriteString("\r\n")
+	}
+	pkcs7 := pem.EncodeToMemory(&pem.Block{Type: "PKCS7", Bytes: der})
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("not a signature")})
+
+	tests := []struct {
+		name   string
+		output string
+		want   bool
+	}{
+		{name: "DER", output: string(der), want: true},
+		{name: "DER with trailing newline", output: string(der) + "\n", want: true},
+		{name: "PEM", output: string(pkcs7), want: true},
+		{name: "PEM after other block", output: string(certificate) + string(pkcs7), want: true},
+		{name: "PEM CMS type", output: string(pem.EncodeToMemory(&pem.Block{Type: "CMS", Bytes: der})), want: true},
+		{name: "base64", output: b64, want: true},
+		{
+			name:   "noisy wrapped base64",
+			output: "CryptCP 5.0 (c) \"Crypto-Pro\", 2002-2024.\r\nSigning data...\r\n" + wrapped.String() + "[ErrorCode: 0x00000000]\r\n",
+			want:   true,
+		},
+		{name: "empty", output: "  \n", want: false},
+		{name: "only noise", output: "[ErrorCode: 0x00000000]\n", want: false},
+		{name: "short base64", output: "MIIBAAAA\n", want: false},
+		{name: "base64 of other data", output: base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0x30}, 200)), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := signatureFromStdout([]byte(tt.output))
+			if ok != tt.want {
+				t.Fatalf("signatureFromStdout found = %v, want %v", ok, tt.want)
+			}
+			if ok && !bytes.Equal(got, der) {
+				t.Fatalf("signatureFromStdout returned %d bytes, want the %d-byte signature", len(got), len(der))
+			}
+		})
+	}
+}
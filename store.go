@@ -0,0 +1,74 @@
+package cprovlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+)
+
+var (
+	ErrInvalidStore = errors.New("неверное хранилище сертификатов")
+)
+
+// knownStores стандартные хранилища КриптоПро (без префикса u - пользователь, m - компьютер)
+var knownStores = []string{"My", "Root", "CA", "AddressBook"}
+
+// ValidateStore проверяет, что настроенное хранилище существует и доступно.
+// Рекомендуется вызывать при старте сервиса, чтобы опечатки в конфигурации
+// (например, "umy" вместо "uMy") обнаруживались до первой подписи
+func (c *CryptoCLI) ValidateStore(ctx context.Context) error {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "ValidateStore")
+	defer span.End()
+
+	if c.store == "" {
+		return fmt.Errorf("%w: store is not configured", ErrInvalidStore)
+	}
+
+	if suggestion := suggestStoreName(c.store); suggestion != "" {
+		return fmt.Errorf("%w: %q, did you mean %q?", ErrInvalidStore, c.store, suggestion)
+	}
+
+	stdout, stderr, err := c.runCertmgr(ctx, "-list", "-store", c.store)
+	if err != nil {
+		// Пустое хранилище certmgr считает ошибкой, но для проверки это нормальное состояние
+		output := stdout + "\n" + stderr
+		if isEmptyStoreOutput(output) {
+			return nil
+		}
+		return fmt.Errorf("%w: %q: certmgr list: %v, stdout: %s, stderr: %s", ErrInvalidStore, c.store, err, stdout, stderr)
+	}
+
+	return nil
+}
+
+// suggestStoreName возвращает правильное написание имени стандартного хранилища,
+// если store отличается от него только регистром ("umy" -> "uMy")
+func suggestStoreName(store string) string {
+	if len(store) < 2 {
+		return ""
+	}
+
+	prefix := strings.ToLower(store[:1])
+	if prefix != "u" && prefix != "m" {
+		return ""
+	}
+
+	for _, name := range knownStores {
+		canonical := prefix + name
+		if strings.EqualFold(store, canonical) && store != canonical {
+			return canonical
+		}
+	}
+	return ""
+}
+
+// isEmptyStoreOutput проверяет, что certmgr завершился ошибкой из-за отсутствия сертификатов
+// (код 0x8010002c SCARD_E_NO_SUCH_CERTIFICATE)
+func isEmptyStoreOutput(output string) bool {
+	lower := strings.ToLower(output)
+	return parseErrorCode(output) == "0x8010002c" || strings.Contains(lower, "empty certificate list")
+}
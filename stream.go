@@ -0,0 +1,176 @@
+package cprovlib
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// defaultWriteBufferSize размер буфера потоковой записи документа по умолчанию
+const defaultWriteBufferSize = 64 * 1024
+
+// StreamingFileSystem FileSystem с потоковой записью файлов. Если реализация WithFileSystem
+// ее поддерживает, большие документы записываются частями без копии всего документа в памяти;
+// иначе поток читается целиком и записывается через WriteFile
+type StreamingFileSystem interface {
+	FileSystem
+	Create(name string, perm fs.FileMode) (io.WriteCloser, error)
+}
+
+func (osFileSystem) Create(name string, perm fs.FileMode) (io.WriteCloser, error) {
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+}
+
+// ReadStreamingFileSystem FileSystem с потоковым чтением файлов. Если реализация WithFileSystem
+// ее поддерживает, хэши документа WithDocumentDigest вычисляются без копии документа в памяти;
+// иначе файл читается целиком через ReadFile
+type ReadStreamingFileSystem interface {
+	FileSystem
+	Open(name string) (io.ReadCloser, error)
+}
+
+func (osFileSystem) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+// openFile открывает файл path для чтения. Без поддержки ReadStreamingFileSystem
+// файл читается в память целиком
+func (c *CryptoCLI) openFile(path string) (io.ReadCloser, error) {
+	rfs, ok := c.fileSystem.(ReadStreamingFileSystem)
+	if ok {
+		return rfs.Open(path)
+	}
+
+	data, err := c.fileSystem.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// document подписываемые данные: срез в памяти или поток известного размера
+type document struct {
+	data   []byte    // Данные в памяти, nil - данные читаются из reader
+	reader io.Reader // Поток данных, например декодер base64
+	size   int64     // Размер данных в байтах
+}
+
+// bytesDocument возвращает документ из данных в памяти
+func bytesDocument(data []byte) *document {
+	return &document{data: data, size: int64(len(data))}
+}
+
+// base64Document возвращает документ, который декодируется из base64 при записи в файл,
+// без промежуточного среза со всем документом. Алфавит и выравнивание проверяются заранее,
+// чтобы ошибка декодирования содержала позицию символа во входной строке
+func (c *CryptoCLI) base64Document(s string) (*document, error) {
+	input := s
+	if c.lenientBase64 {
+		input = normalizeBase64(s)
+	}
+
+	err := validateBase64(input)
+	if err != nil {
+		return nil, describeBase64Error(input, err)
+	}
+
+	padding := len(input) - len(strings.TrimRight(input, "="))
+	return &document{
+		reader: &base64DecodeReader{r: base64.NewDecoder(base64.StdEncoding, strings.NewReader(input))},
+		size:   int64(len(input)/4*3 - padding),
+	}, nil
+}
+
+// materialize читает поток документа в память (нужно для нормализации текста)
+func (d *document) materialize() ([]byte, error) {
+	if d.data != nil {
+		return d.data, nil
+	}
+	data, err := io.ReadAll(d.reader)
+	if err != nil {
+		return nil, err
+	}
+	d.data, d.reader, d.size = data, nil, int64(len(data))
+	return data, nil
+}
+
+// validateBase64 проверяет длину, алфавит и положение '=' стандартного base64
+// и возвращает base64.CorruptInputError с позицией первого недопустимого байта
+func validateBase64(input string) error {
+	for i := 0; i < len(input); i++ {
+		ch := input[i]
+		switch {
+		case ch >= 'A' && ch <= 'Z', ch >= 'a' && ch <= 'z', ch >= '0' && ch <= '9', ch == '+', ch == '/':
+		case ch == '=' && i >= len(input)-2 && strings.Trim(input[i:], "=") == "":
+		default:
+			return base64.CorruptInputError(i)
+		}
+	}
+	if len(input)%4 != 0 {
+		return base64.CorruptInputError(len(input))
+	}
+	return nil
+}
+
+// base64DecodeReader помечает ошибки декодера base64, чтобы отличать их от ошибок записи
+type base64DecodeReader struct {
+	r io.Reader
+}
+
+func (r *base64DecodeReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("base64 decode: %v", err)
+	}
+	return n, err
+}
+
+// writeDocument записывает документ в файл со случайным именем по шаблону pattern в dir
+// (см. writeTempFile). Поток записывается частями по WithWriteBufferSize
+func (c *CryptoCLI) writeDocument(dir string, pattern string, doc *document) (string, error) {
+	if doc.data != nil {
+		return c.writeTempFile(dir, pattern, doc.data)
+	}
+
+	name, path := c.tempFileName(dir, pattern)
+	err := c.writeFileFrom(path, doc.reader)
+	if err != nil {
+		c.fileSystem.RemoveAll(path)
+		return "", err
+	}
+	return name, nil
+}
+
+// writeFileFrom записывает поток r в файл path. Без поддержки StreamingFileSystem
+// поток читается в память целиком
+func (c *CryptoCLI) writeFileFrom(path string, r io.Reader) error {
+	sfs, ok := c.fileSystem.(StreamingFileSystem)
+	if !ok {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return c.fileSystem.WriteFile(path, data, 0600)
+	}
+
+	f, err := sfs.Create(path, 0600)
+	if err != nil {
+		return err
+	}
+
+	// Обертка скрывает ReadFrom файла, чтобы копирование шло через буфер заданного размера
+	bufferSize := c.writeBufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultWriteBufferSize
+	}
+	_, err = io.CopyBuffer(struct{ io.Writer }{f}, r, make([]byte, bufferSize))
+	closeErr := f.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
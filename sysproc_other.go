@@ -0,0 +1,16 @@
+//go:build !unix
+
+package cprovlib
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// detachTerminal на платформах без сессий ничего не делает
+func detachTerminal(cmd *exec.Cmd) {}
+
+// setNiceness на платформах без nice не поддерживается
+func setNiceness(pid int, niceness int) error {
+	return errors.New("niceness is not supported on this platform")
+}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package cprovlib
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachTerminal запускает процесс в отдельной сессии без управляющего терминала,
+// чтобы утилита не могла открыть /dev/tty и зависнуть в ожидании ввода
+func detachTerminal(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// setNiceness устанавливает приоритет планировщика (nice) процесса pid
+func setNiceness(pid int, niceness int) error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, pid, niceness)
+}
@@ -0,0 +1,51 @@
+package cprovlib
+
+import (
+	"bytes"
+)
+
+// utf8BOM метка порядка байтов UTF-8
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// LineEnding окончание строк нормализованного текста
+type LineEnding string
+
+const (
+	// LineEndingKeep не изменяет окончания строк
+	LineEndingKeep LineEnding = ""
+	// LineEndingLF приводит окончания строк к "\n"
+	LineEndingLF LineEnding = "\n"
+	// LineEndingCRLF приводит окончания строк к "\r\n"
+	LineEndingCRLF LineEnding = "\r\n"
+)
+
+// textNormalization параметры нормализации текстовых данных перед подписью
+type textNormalization struct {
+	lineEnding LineEnding
+}
+
+// SignWithTextNormalization нормализует текстовый документ перед подписью одного вызова
+// SignDocument: удаляет BOM UTF-8 в начале данных и приводит окончания строк ("\r\n", "\r", "\n")
+// к lineEnding (LineEndingKeep оставляет их как есть). Подписываются нормализованные байты,
+// поэтому проверяющая сторона должна получить документ в том же виде.
+// Для бинарных данных опцию не использовать: по умолчанию данные подписываются без изменений
+func SignWithTextNormalization(lineEnding LineEnding) SignOption {
+	return func(o *signOptions) {
+		o.textNormalization = &textNormalization{lineEnding: lineEnding}
+	}
+}
+
+// normalize возвращает нормализованную копию data; исходный срез не изменяется
+func (n *textNormalization) normalize(data []byte) []byte {
+	data = bytes.TrimPrefix(data, utf8BOM)
+	if n.lineEnding == LineEndingKeep {
+		return data
+	}
+
+	normalized := bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	normalized = bytes.ReplaceAll(normalized, []byte("\r"), []byte("\n"))
+	if n.lineEnding == LineEndingCRLF {
+		normalized = bytes.ReplaceAll(normalized, []byte("\n"), []byte("\r\n"))
+	}
+	return normalized
+}
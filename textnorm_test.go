@@ -0,0 +1,39 @@
+package cprovlib
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTextNormalization(t *testing.T) {
+	tests := []struct {
+		name       string
+		lineEnding LineEnding
+		input      string
+		want       string
+	}{
+		{name: "keep strips BOM", lineEnding: LineEndingKeep, input: "\ufeffa\r\nb\rc\n", want: "a\r\nb\rc\n"},
+		{name: "keep without BOM", lineEnding: LineEndingKeep, input: "a\r\nb", want: "a\r\nb"},
+		{name: "LF", lineEnding: LineEndingLF, input: "\ufeffa\r\nb\rc\nd", want: "a\nb\nc\nd"},
+		{name: "LF then CR are two line endings", lineEnding: LineEndingLF, input: "a\n\rb\r\r\n", want: "a\n\nb\n\n"},
+		{name: "CRLF", lineEnding: LineEndingCRLF, input: "a\r\nb\rc\nd", want: "a\r\nb\r\nc\r\nd"},
+		{name: "CRLF idempotent", lineEnding: LineEndingCRLF, input: "a\r\nb\r\n", want: "a\r\nb\r\n"},
+		{name: "BOM only at start", lineEnding: LineEndingLF, input: "a\ufeffb", want: "a\ufeffb"},
+		{name: "empty", lineEnding: LineEndingCRLF, input: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := []byte(tt.input)
+			n := &textNormalization{lineEnding: tt.lineEnding}
+
+			got := n.normalize(input)
+			if string(got) != tt.want {
+				t.Fatalf("normalize(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+			if !bytes.Equal(input, []byte(tt.input)) {
+				t.Fatalf("normalize changed the input to %q", input)
+			}
+		})
+	}
+}
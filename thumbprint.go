@@ -0,0 +1,37 @@
+package cprovlib
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidThumbprint строка не является SHA1 отпечатком сертификата
+var ErrInvalidThumbprint = errors.New("некорректный отпечаток сертификата")
+
+// thumbprintSeparators разделители и невидимые символы, встречающиеся в скопированных
+// отпечатках: пробелы, двоеточия, дефисы, а также метки направления текста (U+200E, U+200F)
+// и BOM, которые добавляет окно свойств сертификата Windows
+var thumbprintSeparators = strings.NewReplacer(
+	" ", "", "\t", "", ":", "", "-", "",
+	"\u200e", "", "\u200f", "", "\ufeff", "", "\u00a0", "",
+)
+
+// NormalizeThumbprint приводит SHA1 отпечаток к каноническому виду библиотеки: 40 шестнадцатеричных
+// символов в нижнем регистре без разделителей, как в CertificateInfo.Thumbprint.
+// Принимает отпечатки с пробелами, двоеточиями и дефисами в любом регистре, а также с префиксом 0x.
+// Для строки другой длины или с недопустимыми символами возвращается ErrInvalidThumbprint
+func NormalizeThumbprint(s string) (string, error) {
+	normalized := strings.ToLower(thumbprintSeparators.Replace(strings.TrimSpace(s)))
+	normalized = strings.TrimPrefix(normalized, "0x")
+
+	if len(normalized) != 40 {
+		return "", fmt.Errorf("%w: %q: expected 40 hex characters, got %d", ErrInvalidThumbprint, s, len(normalized))
+	}
+	if _, err := hex.DecodeString(normalized); err != nil {
+		return "", fmt.Errorf("%w: %q: %v", ErrInvalidThumbprint, s, err)
+	}
+
+	return normalized, nil
+}
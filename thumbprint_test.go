@@ -0,0 +1,55 @@
+package cprovlib
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeThumbprint(t *testing.T) {
+	const want = "abcdef0123456789abcdef0123456789abcdef01"
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{name: "canonical", input: want},
+		{name: "upper case", input: "ABCDEF0123456789ABCDEF0123456789ABCDEF01"},
+		{name: "colons", input: "AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67:89:AB:CD:EF:01"},
+		{name: "spaces", input: "ab cd ef 01 23 45 67 89 ab cd ef 01 23 45 67 89 ab cd ef 01"},
+		{name: "dashes", input: "ab-cd-ef-01-23-45-67-89-ab-cd-ef-01-23-45-67-89-ab-cd-ef-01"},
+		{name: "0x prefix", input: "0xABCDEF0123456789ABCDEF0123456789ABCDEF01"},
+		{name: "surrounding whitespace", input: "\t" + want + "\r\n"},
+		{
+			// Так отпечаток копируется из окна свойств сертификата Windows: U+200E и неразрывные пробелы
+			name:  "Windows certificate dialog",
+			input: strings.ReplaceAll("\u200eab cd ef 01 23 45 67 89 ab cd ef 01 23 45 67 89 ab cd ef 01", " ", "\u00a0"),
+		},
+		{name: "BOM", input: "\ufeff" + want},
+		{name: "empty", input: "", wantErr: true},
+		{name: "too short", input: want[:38], wantErr: true},
+		{name: "too long", input: want + "00", wantErr: true},
+		{name: "SHA-256 length", input: want + want[:24], wantErr: true},
+		{name: "not hex", input: "zbcdef0123456789abcdef0123456789abcdef01", wantErr: true},
+		{name: "prefix only stripped once", input: "0x0x" + want[2:], wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeThumbprint(tt.input)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidThumbprint) {
+					t.Fatalf("NormalizeThumbprint(%q) = %q, %v, want ErrInvalidThumbprint", tt.input, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NormalizeThumbprint(%q): %v", tt.input, err)
+			}
+			if got != want {
+				t.Fatalf("NormalizeThumbprint(%q) = %q, want %q", tt.input, got, want)
+			}
+		})
+	}
+}
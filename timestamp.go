@@ -0,0 +1,312 @@
+package cprovlib
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha1"
+	_ "crypto/sha256" // SHA-256 для messageImprint
+	_ "crypto/sha512" // SHA-384 и SHA-512 для messageImprint
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+)
+
+var (
+	ErrTimestamp   = errors.New("ошибка проверки штампа времени")
+	ErrTSPRejected = errors.New("штамп времени отклонен проверкой TSA")
+)
+
+// TimestampInfo результат проверки штампа времени подписи CAdES-T
+type TimestampInfo struct {
+	Time          time.Time `json:"time"`                    // Время из штампа (genTime)
+	TSAName       string    `json:"tsaName"`                 // Имя службы штампов времени
+	TSAThumbprint string    `json:"tsaThumbprint,omitempty"` // SHA1 отпечаток сертификата TSA
+	Policy        string    `json:"policy"`                  // OID политики TSA
+	Valid         bool      `json:"valid"`                   // Подпись штампа, цепочка сертификата TSA и messageImprint действительны
+	Error         string    `json:"error,omitempty"`         // Причина недействительности штампа
+}
+
+// VerifyTimestamp проверяет только штамп времени подписи, не проверяя саму подпись:
+// извлекает штамп из атрибута signatureTimeStampToken и проверяет его через cryptcp
+// (подпись TSA и цепочку сертификата TSA на текущий момент), а также что messageImprint
+// штампа - хэш значения подписи, к которой он приложен: штамп другой подписи недействителен.
+// Ошибка возвращается, если штамп не удалось извлечь; результат проверки - в TimestampInfo.Valid
+func (c *CryptoCLI) VerifyTimestamp(ctx context.Context, signatureBase64 string) (*TimestampInfo, error) {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "VerifyTimestamp")
+	defer span.End()
+
+	sigData, err := c.decodeBase64(signatureBase64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: base64 decode: %v", ErrTimestamp, err)
+	}
+
+	token, err := extractTimestampToken(sigData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTimestamp, err)
+	}
+
+	info, err := parseTimestampToken(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTimestamp, err)
+	}
+
+	// Штамп времени - это присоединенная подпись TSA над TSTInfo, проверяем его как обычную подпись
+	workDir, err := c.newWorkDir()
+	if err != nil {
+		return nil, fmt.Errorf("%w: create work directory: %v", ErrTimestamp, err)
+	}
+	defer c.removeWorkDir(workDir)
+
+	err = c.fileSystem.WriteFile(filepath.Join(workDir, "token.p7s"), token, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("%w: write token file: %v", ErrTimestamp, err)
+	}
+
+	stdout, stderr, err := c.runCryptcp(ctx, workDir, "-verify", "token.p7s", "tstinfo.der")
+	if err == nil && strings.Contains(strings.ToLower(stdout+stderr), "error:") {
+		err = errors.New("cryptcp reported error in output")
+	}
+	if err != nil {
+		info.Error = fmt.Sprintf("%v, stdout: %s, stderr: %s", err, stdout, stderr)
+		c.log(ctx).Warn("timestamp verification failed",
+			"tsaName", info.TSAName,
+			"time", info.Time,
+			"error", c.logOutput(info.Error))
+		return info, nil
+	}
+
+	// Подпись TSA действительна, но штамп мог быть скопирован из другой подписи
+	err = c.checkMessageImprint(ctx, workDir, sigData, token)
+	if err != nil {
+		info.Error = fmt.Sprintf("message imprint: %v", err)
+		c.log(ctx).Warn("timestamp verification failed",
+			"tsaName", info.TSAName,
+			"time", info.Time,
+			"error", info.Error)
+		return info, nil
+	}
+
+	info.Valid = true
+	c.log(ctx).Info("timestamp verified",
+		"tsaName", info.TSAName,
+		"time", info.Time)
+
+	return info, nil
+}
+
+// extractTimestampToken возвращает штамп времени (ContentInfo) первой подписи PKCS#7
+func extractTimestampToken(sigData []byte) ([]byte, error) {
+	sd, err := parseSignedData(sigData)
+	if err != nil {
+		return nil, fmt.Errorf("parse signature: %v", err)
+	}
+
+	signers, err := sd.signers()
+	if err != nil {
+		return nil, fmt.Errorf("parse signature: %v", err)
+	}
+	if len(signers) == 0 {
+		return nil, errors.New("signature has no signer infos")
+	}
+
+	attr := findAttribute(signers[0].unsignedAttrs, oidAttrTimeStampToken)
+	if attr == nil || len(attr.values) == 0 {
+		return nil, errors.New("signature has no timestamp token (not a CAdES-T signature)")
+	}
+
+	return attr.values[0].FullBytes, nil
+}
+
+// imprintHashes алгоритмы хэша messageImprint, вычисляемые в процессе
+var imprintHashes = map[string]crypto.Hash{
+	"1.3.14.3.2.26":          crypto.SHA1,
+	"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+	"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+	"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+}
+
+// gostImprintHashes алгоритмы хэша ГОСТ messageImprint (вычисляются cryptcp -hash) и размер хэша
+var gostImprintHashes = map[string]int{
+	"1.2.643.7.1.1.2.2": 32, // ГОСТ Р 34.11-2012 256 бит
+	"1.2.643.7.1.1.2.3": 64, // ГОСТ Р 34.11-2012 512 бит
+	"1.2.643.2.2.9":     32, // ГОСТ Р 34.11-94
+}
+
+// checkMessageImprint проверяет, что messageImprint штампа token - хэш значения подписи
+// первого подписанта sigData (RFC 3161, CAdES-T), вычисленный алгоритмом из messageImprint
+func (c *CryptoCLI) checkMessageImprint(ctx context.Context, workDir string, sigData []byte, token []byte) error {
+	sd, err := parseSignedData(sigData)
+	if err != nil {
+		return fmt.Errorf("parse signature: %v", err)
+	}
+	signers, err := sd.signers()
+	if err != nil || len(signers) == 0 {
+		return fmt.Errorf("parse signature signer: %v", err)
+	}
+	signatureValue := signers[0].signature
+
+	hashAlg, imprint, err := parseMessageImprint(token)
+	if err != nil {
+		return err
+	}
+
+	var digest []byte
+	if hash, ok := imprintHashes[hashAlg.String()]; ok {
+		h := hash.New()
+		h.Write(signatureValue)
+		digest = h.Sum(nil)
+	} else if size, ok := gostImprintHashes[hashAlg.String()]; ok {
+		signatureFile := filepath.Join(workDir, "signature_value.bin")
+		err = c.fileSystem.WriteFile(signatureFile, signatureValue, 0600)
+		if err != nil {
+			return fmt.Errorf("write signature value: %v", err)
+		}
+		digestHex, err := c.hashFileGOST(ctx, workDir, "signature_value.bin", hashAlg.String(), size)
+		if err != nil {
+			return fmt.Errorf("hash signature value: %v", err)
+		}
+		digest, _ = hex.DecodeString(digestHex)
+	} else {
+		return fmt.Errorf("unsupported hash algorithm %s", hashAlg)
+	}
+
+	if !bytes.Equal(digest, imprint) {
+		return errors.New("timestamp does not belong to this signature: hash of signature value differs")
+	}
+	return nil
+}
+
+// parseMessageImprint возвращает алгоритм хэша и хэш поля messageImprint TSTInfo штампа:
+// MessageImprint ::= SEQUENCE { hashAlgorithm AlgorithmIdentifier, hashedMessage OCTET STRING }
+func parseMessageImprint(token []byte) (asn1.ObjectIdentifier, []byte, error) {
+	sd, err := parseSignedData(token)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse timestamp token: %v", err)
+	}
+	if !sd.eContentType.Equal(oidTSTInfo) || sd.eContent == nil {
+		return nil, nil, errors.New("timestamp token does not contain TSTInfo")
+	}
+
+	var tstInfo asn1.RawValue
+	if _, err := asn1.Unmarshal(sd.eContent, &tstInfo); err != nil {
+		return nil, nil, fmt.Errorf("parse TSTInfo: %v", err)
+	}
+	fields, err := asn1Elements(tstInfo)
+	if err != nil || len(fields) < 5 {
+		return nil, nil, errors.New("parse TSTInfo: malformed sequence")
+	}
+
+	var imprint struct {
+		HashAlgorithm pkix.AlgorithmIdentifier
+		HashedMessage []byte
+	}
+	if _, err := asn1.Unmarshal(fields[2].FullBytes, &imprint); err != nil {
+		return nil, nil, fmt.Errorf("parse TSTInfo messageImprint: %v", err)
+	}
+
+	return imprint.HashAlgorithm.Algorithm, imprint.HashedMessage, nil
+}
+
+// parseTimestampToken разбирает TSTInfo и сертификат TSA из штампа времени
+func parseTimestampToken(token []byte) (*TimestampInfo, error) {
+	sd, err := parseSignedData(token)
+	if err != nil {
+		return nil, fmt.Errorf("parse timestamp token: %v", err)
+	}
+	if !sd.eContentType.Equal(oidTSTInfo) || sd.eContent == nil {
+		return nil, errors.New("timestamp token does not contain TSTInfo")
+	}
+
+	// TSTInfo ::= SEQUENCE { version, policy, messageImprint, serialNumber, genTime,
+	//   accuracy OPTIONAL, ordering DEFAULT FALSE, nonce OPTIONAL, tsa [0] OPTIONAL, extensions [1] OPTIONAL }
+	var tstInfo asn1.RawValue
+	if _, err := asn1.Unmarshal(sd.eContent, &tstInfo); err != nil {
+		return nil, fmt.Errorf("parse TSTInfo: %v", err)
+	}
+	fields, err := asn1Elements(tstInfo)
+	if err != nil || len(fields) < 5 {
+		return nil, errors.New("parse TSTInfo: malformed sequence")
+	}
+
+	info := &TimestampInfo{}
+
+	var policy asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(fields[1].FullBytes, &policy); err == nil {
+		info.Policy = policy.String()
+	}
+
+	if _, err := asn1.Unmarshal(fields[4].FullBytes, &info.Time); err != nil {
+		return nil, fmt.Errorf("parse TSTInfo genTime: %v", err)
+	}
+
+	for _, field := range fields[5:] {
+		if isContextTag(field, 0) {
+			info.TSAName = generalNameString(field.Bytes)
+		}
+	}
+
+	signers, err := sd.signers()
+	if err == nil && len(signers) > 0 {
+		cert, err := sd.signerCertificate(&signers[0])
+		if err == nil {
+			sum := sha1.Sum(cert.Raw)
+			info.TSAThumbprint = hex.EncodeToString(sum[:])
+			if info.TSAName == "" {
+				info.TSAName = cert.Subject.String()
+			}
+		}
+	}
+
+	return info, nil
+}
+
+// timestampCertificate возвращает сертификат TSA, подписавшего штамп времени
+func timestampCertificate(token []byte) (*x509.Certificate, error) {
+	sd, err := parseSignedData(token)
+	if err != nil {
+		return nil, fmt.Errorf("parse timestamp token: %v", err)
+	}
+
+	signers, err := sd.signers()
+	if err != nil {
+		return nil, fmt.Errorf("parse timestamp token: %v", err)
+	}
+	if len(signers) == 0 {
+		return nil, errors.New("timestamp token has no signer infos")
+	}
+
+	return sd.signerCertificate(&signers[0])
+}
+
+// generalNameString возвращает строковое представление GeneralName
+// (directoryName, rfc822Name, dNSName или URI)
+func generalNameString(der []byte) string {
+	var name asn1.RawValue
+	if _, err := asn1.Unmarshal(der, &name); err != nil || name.Class != asn1.ClassContextSpecific {
+		return ""
+	}
+
+	switch name.Tag {
+	case 4: // directoryName [4] EXPLICIT Name
+		var rdn pkix.RDNSequence
+		if _, err := asn1.Unmarshal(name.Bytes, &rdn); err != nil {
+			return ""
+		}
+		var n pkix.Name
+		n.FillFromRDNSequence(&rdn)
+		return n.String()
+	case 1, 2, 6: // rfc822Name, dNSName, uniformResourceIdentifier
+		return string(name.Bytes)
+	}
+	return ""
+}
@@ -0,0 +1,23 @@
+//go:build linux
+
+package cprovlib
+
+import (
+	"syscall"
+)
+
+// Идентификаторы файловых систем в памяти из statfs(2)
+const (
+	tmpfsMagic = 0x01021994
+	ramfsMagic = 0x858458f6
+)
+
+// isMemoryFileSystem проверяет, что dir находится на tmpfs или ramfs
+func isMemoryFileSystem(dir string) (bool, error) {
+	var st syscall.Statfs_t
+	err := syscall.Statfs(dir, &st)
+	if err != nil {
+		return false, err
+	}
+	return st.Type == tmpfsMagic || st.Type == ramfsMagic, nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package cprovlib
+
+import (
+	"errors"
+)
+
+// isMemoryFileSystem на остальных платформах не поддерживается
+func isMemoryFileSystem(dir string) (bool, error) {
+	return false, errors.New("tmpfs detection is not supported on this platform")
+}
@@ -0,0 +1,272 @@
+package cprovlib
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"time"
+)
+
+// maxChainLength предельная длина цепочки при поиске доверенного корня
+const maxChainLength = 10
+
+// anchorChain проверяет, что цепочка сертификата каждого подписанта заканчивается одним
+// из корней roots, и возвращает корень первого подписанта и цепочки подписантов (от подписанта
+// к корню). Промежуточные сертификаты берутся из подписи и intermediates. Подпись каждого звена
+// цепочки проверяется (checkIssuedBy), а сертификаты цепочки должны действовать в момент проверки
+func (c *CryptoCLI) anchorChain(ctx context.Context, workDir string, signature []byte, roots []*x509.Certificate, intermediates []*x509.Certificate) (*x509.Certificate, [][]*x509.Certificate, error) {
+	sd, err := parseSignedData(signature)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signers, err := sd.signers()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(signers) == 0 {
+		return nil, nil, errors.New("signature has no signers")
+	}
+
+	pool := append([]*x509.Certificate(nil), intermediates...)
+	for _, der := range sd.certificatesDER() {
+		cert, err := x509.ParseCertificate(der)
+		if err == nil {
+			pool = append(pool, cert)
+		}
+	}
+
+	now, _ := c.trustedNow()
+	var anchor *x509.Certificate
+	var chains [][]*x509.Certificate
+	for i := range signers {
+		cert, err := sd.signerCertificate(&signers[i])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		chain, err := c.findTrustedRoot(ctx, workDir, cert, roots, pool, now)
+		if err != nil {
+			return nil, nil, fmt.Errorf("signer %s: %v", cert.Subject, err)
+		}
+		if anchor == nil {
+			anchor = chain[len(chain)-1]
+		}
+		chains = append(chains, chain)
+	}
+
+	return anchor, chains, nil
+}
+
+// findTrustedRoot поднимается по цепочке от cert до одного из корней roots, проверяя подпись
+// каждого звена и срок действия сертификатов на время now. Возвращает цепочку от cert
+// до доверенного корня
+func (c *CryptoCLI) findTrustedRoot(ctx context.Context, workDir string, cert *x509.Certificate, roots []*x509.Certificate, pool []*x509.Certificate, now time.Time) ([]*x509.Certificate, error) {
+	current := cert
+	var chain []*x509.Certificate
+	for range maxChainLength {
+		if now.Before(current.NotBefore) || now.After(current.NotAfter) {
+			return nil, fmt.Errorf("certificate %s (%s) is not valid at %s", current.Subject, certThumbprint(current), now.Format(time.RFC3339))
+		}
+		chain = append(chain, current)
+
+		for _, root := range roots {
+			if current.Equal(root) {
+				return chain, nil
+			}
+			if !isIssuerCandidate(current, root) {
+				continue
+			}
+			err := c.checkIssuedBy(ctx, workDir, current, root)
+			if err != nil {
+				return nil, fmt.Errorf("certificate %s is not signed by trusted root %s: %v", current.Subject, root.Subject, err)
+			}
+			if now.Before(root.NotBefore) || now.After(root.NotAfter) {
+				return nil, fmt.Errorf("trusted root %s (%s) is not valid at %s", root.Subject, certThumbprint(root), now.Format(time.RFC3339))
+			}
+			return append(chain, root), nil
+		}
+
+		// Самоподписанный сертификат вне доверенного набора: цепочка закончилась
+		if bytes.Equal(current.RawSubject, current.RawIssuer) {
+			return nil, fmt.Errorf("chain ends at untrusted root %s (%s)", current.Subject, certThumbprint(current))
+		}
+
+		var issuer *x509.Certificate
+		var issuerErr error
+		for _, candidate := range pool {
+			if candidate.Equal(current) || !isIssuerCandidate(current, candidate) {
+				continue
+			}
+			issuerErr = c.checkIssuedBy(ctx, workDir, current, candidate)
+			if issuerErr == nil {
+				issuer = candidate
+				break
+			}
+		}
+		if issuer == nil {
+			if issuerErr != nil {
+				return nil, fmt.Errorf("certificate %s: issuer signature check failed: %v", current.Subject, issuerErr)
+			}
+			return nil, fmt.Errorf("issuer %s not found among trusted roots and chain certificates", current.Issuer)
+		}
+		current = issuer
+	}
+
+	return nil, errors.New("certificate chain is too long")
+}
+
+// isIssuerCandidate проверяет, что issuer может быть издателем cert: по имени издателя
+// и идентификатору ключа. Подпись сертификата не проверяется, поэтому для доверия к цепочке
+// нужен checkIssuedBy
+func isIssuerCandidate(cert *x509.Certificate, issuer *x509.Certificate) bool {
+	if !bytes.Equal(cert.RawIssuer, issuer.RawSubject) {
+		return false
+	}
+	if len(cert.AuthorityKeyId) > 0 && len(issuer.SubjectKeyId) > 0 &&
+		!bytes.Equal(cert.AuthorityKeyId, issuer.SubjectKeyId) {
+		return false
+	}
+	return true
+}
+
+// checkIssuedBy проверяет подпись сертификата cert ключом issuer. Алгоритмы, которые
+// поддерживает Go, проверяются в процессе, подписи ГОСТ - через cryptcp (verifyCertSignatureCSP).
+// Неподдерживаемый алгоритм не считается успешной проверкой
+func (c *CryptoCLI) checkIssuedBy(ctx context.Context, workDir string, cert *x509.Certificate, issuer *x509.Certificate) error {
+	err := cert.CheckSignatureFrom(issuer)
+	if !errors.Is(err, x509.ErrUnsupportedAlgorithm) {
+		return err
+	}
+	if c.fakeBackend {
+		return fmt.Errorf("fake backend cannot check %s certificate signature", cert.SignatureAlgorithm)
+	}
+	return c.verifyCertSignatureCSP(ctx, workDir, cert, issuer)
+}
+
+// certDigestAlgorithms OID алгоритма хэша для алгоритмов подписи сертификатов ГОСТ
+var certDigestAlgorithms = map[string]asn1.ObjectIdentifier{
+	"1.2.643.7.1.1.3.2": {1, 2, 643, 7, 1, 1, 2, 2}, // ГОСТ Р 34.10-2012 256 бит с ГОСТ Р 34.11-2012 256
+	"1.2.643.7.1.1.3.3": {1, 2, 643, 7, 1, 1, 2, 3}, // ГОСТ Р 34.10-2012 512 бит с ГОСТ Р 34.11-2012 512
+	"1.2.643.2.2.3":     {1, 2, 643, 2, 2, 9},       // ГОСТ Р 34.10-2001 с ГОСТ Р 34.11-94
+}
+
+// verifyCertSignatureCSP проверяет подпись сертификата cert ключом issuer через cryptcp
+// (verifySignedObjectCSP)
+func (c *CryptoCLI) verifyCertSignatureCSP(ctx context.Context, workDir string, cert *x509.Certificate, issuer *x509.Certificate) error {
+	return c.verifySignedObjectCSP(ctx, workDir, "link_"+certThumbprint(cert), cert.Raw, issuer)
+}
+
+// verifySignedObjectCSP проверяет через cryptcp подпись объекта X.509 raw (сертификата или CRL:
+// SEQUENCE { tbs, signatureAlgorithm, signatureValue }) ключом issuer. Подпись вычислена над
+// хэшем tbs так же, как подпись CMS без подписанных атрибутов над хэшем данных, поэтому tbs
+// проверяется как данные отсоединенной подписи с единственным подписантом issuer
+// (cryptcp -verify -nochain -norev). Файлы называются name, хранилища при этом не меняются
+func (c *CryptoCLI) verifySignedObjectCSP(ctx context.Context, workDir string, name string, raw []byte, issuer *x509.Certificate) error {
+	var object struct {
+		TBS                asn1.RawValue
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Signature          asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(raw, &object); err != nil {
+		return fmt.Errorf("parse signed object: %v", err)
+	}
+	digestAlgorithm, ok := certDigestAlgorithms[object.SignatureAlgorithm.Algorithm.String()]
+	if !ok {
+		return fmt.Errorf("unsupported signature algorithm %s", object.SignatureAlgorithm.Algorithm)
+	}
+
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return fmt.Errorf("parse issuer public key info: %v", err)
+	}
+
+	signature, err := certSignatureCMS(object.Signature.Bytes, issuer, digestAlgorithm, spki.Algorithm.Algorithm)
+	if err != nil {
+		return fmt.Errorf("build signature CMS: %v", err)
+	}
+
+	err = c.fileSystem.WriteFile(filepath.Join(workDir, name+".tbs"), object.TBS.FullBytes, 0600)
+	if err == nil {
+		err = c.fileSystem.WriteFile(filepath.Join(workDir, name+".p7s"), signature, 0600)
+	}
+	if err != nil {
+		return fmt.Errorf("write signature: %v", err)
+	}
+
+	config := *c.settings()
+	config.SkipChainValidation = true
+	result := c.verifyFilesWith(ctx, &config, workDir, name+".tbs", name+".p7s")
+	if !result.Valid {
+		return fmt.Errorf("signature is invalid: %s", result.Error)
+	}
+
+	return nil
+}
+
+// certSignatureCMS собирает отсоединенную подпись CMS, подписант которой - issuer,
+// а значение подписи - signatureValue сертификата или CRL. Подписанных атрибутов нет
+func certSignatureCMS(signatureValue []byte, issuer *x509.Certificate, digestAlgorithm asn1.ObjectIdentifier, signatureAlgorithm asn1.ObjectIdentifier) ([]byte, error) {
+	type algorithmIdentifier struct {
+		Algorithm asn1.ObjectIdentifier
+	}
+	type issuerAndSerial struct {
+		Issuer asn1.RawValue
+		Serial *big.Int
+	}
+	type signerInfo struct {
+		Version            int
+		SID                issuerAndSerial
+		DigestAlgorithm    algorithmIdentifier
+		SignatureAlgorithm algorithmIdentifier
+		Signature          []byte
+	}
+	type encapContentInfo struct {
+		ContentType asn1.ObjectIdentifier
+	}
+	type signedData struct {
+		Version          int
+		DigestAlgorithms []algorithmIdentifier `asn1:"set"`
+		EncapContentInfo encapContentInfo
+		Certificates     []asn1.RawValue `asn1:"tag:0,set"`
+		SignerInfos      []signerInfo    `asn1:"set"`
+	}
+	type contentInfo struct {
+		ContentType asn1.ObjectIdentifier
+		Content     signedData `asn1:"explicit,tag:0"`
+	}
+
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content: signedData{
+			Version:          1,
+			DigestAlgorithms: []algorithmIdentifier{{digestAlgorithm}},
+			EncapContentInfo: encapContentInfo{oidData},
+			Certificates:     []asn1.RawValue{{FullBytes: issuer.Raw}},
+			SignerInfos: []signerInfo{{
+				Version:            1,
+				SID:                issuerAndSerial{Issuer: asn1.RawValue{FullBytes: issuer.RawIssuer}, Serial: issuer.SerialNumber},
+				DigestAlgorithm:    algorithmIdentifier{digestAlgorithm},
+				SignatureAlgorithm: algorithmIdentifier{signatureAlgorithm},
+				Signature:          signatureValue,
+			}},
+		},
+	})
+}
+
+// certThumbprint возвращает SHA1 отпечаток сертификата в нижнем регистре
+func certThumbprint(cert *x509.Certificate) string {
+	sum := sha1.Sum(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,417 @@
+package cprovlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+)
+
+var (
+	ErrVerification     = errors.New("ошибка проверки подписи")
+	ErrInvalidSignature = errors.New("подпись недействительна")
+	ErrUnexpectedSigner = errors.New("подпись создана другим сертификатом")
+)
+
+// VerifyResult результат проверки подписи
+type VerifyResult struct {
+	Valid         bool            `json:"valid"`                   // Подпись действительна
+	Error         string          `json:"error,omitempty"`         // Причина недействительности подписи
+	ErrorCode     string          `json:"errorCode,omitempty"`     // Код ошибки КриптоПро из вывода cryptcp
+	Failure       VerifyFailure   `json:"failure,omitempty"`       // Причина недействительности: не те данные, неверная подпись, сертификат
+	TrustedRoot   string          `json:"trustedRoot,omitempty"`   // Отпечаток корня из VerifyWithTrustedRoots, до которого построена цепочка
+	Cached        bool            `json:"cached"`                  // Результат взят из кэша WithVerifyCache
+	Revocation    *RevocationInfo `json:"revocation,omitempty"`    // Статус отзыва сертификата подписанта и источник проверки
+	Content       []byte          `json:"content,omitempty"`       // Подписанные данные, извлеченные из действительной присоединенной подписи
+	SigningTime   *time.Time      `json:"signingTime,omitempty"`   // Время из атрибута signingTime (заявлено подписантом)
+	TimestampTime *time.Time      `json:"timestampTime,omitempty"` // Время из штампа времени CAdES-T (genTime)
+	Signers       []SignerInfo    `json:"signers,omitempty"`       // Подписанты: владелец, реквизиты (ИНН, ОГРН, СНИЛС), цепочка
+	SignerResults []SignerResult  `json:"signerResults,omitempty"` // Результат проверки подписи каждого подписанта (AllValid)
+	Normalized    bool            `json:"normalized,omitempty"`    // Подпись в BER перекодирована в DER перед проверкой
+	Unsupported   bool            `json:"unsupported,omitempty"`   // Корректная CMS, структуру или алгоритм которой cryptcp не поддерживает
+	Duration      time.Duration   `json:"duration"`                // Время выполнения проверки
+}
+
+// VerifySignature проверяет подпись через cryptcp.
+// Для отсоединенной подписи передаются исходные данные dataBase64. Присоединенная подпись
+// проверяется без отдельных данных (dataBase64 игнорируется), а извлеченные из нее данные
+// возвращаются в VerifyResult.Content.
+// Ошибка возвращается, только если проверку не удалось выполнить;
+// недействительная подпись возвращается как VerifyResult с Valid == false.
+// opts: необязательные параметры вызова (например, VerifyWithTrustedRoots)
+func (c *CryptoCLI) VerifySignature(ctx context.Context, dataBase64 string, signatureBase64 string, opts ...VerifyOption) (*VerifyResult, error) {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "VerifySignature")
+	defer span.End()
+
+	options, err := newVerifyOptions(opts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+
+	signData, err := c.decodeBase64(signatureBase64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature base64 decode: %v", ErrVerification, err)
+	}
+
+	// Подписи других реализаций (OpenSSL) бывают в BER, который cryptcp не принимает
+	signData, normalized := normalizeSignatureEncoding(signData)
+
+	var data []byte
+	detached := dataBase64 != ""
+
+	// Данные присоединенной подписи находятся внутри нее, переданные отдельно не нужны
+	if detached && isAttachedSignature(signData) {
+		c.log(ctx).Debug("data argument ignored for attached signature")
+		detached = false
+	}
+
+	if detached {
+		err = c.checkDocumentSize(dataBase64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrVerification, err)
+		}
+		data, err = c.decodeBase64(dataBase64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: data base64 decode: %v", ErrVerification, err)
+		}
+	}
+
+	var cacheKey [32]byte
+	if c.verifyCache != nil {
+		cacheKey = c.verifyCacheKey(data, signData, options)
+		if cached, ok := c.verifyCache.get(cacheKey); ok {
+			c.log(ctx).Debug("signature verification result taken from cache")
+			cached.Cached = true
+			return cached, nil
+		}
+	}
+
+	err = c.checkDiskSpace(c.tmpDir, int64(len(signData)+len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrVerification, err)
+	}
+
+	workDir, err := c.newWorkDir()
+	if err != nil {
+		return nil, fmt.Errorf("%w: create work directory: %v", ErrVerification, err)
+	}
+	defer c.removeWorkDir(workDir)
+
+	err = c.fileSystem.WriteFile(workDir+"/data.sgn", signData, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("%w: write signature file: %v", ErrVerification, err)
+	}
+
+	dataFile := ""
+	if detached {
+		dataFile = "data.txt"
+		err = c.fileSystem.WriteFile(workDir+"/"+dataFile, data, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("%w: write data file: %v", ErrVerification, err)
+		}
+	}
+
+	result, err := c.verifyWithOptions(ctx, workDir, dataFile, "data.sgn", signData, options)
+	if err != nil {
+		return nil, err
+	}
+	result.Normalized = normalized
+
+	// Прерванная по контексту проверка не означает, что подпись недействительна
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("%w: %v", ErrVerification, ctx.Err())
+	}
+
+	if c.verifyCache != nil && result.Valid {
+		c.verifyCache.put(cacheKey, result)
+	}
+
+	return result, nil
+}
+
+// VerifySignedBy проверяет подпись так же, как VerifySignature, и что ее создал сертификат
+// с отпечатком expectedThumbprint (для подписи с несколькими подписантами - один из них).
+// Возвращает true без ошибки при совпадении, ErrInvalidSignature для недействительной подписи
+// и ErrUnexpectedSigner для действительной подписи другого сертификата
+func (c *CryptoCLI) VerifySignedBy(ctx context.Context, dataBase64 string, sigBase64 string, expectedThumbprint string, opts ...VerifyOption) (bool, error) {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "VerifySignedBy")
+	defer span.End()
+
+	expected, err := NormalizeThumbprint(expectedThumbprint)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := c.VerifySignature(ctx, dataBase64, sigBase64, opts...)
+	if err != nil {
+		return false, err
+	}
+	if !result.Valid {
+		return false, fmt.Errorf("%w: %s", ErrInvalidSignature, result.Error)
+	}
+
+	// Подпись уже декодирована VerifySignature без ошибки
+	signData, _ := c.decodeBase64(sigBase64)
+	signData, _ = normalizeSignatureEncoding(signData)
+	signers, err := signerThumbprints(signData)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+
+	for _, thumbprint := range signers {
+		if thumbprint == expected {
+			return true, nil
+		}
+	}
+
+	c.log(ctx).Warn("signature created by unexpected certificate",
+		"expected", expected,
+		"signers", signers)
+
+	return false, fmt.Errorf("%w: expected %s, signed by %s", ErrUnexpectedSigner, expected, strings.Join(signers, ", "))
+}
+
+// isAttachedSignature проверяет, что подпись содержит подписанные данные (attached)
+func isAttachedSignature(signData []byte) bool {
+	sd, err := parseSignedData(signData)
+	return err == nil && sd.eContent != nil
+}
+
+// signerThumbprints возвращает SHA1 отпечатки сертификатов всех подписантов
+func signerThumbprints(signData []byte) ([]string, error) {
+	if isFakeSignature(signData) {
+		signature, err := parseFakeSignature(signData)
+		if err != nil {
+			return nil, err
+		}
+		return []string{signature.thumbprint}, nil
+	}
+
+	sd, err := parseSignedData(signData)
+	if err != nil {
+		return nil, fmt.Errorf("parse signature: %v", err)
+	}
+
+	signers, err := sd.signers()
+	if err != nil {
+		return nil, fmt.Errorf("parse signature: %v", err)
+	}
+
+	thumbprints := make([]string, 0, len(signers))
+	for i := range signers {
+		cert, err := sd.signerCertificate(&signers[i])
+		if err != nil {
+			return nil, err
+		}
+		thumbprints = append(thumbprints, certThumbprint(cert))
+	}
+
+	return thumbprints, nil
+}
+
+// VerifyDetachedFiles проверяет отсоединенную подпись signaturePath для файла dataPath,
+// не загружая файлы в память: cryptcp работает с файлами на месте
+func (c *CryptoCLI) VerifyDetachedFiles(ctx context.Context, dataPath string, signaturePath string, opts ...VerifyOption) (*VerifyResult, error) {
+
+	ctx, span := otel.Tracer("internal/cprovlib").Start(ctx, "VerifyDetachedFiles")
+	defer span.End()
+
+	options, err := newVerifyOptions(opts)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+
+	dataPath, err = filepath.Abs(dataPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: data path: %v", ErrVerification, err)
+	}
+	signaturePath, err = filepath.Abs(signaturePath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature path: %v", ErrVerification, err)
+	}
+
+	for _, path := range []string{dataPath, signaturePath} {
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrVerification, err)
+		}
+	}
+
+	// Рабочая директория нужна только для служебных файлов cryptcp,
+	// рядом с архивными файлами ничего не создается
+	workDir, err := c.newWorkDir()
+	if err != nil {
+		return nil, fmt.Errorf("%w: create work directory: %v", ErrVerification, err)
+	}
+	defer c.removeWorkDir(workDir)
+
+	// Подпись читается для времени подписи и построения цепочки до доверенного корня
+	signData, err := os.ReadFile(signaturePath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: read signature file: %v", ErrVerification, err)
+	}
+
+	// Подпись в BER проверяется по перекодированной в DER копии в рабочей директории
+	signData, normalized := normalizeSignatureEncoding(signData)
+	if normalized {
+		signaturePath = filepath.Join(workDir, "signature.der")
+		err = c.fileSystem.WriteFile(signaturePath, signData, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("%w: write normalized signature file: %v", ErrVerification, err)
+		}
+	}
+
+	result, err := c.verifyWithOptions(ctx, workDir, dataPath, signaturePath, signData, options)
+	if err != nil {
+		return nil, err
+	}
+	result.Normalized = normalized
+
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("%w: %v", ErrVerification, ctx.Err())
+	}
+
+	return result, nil
+}
+
+// verifyWithOptions проверяет подпись через verifyFiles с учетом опций вызова.
+// С VerifyWithTrustedRoots cryptcp проверяет подпись без цепочки, а цепочка до одного
+// из корней строится и проверяется библиотекой (anchorChain)
+func (c *CryptoCLI) verifyWithOptions(ctx context.Context, workDir string, dataFile string, signFile string, signData []byte, options *verifyOptions) (*VerifyResult, error) {
+	if c.fakeBackend {
+		return c.fakeVerify(ctx, workDir, dataFile, signData)
+	}
+
+	// Списки отзыва устанавливаются до запуска cryptcp, чтобы он нашел их без доступа к сети,
+	// и удаляются из хранилища после проверки
+	if len(options.crls) > 0 {
+		release, err := c.installCRLs(ctx, options.crls)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrVerification, err)
+		}
+		defer release()
+	}
+
+	if len(options.trustedRoots) == 0 {
+		result := c.verifyFiles(ctx, workDir, dataFile, signFile)
+		fillSignatureDetails(result, signData)
+		c.verifySigners(ctx, c.settings(), workDir, dataFile, signData, result)
+		c.checkOfflineCRLs(ctx, workDir, result, signData, options.crls, options.intermediates)
+		c.markUnsupportedCMS(result, signData)
+		return result, nil
+	}
+
+	// Цепочку до переданных корней проверяет библиотека, а cryptcp - только подпись:
+	// корни не устанавливаются в хранилища хоста и не влияют на параллельные проверки
+	config := *c.settings()
+	config.SkipChainValidation = true
+	result := c.verifyFilesWith(ctx, &config, workDir, dataFile, signFile)
+	fillSignatureDetails(result, signData)
+	c.verifySigners(ctx, &config, workDir, dataFile, signData, result)
+	c.markUnsupportedCMS(result, signData)
+	if !result.Valid {
+		return result, nil
+	}
+
+	root, chains, err := c.anchorChain(ctx, workDir, signData, options.trustedRoots, options.intermediates)
+	if err != nil {
+		result.Valid = false
+		result.Failure = FailureCertificate
+		result.Error = fmt.Sprintf("chain is not anchored in trusted roots: %v", err)
+		c.log(ctx).Warn("signature verification failed",
+			"signFile", signFile,
+			"error", c.logOutput(result.Error))
+		return result, nil
+	}
+	result.TrustedRoot = certThumbprint(root)
+
+	c.log(ctx).Debug("signature chain anchored",
+		"signFile", signFile,
+		"trustedRoot", result.TrustedRoot,
+		"subject", root.Subject.String())
+
+	// cryptcp проверял подпись без цепочки и отзыва: отзыв проверяется по цепочке из anchorChain
+	c.checkChainCRLs(ctx, workDir, result, chains, options.crls)
+
+	return result, nil
+}
+
+// verifyFiles проверяет подпись signFile через cryptcp в рабочей директории workDir.
+// Если dataFile не пустой, подпись проверяется как отсоединенная от этого файла,
+// иначе как присоединенная (извлеченные данные записываются в workDir)
+func (c *CryptoCLI) verifyFiles(ctx context.Context, workDir string, dataFile string, signFile string) *VerifyResult {
+	return c.verifyFilesWith(ctx, c.settings(), workDir, dataFile, signFile)
+}
+
+// verifyFilesWith проверяет подпись так же, как verifyFiles, с настройками config
+func (c *CryptoCLI) verifyFilesWith(ctx context.Context, config *RuntimeConfig, workDir string, dataFile string, signFile string) *VerifyResult {
+	args := []string{"-verify"}
+
+	// Проверку цепочки и отзыва отключаем так же, как при подписи
+	if config.SkipChainValidation {
+		args = append(args, "-nochain", "-norev")
+	}
+
+	if dataFile != "" {
+		args = append(args, "-detached", dataFile, signFile)
+	} else {
+		args = append(args, signFile, "verified.out")
+	}
+
+	startTime := time.Now()
+	stdout, stderr, err := c.runCryptcp(ctx, workDir, args...)
+	result := &VerifyResult{Duration: time.Since(startTime)}
+
+	if err == nil && strings.Contains(strings.ToLower(stdout+stderr), "error:") {
+		err = errors.New("cryptcp reported error in output")
+	}
+
+	// Статус отзыва из вывода cryptcp; если адрес проверки не выведен, указываем адрес
+	// из сертификата подписанта, по которому КриптоПро проверяет отзыв
+	result.Revocation = parseRevocation(stdout+"\n"+stderr, err == nil, !config.SkipChainValidation)
+	if result.Revocation.Source == "" && result.Revocation.Status != RevocationNotChecked {
+		if cert, certErr := c.signerCertificateFromFile(workDir, signFile); certErr == nil {
+			revocationSourceFromCertificate(result.Revocation, cert)
+		}
+	}
+	if err != nil {
+		result.Error = fmt.Sprintf("%v, stdout: %s, stderr: %s", err, stdout, stderr)
+		result.ErrorCode = parseErrorCode(stdout + "\n" + stderr)
+		result.Failure = classifyVerifyFailure(result.ErrorCode, stdout+"\n"+stderr)
+		c.log(ctx).Warn("signature verification failed",
+			"signFile", signFile,
+			"detached", dataFile != "",
+			"duration", result.Duration.Seconds(),
+			"failure", result.Failure,
+			"error", c.logOutput(result.Error))
+		return result
+	}
+
+	result.Valid = true
+
+	// cryptcp извлекает данные присоединенной подписи в verified.out
+	if dataFile == "" {
+		content, err := c.fileSystem.ReadFile(filepath.Join(workDir, "verified.out"))
+		if err != nil {
+			c.log(ctx).Warn("attached signature content not extracted",
+				"signFile", signFile,
+				"error", err)
+		} else {
+			result.Content = content
+		}
+	}
+
+	c.log(ctx).Info("signature verified",
+		"signFile", signFile,
+		"detached", dataFile != "",
+		"revocation", result.Revocation.Status,
+		"duration", result.Duration.Seconds())
+
+	return result
+}
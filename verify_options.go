@@ -0,0 +1,122 @@
+package cprovlib
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// VerifyOption дополнительный параметр отдельного вызова VerifySignature
+type VerifyOption func(*verifyOptions)
+
+// verifyOptions параметры одного вызова проверки подписи
+type verifyOptions struct {
+	trustedRoots  []*x509.Certificate    // Допустимые корневые сертификаты цепочки подписанта
+	intermediates []*x509.Certificate    // Промежуточные сертификаты, отсутствующие в подписи
+	crls          []*x509.RevocationList // Списки отзыва для проверки без доступа к сети
+	err           error                  // Ошибка разбора переданных сертификатов
+}
+
+// VerifyWithTrustedRoots ограничивает проверку заданным набором корневых сертификатов (DER или PEM).
+// Хранилища хоста не меняются: cryptcp проверяет подпись без цепочки (-nochain -norev), а цепочку
+// до одного из корней строит библиотека, проверяя подпись и срок действия каждого сертификата
+// (подписи ГОСТ - через cryptcp). Корни системного хранилища не учитываются; отпечаток корня
+// возвращается в VerifyResult.TrustedRoot. Отзыв каждого сертификата цепочки, кроме корня,
+// проверяется только по спискам VerifyWithCRLs: если они покрывают не всю цепочку или не переданы,
+// VerifyResult.Revocation получает статус RevocationUnknown
+func VerifyWithTrustedRoots(roots ...[]byte) VerifyOption {
+	return func(o *verifyOptions) {
+		certs, err := parseCertificates(roots)
+		if err != nil {
+			o.err = fmt.Errorf("trusted root: %v", err)
+			return
+		}
+		o.trustedRoots = append(o.trustedRoots, certs...)
+	}
+}
+
+// VerifyWithIntermediates добавляет промежуточные сертификаты УЦ (DER или PEM) для построения
+// цепочки до корня из VerifyWithTrustedRoots, если они не включены в саму подпись
+func VerifyWithIntermediates(certs ...[]byte) VerifyOption {
+	return func(o *verifyOptions) {
+		parsed, err := parseCertificates(certs)
+		if err != nil {
+			o.err = fmt.Errorf("intermediate certificate: %v", err)
+			return
+		}
+		o.intermediates = append(o.intermediates, parsed...)
+	}
+}
+
+// VerifyWithCRLs передает списки отзыва (DER или PEM) для проверки без доступа к OCSP и точкам
+// распространения CRL. Списки устанавливаются в хранилище CA, где их находит cryptcp, на время
+// проверки и удаляются после нее; CRL, который уже был в хранилище, остается на месте.
+// Сертификат подписанта, найденный в CRL своего издателя, делает подпись недействительной;
+// использование CRL отражается в VerifyResult.Revocation.OfflineCRL. CRL, подпись которого
+// не удалось проверить сертификатом издателя, не учитывается (RevocationUnknown)
+func VerifyWithCRLs(crls ...[]byte) VerifyOption {
+	return func(o *verifyOptions) {
+		parsed, err := parseCRLs(crls)
+		if err != nil {
+			o.err = fmt.Errorf("offline CRL: %v", err)
+			return
+		}
+		o.crls = append(o.crls, parsed...)
+	}
+}
+
+// VerifyWithCRLDir передает списки отзыва из файлов *.crl директории dir, как VerifyWithCRLs
+func VerifyWithCRLDir(dir string) VerifyOption {
+	return func(o *verifyOptions) {
+		paths, err := filepath.Glob(filepath.Join(dir, "*.crl"))
+		if err != nil {
+			o.err = fmt.Errorf("offline CRL directory %s: %v", dir, err)
+			return
+		}
+		if len(paths) == 0 {
+			o.err = fmt.Errorf("offline CRL directory %s: no *.crl files", dir)
+			return
+		}
+
+		raw := make([][]byte, 0, len(paths))
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				o.err = fmt.Errorf("offline CRL: %v", err)
+				return
+			}
+			raw = append(raw, data)
+		}
+		VerifyWithCRLs(raw...)(o)
+	}
+}
+
+// newVerifyOptions применяет опции вызова
+func newVerifyOptions(opts []VerifyOption) (*verifyOptions, error) {
+	o := &verifyOptions{}
+	for _, opt := range opts {
+		opt(o)
+		if o.err != nil {
+			return nil, o.err
+		}
+	}
+	return o, nil
+}
+
+// parseCertificates разбирает сертификаты в DER или PEM
+func parseCertificates(raw [][]byte) ([]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, 0, len(raw))
+	for i, der := range raw {
+		if block, _ := pem.Decode(der); block != nil {
+			der = block.Bytes
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("parse certificate %d: %v", i, err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
@@ -0,0 +1,152 @@
+package cprovlib
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"slices"
+	"sync"
+	"time"
+)
+
+// verifyCache LRU кэш результатов проверки подписи с ограниченным временем жизни записей
+type verifyCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List                 // Записи от недавно использованных к давним
+	entries map[[32]byte]*list.Element // Ключ -> элемент order
+}
+
+// verifyCacheEntry запись кэша
+type verifyCacheEntry struct {
+	key     [32]byte
+	result  VerifyResult
+	expires time.Time
+}
+
+func newVerifyCache(size int, ttl time.Duration) *verifyCache {
+	return &verifyCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[[32]byte]*list.Element),
+	}
+}
+
+// get возвращает глубокую копию результата из кэша, если запись есть и не устарела
+func (vc *verifyCache) get(key [32]byte) (*VerifyResult, bool) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	elem, ok := vc.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*verifyCacheEntry)
+	if vc.ttl > 0 && time.Now().After(entry.expires) {
+		vc.order.Remove(elem)
+		delete(vc.entries, key)
+		return nil, false
+	}
+
+	vc.order.MoveToFront(elem)
+	return cloneVerifyResult(&entry.result), true
+}
+
+// put сохраняет результат, вытесняя давно не использованные записи при превышении размера
+func (vc *verifyCache) put(key [32]byte, result *VerifyResult) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	entry := &verifyCacheEntry{
+		key:     key,
+		result:  *cloneVerifyResult(result),
+		expires: time.Now().Add(vc.ttl),
+	}
+
+	if elem, ok := vc.entries[key]; ok {
+		elem.Value = entry
+		vc.order.MoveToFront(elem)
+		return
+	}
+
+	vc.entries[key] = vc.order.PushFront(entry)
+	for vc.order.Len() > vc.size {
+		oldest := vc.order.Back()
+		vc.order.Remove(oldest)
+		delete(vc.entries, oldest.Value.(*verifyCacheEntry).key)
+	}
+}
+
+// cloneVerifyResult возвращает глубокую копию result: вызывающая сторона может изменять
+// полученный результат, не затрагивая запись кэша
+func cloneVerifyResult(result *VerifyResult) *VerifyResult {
+	clone := *result
+	clone.Content = slices.Clone(result.Content)
+	clone.SigningTime = cloneTime(result.SigningTime)
+	clone.TimestampTime = cloneTime(result.TimestampTime)
+	if result.Revocation != nil {
+		revocation := *result.Revocation
+		clone.Revocation = &revocation
+	}
+
+	clone.Signers = slices.Clone(result.Signers)
+	for i := range clone.Signers {
+		clone.Signers[i].SigningTime = cloneTime(clone.Signers[i].SigningTime)
+		clone.Signers[i].Chain = slices.Clone(clone.Signers[i].Chain)
+	}
+	clone.SignerResults = slices.Clone(result.SignerResults)
+	for i := range clone.SignerResults {
+		clone.SignerResults[i].SigningTime = cloneTime(clone.SignerResults[i].SigningTime)
+	}
+	return &clone
+}
+
+// cloneTime возвращает копию t, nil для nil
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	clone := *t
+	return &clone
+}
+
+// verifyCacheKey вычисляет ключ кэша по данным, подписи и параметрам проверки:
+// один и тот же файл, проверенный с разными доверенными корнями, кэшируется отдельно
+func (c *CryptoCLI) verifyCacheKey(data []byte, signature []byte, options *verifyOptions) [32]byte {
+	h := sha256.New()
+
+	// Длины отделяют поля друг от друга
+	writeField := func(b []byte) {
+		var n [8]byte
+		binary.BigEndian.PutUint64(n[:], uint64(len(b)))
+		h.Write(n[:])
+		h.Write(b)
+	}
+
+	writeField(data)
+	writeField(signature)
+	if c.settings().SkipChainValidation {
+		writeField([]byte("nochain"))
+	} else {
+		writeField([]byte("chain"))
+	}
+	for _, root := range options.trustedRoots {
+		writeField([]byte("root"))
+		writeField(root.Raw)
+	}
+	for _, cert := range options.intermediates {
+		writeField([]byte("intermediate"))
+		writeField(cert.Raw)
+	}
+	for _, crl := range options.crls {
+		writeField([]byte("crl"))
+		writeField(crl.Raw)
+	}
+
+	var key [32]byte
+	h.Sum(key[:0])
+	return key
+}
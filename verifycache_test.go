@@ -0,0 +1,136 @@
+package cprovlib
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerifyCacheEviction(t *testing.T) {
+	key := func(b byte) [32]byte { return [32]byte{b} }
+
+	tests := []struct {
+		name     string
+		size     int
+		put      []byte // Ключи в порядке записи
+		get      []byte // Ключи, прочитанные перед последней записью
+		last     byte
+		wantKeys []byte
+		wantGone []byte
+	}{
+		{name: "within size", size: 3, put: []byte{1, 2}, last: 3, wantKeys: []byte{1, 2, 3}},
+		{name: "oldest evicted", size: 2, put: []byte{1, 2}, last: 3, wantKeys: []byte{2, 3}, wantGone: []byte{1}},
+		{name: "read refreshes entry", size: 2, put: []byte{1, 2}, get: []byte{1}, last: 3, wantKeys: []byte{1, 3}, wantGone: []byte{2}},
+		{name: "rewrite refreshes entry", size: 2, put: []byte{1, 2, 1}, last: 3, wantKeys: []byte{1, 3}, wantGone: []byte{2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vc := newVerifyCache(tt.size, time.Hour)
+			for _, k := range tt.put {
+				vc.put(key(k), &VerifyResult{Valid: true})
+			}
+			for _, k := range tt.get {
+				if _, ok := vc.get(key(k)); !ok {
+					t.Fatalf("key %d missing before eviction", k)
+				}
+			}
+			vc.put(key(tt.last), &VerifyResult{Valid: true})
+
+			for _, k := range tt.wantKeys {
+				if _, ok := vc.get(key(k)); !ok {
+					t.Errorf("key %d evicted, want cached", k)
+				}
+			}
+			for _, k := range tt.wantGone {
+				if _, ok := vc.get(key(k)); ok {
+					t.Errorf("key %d cached, want evicted", k)
+				}
+			}
+			if vc.order.Len() != len(vc.entries) || vc.order.Len() > tt.size {
+				t.Errorf("cache holds %d entries in list and %d in map, size %d", vc.order.Len(), len(vc.entries), tt.size)
+			}
+		})
+	}
+}
+
+func TestVerifyCacheTTL(t *testing.T) {
+	vc := newVerifyCache(10, 20*time.Millisecond)
+	key := [32]byte{1}
+	vc.put(key, &VerifyResult{Valid: true})
+
+	if _, ok := vc.get(key); !ok {
+		t.Fatal("fresh entry missing")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if _, ok := vc.get(key); ok {
+		t.Fatal("expired entry returned")
+	}
+	if len(vc.entries) != 0 || vc.order.Len() != 0 {
+		t.Fatalf("expired entry not removed: %d entries", len(vc.entries))
+	}
+
+	// Новая запись того же ключа снова действует полный TTL
+	vc.put(key, &VerifyResult{Valid: true})
+	if _, ok := vc.get(key); !ok {
+		t.Fatal("entry written after expiry missing")
+	}
+}
+
+func TestVerifyCacheCloneIsolation(t *testing.T) {
+	signingTime := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	timeRef := func() *time.Time {
+		t := signingTime
+		return &t
+	}
+	original := &VerifyResult{
+		Valid:       true,
+		Content:     []byte("content"),
+		SigningTime: timeRef(),
+		Revocation:  &RevocationInfo{Status: RevocationGood},
+		Signers: []SignerInfo{{
+			Thumbprint:  "abc",
+			SigningTime: timeRef(),
+			Chain:       []ChainCertState{{Thumbprint: "root"}},
+		}},
+		SignerResults: []SignerResult{{Valid: true, SigningTime: timeRef()}},
+	}
+
+	vc := newVerifyCache(10, time.Hour)
+	key := [32]byte{1}
+	vc.put(key, original)
+
+	// Изменение переданного в put результата не затрагивает запись
+	original.Content[0] = 'X'
+	original.Signers[0].Chain[0].Thumbprint = "changed"
+	*original.SigningTime = signingTime.Add(time.Hour)
+
+	first, _ := vc.get(key)
+	if string(first.Content) != "content" || first.Signers[0].Chain[0].Thumbprint != "root" || !first.SigningTime.Equal(signingTime) {
+		t.Fatalf("cache entry changed through the stored result: %+v", first)
+	}
+
+	// Изменение полученного из get результата не затрагивает запись
+	first.Content[0] = 'Y'
+	first.Revocation.Status = RevocationRevoked
+	*first.Signers[0].SigningTime = signingTime.Add(2 * time.Hour)
+	first.Signers[0].Chain[0].Thumbprint = "changed"
+	*first.SignerResults[0].SigningTime = signingTime.Add(3 * time.Hour)
+	first.Signers = append(first.Signers, SignerInfo{Thumbprint: "extra"})
+
+	second, _ := vc.get(key)
+	switch {
+	case string(second.Content) != "content":
+		t.Errorf("content changed: %q", second.Content)
+	case second.Revocation.Status != RevocationGood:
+		t.Errorf("revocation changed: %v", second.Revocation.Status)
+	case !second.Signers[0].SigningTime.Equal(signingTime):
+		t.Errorf("signer signing time changed: %v", second.Signers[0].SigningTime)
+	case second.Signers[0].Chain[0].Thumbprint != "root":
+		t.Errorf("chain changed: %v", second.Signers[0].Chain)
+	case !second.SignerResults[0].SigningTime.Equal(signingTime):
+		t.Errorf("signer result signing time changed: %v", second.SignerResults[0].SigningTime)
+	case len(second.Signers) != 1:
+		t.Errorf("signers changed: %v", second.Signers)
+	}
+}
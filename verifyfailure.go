@@ -0,0 +1,60 @@
+package cprovlib
+
+import (
+	"slices"
+	"strings"
+)
+
+// VerifyFailure причина недействительности подписи
+type VerifyFailure string
+
+const (
+	// FailureDataMismatch подпись корректна, но подписаны другие данные: хэш переданных данных
+	// не совпадает с атрибутом messageDigest. Обычно к подписи передан не тот документ
+	FailureDataMismatch VerifyFailure = "data_mismatch"
+	// FailureBadSignature значение подписи не прошло проверку: подпись повреждена или подделана
+	FailureBadSignature VerifyFailure = "bad_signature"
+	// FailureMalformed подпись не разбирается как CMS или использует неподдерживаемую структуру
+	FailureMalformed VerifyFailure = "malformed"
+	// FailureCertificate сертификат подписанта недействителен: истек, отозван или цепочка
+	// не доверена
+	FailureCertificate VerifyFailure = "certificate"
+	// FailureUnknown причину не удалось определить по выводу cryptcp
+	FailureUnknown VerifyFailure = "unknown"
+)
+
+// dataMismatchErrorCodes коды ошибок несовпадения подписанных данных
+var dataMismatchErrorCodes = map[string]bool{
+	"0x80091007": true, // CRYPT_E_HASH_VALUE: хэш данных не совпадает с messageDigest
+}
+
+// badSignatureErrorCodes коды ошибок проверки значения подписи
+var badSignatureErrorCodes = map[string]bool{
+	"0x80090006": true, // NTE_BAD_SIGNATURE
+	"0x80096010": true, // TRUST_E_BAD_DIGEST
+}
+
+// dataMismatchMarkers признаки несовпадения хэша данных в выводе cryptcp (в нижнем регистре),
+// если код ошибки не выведен
+var dataMismatchMarkers = []string{
+	"hash value is not correct",
+	"неверное значение хэша",
+	"значение хэша неверно",
+}
+
+// classifyVerifyFailure определяет причину недействительности подписи по коду ошибки КриптоПро
+// и выводу cryptcp
+func classifyVerifyFailure(errorCode string, output string) VerifyFailure {
+	output = strings.ToLower(output)
+	switch {
+	case dataMismatchErrorCodes[errorCode] || containsAny(output, dataMismatchMarkers):
+		return FailureDataMismatch
+	case badSignatureErrorCodes[errorCode]:
+		return FailureBadSignature
+	case isCMSFormatErrorCode(errorCode):
+		return FailureMalformed
+	case slices.Contains(certChainErrorCodes, errorCode):
+		return FailureCertificate
+	}
+	return FailureUnknown
+}
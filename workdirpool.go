@@ -0,0 +1,148 @@
+package cprovlib
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// workDirPool набор заранее созданных рабочих директорий, которые очищаются
+// и переиспользуются вместо создания и удаления директории на каждую операцию
+type workDirPool struct {
+	size    int
+	once    sync.Once
+	root    string      // Родительская директория пула, читать через rootDir
+	created atomic.Bool // root записан в init
+	dirs    chan string // Свободные директории
+	err     error       // Ошибка создания пула
+}
+
+func newWorkDirPool(size int) *workDirPool {
+	return &workDirPool{
+		size: size,
+		dirs: make(chan string, size),
+	}
+}
+
+// init создает директории пула в tmpDir при первом использовании
+func (p *workDirPool) init(fsys FileSystem, tmpDir string) error {
+	p.once.Do(func() {
+		p.root, p.err = fsys.MkdirTemp(tmpDir, "cprov_pool_*")
+		if p.err != nil {
+			return
+		}
+		p.created.Store(true)
+		for range p.size {
+			dir, err := fsys.MkdirTemp(p.root, "cprov_*")
+			if err != nil {
+				p.err = err
+				return
+			}
+			p.dirs <- dir
+		}
+	})
+	return p.err
+}
+
+// rootDir возвращает родительскую директорию пула или пустую строку, если пул еще не создан.
+// Безопасен для вызова одновременно с init из другой горутины
+func (p *workDirPool) rootDir() string {
+	if !p.created.Load() {
+		return ""
+	}
+	return p.root
+}
+
+// owns проверяет, принадлежит ли директория пулу
+func (p *workDirPool) owns(dir string) bool {
+	root := p.rootDir()
+	return root != "" && filepath.Dir(dir) == root
+}
+
+// release очищает директорию и возвращает ее в пул. Если очистить директорию полностью
+// не удалось, она удаляется и заменяется новой, чтобы файлы одной операции не попали в другую
+func (p *workDirPool) release(fsys FileSystem, dir string) error {
+	cleanErr := cleanDir(fsys, dir)
+	if cleanErr != nil {
+		fsys.RemoveAll(dir)
+
+		var err error
+		dir, err = fsys.MkdirTemp(p.root, "cprov_*")
+		if err != nil {
+			return fmt.Errorf("clean pooled work directory: %v, recreate: %v", cleanErr, err)
+		}
+	}
+
+	select {
+	case p.dirs <- dir:
+	default:
+		// Пул заполнен (не должно происходить): директория не нужна
+		fsys.RemoveAll(dir)
+	}
+
+	return cleanErr
+}
+
+// cleanDir удаляет содержимое директории и проверяет, что она пуста
+func cleanDir(fsys FileSystem, dir string) error {
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		err = fsys.RemoveAll(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	entries, err = fsys.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("%d entries left after cleanup", len(entries))
+	}
+
+	return nil
+}
+
+// newWorkDir создает изолированную рабочую директорию операции в tmpDir.
+// С WithWorkDirPool директория берется из пула, а если все заняты - создается как обычно
+func (c *CryptoCLI) newWorkDir() (string, error) {
+	return c.newWorkDirIn(c.tmpDir)
+}
+
+// newWorkDirIn создает рабочую директорию в base. Пул WithWorkDirPool находится в tmpDir,
+// поэтому для других директорий (WithSignTmpDir, WithInstallTmpDir) не используется.
+// Операция считается незавершенной для Close, пока директория не передана в removeWorkDir
+func (c *CryptoCLI) newWorkDirIn(base string) (string, error) {
+	err := c.checkTmpfs(base)
+	if err != nil {
+		return "", err
+	}
+
+	if c.workDirPool != nil && base == c.tmpDir {
+		err := c.workDirPool.init(c.fileSystem, c.tmpDir)
+		if err == nil {
+			select {
+			case dir := <-c.workDirPool.dirs:
+				c.operationsWG.Add(1)
+				return dir, nil
+			default:
+			}
+		} else {
+			c.logger.Warn("work directory pool unavailable",
+				"tmpDir", c.tmpDir,
+				"error", err)
+		}
+	}
+
+	dir, err := c.fileSystem.MkdirTemp(base, "cprov_*")
+	if err != nil {
+		return "", err
+	}
+	c.operationsWG.Add(1)
+	return dir, nil
+}
@@ -0,0 +1,47 @@
+package cprovlib
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestWorkDirPoolConcurrentInit(t *testing.T) {
+	tmpDir := t.TempDir()
+	signTmpDir := t.TempDir()
+	c := New("uMy", nil, 0, &DefaultLogger{}, false,
+		WithTmpDir(tmpDir),
+		WithSignTmpDir(signTmpDir),
+		WithWorkDirPool(2))
+
+	// Директория вне пула освобождается, пока другая горутина создает пул
+	var wg sync.WaitGroup
+	for _, base := range []string{tmpDir, signTmpDir} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			workDir, err := c.newWorkDirIn(base)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			c.removeWorkDir(workDir)
+		}()
+	}
+	wg.Wait()
+
+	root := c.workDirPool.rootDir()
+	if root == "" || filepath.Dir(root) != tmpDir {
+		t.Fatalf("pool root %q, want a directory in %s", root, tmpDir)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(root); !os.IsNotExist(err) {
+		t.Fatalf("pool root not removed by Close: %v", err)
+	}
+	if entries, _ := os.ReadDir(signTmpDir); len(entries) != 0 {
+		t.Fatalf("work directory outside the pool not removed: %v", entries)
+	}
+}